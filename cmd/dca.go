@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ka1ne/kraken-trader/pkg/kraken"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var dcaConfig kraken.DCAConfig
+
+var dcaCmd = &cobra.Command{
+	Use:   "dca",
+	Short: "Buy a fixed amount on a recurring schedule",
+	Long: `Dollar-cost average into a pair: spend a fixed notional on a cron-like
+schedule, at market or with a limit order below the best bid, optionally
+skipping periods while price is above a threshold.
+
+Every period is recorded, so restarting the command never buys the same
+period twice. A period missed while the command was not running is still
+bought if it is no older than --catch-up.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config, err := dcaPlanConfig()
+		if err != nil {
+			return err
+		}
+
+		client := kraken.NewClient(
+			viper.GetString("api.key"),
+			viper.GetString("api.secret"),
+		)
+
+		dca, err := kraken.NewDCA(client, config)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer cancel()
+
+		fmt.Printf("DCA %s: buying %.2f on %q, next at %s\n", config.Pair, config.Notional,
+			config.Schedule, dca.NextPeriod(time.Now()).Format(time.RFC3339))
+		return dca.Run(ctx)
+	},
+}
+
+var dcaHistoryCmd = &cobra.Command{
+	Use:   "history",
+	Short: "List the recorded executions of a DCA plan",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config, err := dcaPlanConfig()
+		if err != nil {
+			return err
+		}
+
+		state, err := kraken.LoadDCAState(config.StatePath)
+		if err != nil {
+			return err
+		}
+
+		spent, bought := 0.0, 0.0
+		fmt.Printf("%-25s %12s %14s  %s\n", "PERIOD", "PRICE", "VOLUME", "RESULT")
+		for _, e := range state.Executions {
+			result := e.TxID
+			switch {
+			case e.Skipped != "":
+				result = "skipped: " + e.Skipped
+			case e.Error != "":
+				result = "failed: " + e.Error
+			default:
+				spent += e.Price * e.Volume
+				bought += e.Volume
+			}
+			fmt.Printf("%-25s %12.2f %14.8f  %s\n", e.Period.Format(time.RFC3339), e.Price, e.Volume, result)
+		}
+
+		if bought > 0 {
+			fmt.Printf("Bought %.8f for %.2f, average price %.2f\n", bought, spent, spent/bought)
+		}
+		return nil
+	},
+}
+
+// dcaPlanConfig fills in the default state file of a DCA plan
+func dcaPlanConfig() (kraken.DCAConfig, error) {
+	config := dcaConfig
+	if config.StatePath == "" {
+		dir, err := stateDir("dca")
+		if err != nil {
+			return config, err
+		}
+		config.StatePath = filepath.Join(dir, strings.ReplaceAll(config.Pair, "/", "")+".json")
+	}
+	return config, nil
+}
+
+func init() {
+	rootCmd.AddCommand(dcaCmd)
+	dcaCmd.AddCommand(dcaHistoryCmd)
+
+	flags := dcaCmd.PersistentFlags()
+	flags.StringVar(&dcaConfig.Pair, "pair", "", "Trading pair (e.g., BTC/USD)")
+	flags.StringVar(&dcaConfig.StatePath, "state", "", "State file (default is <state-dir>/dca/<pair>.json)")
+	dcaCmd.MarkPersistentFlagRequired("pair")
+
+	dcaCmd.Flags().StringVar(&dcaConfig.Schedule, "schedule", "@weekly", "Cron schedule in local time (e.g. \"0 9 * * 1\" for 09:00 every Monday)")
+	dcaCmd.Flags().Float64Var(&dcaConfig.Notional, "notional", 0, "Amount of the quote currency to spend per period")
+	dcaCmd.Flags().Float64Var(&dcaConfig.LimitOffset, "limit-offset", 0, "Place a limit buy this many percent below the best bid instead of buying at market")
+	dcaCmd.Flags().Float64Var(&dcaConfig.MaxPrice, "max-price", 0, "Skip periods while the price is above this")
+	dcaCmd.Flags().DurationVar(&dcaConfig.CatchUp, "catch-up", kraken.DefaultDCACatchUp, "Still buy a missed period up to this long after it")
+
+	dcaCmd.MarkFlagRequired("notional")
+}
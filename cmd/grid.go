@@ -0,0 +1,195 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/ka1ne/kraken-trader/pkg/kraken"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	gridConfig  kraken.GridConfig
+	gridPoll    time.Duration
+	gridSpacing string
+)
+
+var gridCmd = &cobra.Command{
+	Use:   "grid",
+	Short: "Run a grid trading bot",
+	Long: `Keep buy and sell limit orders on evenly spaced lines between a lower and
+upper price. Each filled buy is replaced by a sell one line up and each filled
+sell by a buy one line down, so every round trip earns one grid step.`,
+}
+
+var gridStartCmd = &cobra.Command{
+	Use:   "start",
+	Short: "Place a new grid and follow its fills",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		manager, err := newGridManager()
+		if err != nil {
+			return err
+		}
+
+		config := gridConfig
+		config.Leverage = leverage
+		config.Spacing = kraken.PriceSpacing(gridSpacing)
+		if !kraken.IsValidLeverage(config.Leverage) {
+			return fmt.Errorf("invalid leverage: must be none, 2, 3, 4, or 5")
+		}
+
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer cancel()
+
+		grid, err := manager.Start(ctx, config)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Grid %s running; stop it with: kraken-trader grid stop %s\n", grid.ID, grid.ID)
+		return manager.Run(ctx, grid)
+	},
+}
+
+var gridResumeCmd = &cobra.Command{
+	Use:   "resume <grid-id>",
+	Short: "Follow the fills of a running grid again, e.g. after a restart",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		manager, err := newGridManager()
+		if err != nil {
+			return err
+		}
+
+		grid, err := manager.Load(args[0])
+		if err != nil {
+			return err
+		}
+		if grid.Status != kraken.GridRunning {
+			return fmt.Errorf("grid %s is %s", grid.ID, grid.Status)
+		}
+
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer cancel()
+
+		return manager.Run(ctx, grid)
+	},
+}
+
+var gridStopCmd = &cobra.Command{
+	Use:   "stop <grid-id>",
+	Short: "Cancel every open order of a grid",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		manager, err := newGridManager()
+		if err != nil {
+			return err
+		}
+
+		grid, err := manager.Load(args[0])
+		if err != nil {
+			return err
+		}
+
+		// A running grid process is asked to stop the grid itself
+		if err := manager.Stop(cmd.Context(), grid); err != nil {
+			return err
+		}
+
+		printGrid(grid)
+		return nil
+	},
+}
+
+var gridStatusCmd = &cobra.Command{
+	Use:   "status [grid-id]",
+	Short: "Show the orders and profit of a grid, or list all grids",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		manager, err := newGridManager()
+		if err != nil {
+			return err
+		}
+
+		if len(args) == 0 {
+			grids, err := manager.List()
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%-12s %-10s %-8s %21s %6s %12s\n", "ID", "PAIR", "STATUS", "RANGE", "TRIPS", "NET PROFIT")
+			for _, g := range grids {
+				fmt.Printf("%-12s %-10s %-8s %10.2f-%-10.2f %6d %12.2f\n", g.ID, g.Config.Pair, g.Status,
+					g.Config.LowerPrice, g.Config.UpperPrice, g.RoundTrips, g.NetProfit())
+			}
+			return nil
+		}
+
+		grid, err := manager.Load(args[0])
+		if err != nil {
+			return err
+		}
+
+		printGrid(grid)
+		return nil
+	},
+}
+
+// newGridManager keeps grids in the grids directory of the state dir
+func newGridManager() (*kraken.GridManager, error) {
+	dir, err := stateDir("grids")
+	if err != nil {
+		return nil, err
+	}
+
+	client := kraken.NewClient(
+		viper.GetString("api.key"),
+		viper.GetString("api.secret"),
+	)
+
+	manager := kraken.NewGridManager(client, dir)
+	manager.PollInterval = gridPoll
+	return manager, nil
+}
+
+// printGrid shows a grid's resting orders and profit
+func printGrid(grid *kraken.Grid) {
+	fmt.Printf("Grid %s: %s %.2f-%.2f, %d levels of %.8f, %s\n", grid.ID, grid.Config.Pair,
+		grid.Config.LowerPrice, grid.Config.UpperPrice, len(grid.Prices), grid.Config.Volume, grid.Status)
+
+	fmt.Printf("%-6s %-5s %12s  %s\n", "LEVEL", "SIDE", "PRICE", "TXID")
+	for _, o := range grid.Orders {
+		fmt.Printf("%-6d %-5s %12.2f  %s\n", o.Level+1, o.Side, o.Price, o.TxID)
+	}
+	for _, o := range grid.Pending {
+		fmt.Printf("%-6d %-5s %12.2f  %s\n", o.Level+1, o.Side, o.Price, "(pending)")
+	}
+
+	fmt.Printf("Fills %d, round trips %d, profit %.2f, fees %.2f, net %.2f\n",
+		grid.Fills, grid.RoundTrips, grid.Profit, grid.Fees, grid.NetProfit())
+}
+
+func init() {
+	rootCmd.AddCommand(gridCmd)
+	gridCmd.AddCommand(gridStartCmd, gridResumeCmd, gridStopCmd, gridStatusCmd)
+
+	gridCmd.PersistentFlags().DurationVar(&gridPoll, "poll", kraken.DefaultGridPollInterval, "How often to check the grid's orders for fills")
+
+	flags := gridStartCmd.Flags()
+	flags.StringVar(&gridConfig.Pair, "pair", "", "Trading pair (e.g., BTC/USD)")
+	flags.Float64Var(&gridConfig.LowerPrice, "lower", 0, "Lowest grid line")
+	flags.Float64Var(&gridConfig.UpperPrice, "upper", 0, "Highest grid line")
+	flags.IntVar(&gridConfig.Levels, "levels", 10, "Number of grid lines, including both ends")
+	flags.Float64Var(&gridConfig.Volume, "volume", 0, "Volume of every grid order")
+	flags.StringVar(&gridSpacing, "spacing", "linear", "Spacing between grid lines (linear, geometric)")
+	flags.StringVar(&leverage, "leverage", "none", "Leverage (none, 2, 3, 4, 5)")
+
+	gridStartCmd.MarkFlagRequired("pair")
+	gridStartCmd.MarkFlagRequired("lower")
+	gridStartCmd.MarkFlagRequired("upper")
+	gridStartCmd.MarkFlagRequired("volume")
+}
@@ -3,6 +3,11 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/ka1ne/kraken-trader/pkg/kraken"
 	"github.com/spf13/cobra"
@@ -14,6 +19,14 @@ var (
 	volume    string
 	price     string
 	leverage  string
+	algo      string
+	algoTime  time.Duration
+	slices    int
+	randomize float64
+	chase     bool
+	maxChase  string
+	deadline  time.Duration
+	fallback  string
 )
 
 var orderCmd = &cobra.Command{
@@ -40,6 +53,16 @@ Supports various order types including market, limit, and stop orders.`,
 
 		client := kraken.NewClient(apiKey, apiSecret)
 
+		if chase && algo != "" {
+			return fmt.Errorf("--chase and --algo cannot be combined")
+		}
+		if chase {
+			return executeChaseOrder(client)
+		}
+		if algo != "" {
+			return executeAlgoOrder(client)
+		}
+
 		req := kraken.OrderRequest{
 			Pair:     pair,
 			Type:     kraken.OrderType(orderType),
@@ -59,6 +82,97 @@ Supports various order types including market, limit, and stop orders.`,
 	},
 }
 
+// executeAlgoOrder slices the order with TWAP or VWAP. --type is the type of
+// the child orders and --price the worst price they may execute at.
+func executeAlgoOrder(client *kraken.Client) error {
+	config := kraken.AlgoOrderConfig{
+		Pair:      pair,
+		Side:      side,
+		Algo:      kraken.ExecAlgo(algo),
+		Duration:  algoTime,
+		Slices:    slices,
+		Randomize: randomize,
+		ChildType: kraken.OrderType(orderType),
+		Leverage:  leverage,
+	}
+
+	var err error
+	if config.Volume, err = strconv.ParseFloat(volume, 64); err != nil {
+		return fmt.Errorf("invalid volume: %w", err)
+	}
+	if price != "" {
+		if config.LimitPrice, err = strconv.ParseFloat(price, 64); err != nil {
+			return fmt.Errorf("invalid price: %w", err)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	report, err := client.ExecuteAlgoOrder(ctx, config)
+	if report != nil {
+		printAlgoReport(report)
+	}
+	return err
+}
+
+// printAlgoReport lists the child orders and compares the achieved price
+// with the arrival price and the benchmark
+func printAlgoReport(report *kraken.AlgoReport) {
+	fmt.Printf("%-4s %-8s %14s %14s %12s  %s\n", "#", "TIME", "TARGET", "FILLED", "AVG PRICE", "ORDER")
+	for i, s := range report.Slices {
+		order := s.TxID
+		if s.Skipped != "" {
+			order = "skipped: " + s.Skipped
+		}
+		fmt.Printf("%-4d %-8s %14.8f %14.8f %12.2f  %s\n", i+1, s.Time.Format("15:04:05"), s.Target, s.Filled, s.AvgPrice, order)
+	}
+
+	fmt.Printf("\nFilled %.8f of %.8f in %v\n", report.Filled, report.Volume, report.End.Sub(report.Start).Round(time.Second))
+	fmt.Printf("Average price: %.2f\n", report.AvgPrice)
+	fmt.Printf("Arrival price: %.2f\n", report.ArrivalPrice)
+	fmt.Printf("%s benchmark: %.2f (slippage %.1f bps)\n", report.Algo, report.Benchmark, report.SlippageBps())
+}
+
+// executeChaseOrder pegs a post-only limit order to the best bid or ask until
+// it fills or the deadline passes
+func executeChaseOrder(client *kraken.Client) error {
+	config := kraken.ChaseConfig{
+		Pair:     pair,
+		Side:     side,
+		Deadline: deadline,
+		Fallback: kraken.ChaseFallback(fallback),
+	}
+
+	var err error
+	if config.Volume, err = strconv.ParseFloat(volume, 64); err != nil {
+		return fmt.Errorf("invalid volume: %w", err)
+	}
+	if maxChase != "" {
+		if config.MaxChase, config.MaxChasePercent, err = parseTrail(maxChase); err != nil {
+			return fmt.Errorf("invalid max chase: %w", err)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := client.ConnectWebSocket(ctx); err != nil {
+		return err
+	}
+	defer client.Close()
+
+	result, err := client.ExecuteChase(ctx, config)
+	if result != nil {
+		fmt.Printf("Chase order %s: filled %.8f of %s at %.2f after %d amends (started at %.2f, last at %.2f)\n",
+			result.OrderID, result.Filled, volume, result.AvgPrice, result.Amends, result.StartPrice, result.LastPrice)
+		if result.FallbackOrderID != "" {
+			fmt.Printf("Fallback %s order %s: filled %.8f\n", config.Fallback, result.FallbackOrderID, result.FallbackFilled)
+		}
+	}
+	return err
+}
+
 func init() {
 	rootCmd.AddCommand(orderCmd)
 
@@ -69,6 +183,16 @@ func init() {
 	orderCmd.Flags().StringVar(&price, "price", "", "Order price")
 	orderCmd.Flags().StringVar(&leverage, "leverage", "none", "Leverage (none, 2, 3, 4, 5)")
 
+	orderCmd.Flags().StringVar(&algo, "algo", "", "Slice the order over time with twap or vwap; --type is then the child order type and --price a price limit")
+	orderCmd.Flags().DurationVar(&algoTime, "duration", time.Hour, "How long --algo works the order")
+	orderCmd.Flags().IntVar(&slices, "slices", 12, "Number of child orders for --algo")
+	orderCmd.Flags().Float64Var(&randomize, "randomize", 0.2, "How much --algo varies slice timing and size, from 0 to 1")
+
+	orderCmd.Flags().BoolVar(&chase, "chase", false, "Peg a post-only limit order to the best bid (buys) or ask (sells) until it fills")
+	orderCmd.Flags().StringVar(&maxChase, "max-chase", "", "How far --chase may follow the price, absolute (150) or percent (0.5%); unlimited if unset")
+	orderCmd.Flags().DurationVar(&deadline, "deadline", time.Minute, "How long --chase works the order before falling back")
+	orderCmd.Flags().StringVar(&fallback, "fallback", "market", "What --chase does with the rest at the deadline: market, ioc (limit at the max chase) or none")
+
 	orderCmd.MarkFlagRequired("side")
 	orderCmd.MarkFlagRequired("pair")
 	orderCmd.MarkFlagRequired("volume")
@@ -3,6 +3,7 @@ package cmd
 import (
 	"log"
 	"os"
+	"path/filepath"
 
 	"github.com/joho/godotenv"
 	"github.com/spf13/cobra"
@@ -15,6 +16,7 @@ var (
 	apiSec  string
 	side    string
 	pair    string
+	dataDir string
 )
 
 var rootCmd = &cobra.Command{
@@ -38,8 +40,11 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&apiKey, "api-key", "", "Kraken API Key")
 	rootCmd.PersistentFlags().StringVar(&apiSec, "api-secret", "", "Kraken API Secret")
 
+	rootCmd.PersistentFlags().StringVar(&dataDir, "state-dir", "", "Directory for saved state (default is $HOME/.kraken-trader)")
+
 	viper.BindPFlag("api.key", rootCmd.PersistentFlags().Lookup("api-key"))
 	viper.BindPFlag("api.secret", rootCmd.PersistentFlags().Lookup("api-secret"))
+	viper.BindPFlag("state.dir", rootCmd.PersistentFlags().Lookup("state-dir"))
 
 	// Map environment variables
 	viper.SetEnvPrefix("KRAKEN")
@@ -73,3 +78,16 @@ func initConfig() {
 		// fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
 	}
 }
+
+// stateDir returns the directory a command keeps its saved state in
+func stateDir(name string) (string, error) {
+	dir := viper.GetString("state.dir")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".kraken-trader")
+	}
+	return filepath.Join(dir, name), nil
+}
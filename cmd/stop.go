@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/ka1ne/kraken-trader/pkg/kraken"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var stopConfig kraken.TrailingStopConfig
+
+var trailingStopCmd = &cobra.Command{
+	Use:   "trailing-stop",
+	Short: "Trail a stop behind an open position",
+	Long: `Follow the ticker for an open position and ratchet a stop behind the best
+price reached, by a percentage or a multiple of the ATR. When the stop is hit
+the position is closed with a market or limit order, or a resting stop-loss
+order is kept on the exchange and amended as the stop moves.
+
+Progress is saved so that restarting the command resumes the same stop.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config := stopConfig
+		config.Mode = kraken.StopTrailMode(strings.ToLower(string(config.Mode)))
+		if config.StatePath == "" {
+			dir, err := stateDir("stops")
+			if err != nil {
+				return err
+			}
+			name := strings.ReplaceAll(config.Pair, "/", "") + "-" + config.Side + ".json"
+			config.StatePath = filepath.Join(dir, name)
+		}
+
+		client := kraken.NewClient(
+			viper.GetString("api.key"),
+			viper.GetString("api.secret"),
+		)
+
+		stop, err := kraken.NewTrailingStop(client, config)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer cancel()
+
+		if config.Exit == kraken.AmendStopExit {
+			err = client.ConnectWebSocket(ctx)
+		} else {
+			err = client.ConnectPublicWebSocket(ctx)
+		}
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		if err := stop.Run(ctx); err != nil {
+			return err
+		}
+
+		state := stop.State()
+		fmt.Printf("Trailing stop %s: stop %.2f, best price %.2f, triggered %v\n",
+			config.Pair, state.Stop, state.Extreme, state.Triggered)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(trailingStopCmd)
+
+	flags := trailingStopCmd.Flags()
+	flags.StringVar(&stopConfig.Pair, "pair", "", "Trading pair (e.g., BTC/USD)")
+	flags.StringVar(&stopConfig.Side, "side", "", "Side of the open position (buy for long, sell for short)")
+	flags.Float64Var(&stopConfig.Volume, "volume", 0, "Position volume to protect")
+	flags.StringVar((*string)(&stopConfig.Mode), "mode", "percent", "Trail mode (percent, atr)")
+	flags.Float64Var(&stopConfig.Distance, "distance", 0, "Trail distance in percent, or as an ATR multiple")
+	flags.IntVar(&stopConfig.ATRPeriod, "atr-period", 14, "Number of candles in the ATR")
+	flags.IntVar(&stopConfig.ATRInterval, "atr-interval", 60, "ATR candle length in minutes")
+	flags.Float64Var(&stopConfig.StepSize, "step", 0, "Only move the stop in increments of at least this much")
+	flags.Float64Var(&stopConfig.InitialStop, "initial-stop", 0, "Stop level to start from")
+	flags.Float64Var(&stopConfig.ActivationPrice, "activation", 0, "Only start trailing once price reaches this level")
+	flags.StringVar(&stopConfig.Leverage, "leverage", "none", "Leverage of a margin position (none, 2, 3, 4, 5); exits are then reduce-only")
+	flags.StringVar((*string)(&stopConfig.Exit), "exit", "market", "How to exit (market, limit, amend)")
+	flags.Float64Var(&stopConfig.LimitOffset, "limit-offset", 0, "How far beyond the stop a limit exit may fill")
+	flags.StringVar(&stopConfig.StopOrderID, "stop-order-id", "", "Existing stop-loss order to amend with --exit amend")
+	flags.StringVar(&stopConfig.StatePath, "state", "", "State file (default is <state-dir>/stops/<pair>-<side>.json)")
+
+	trailingStopCmd.MarkFlagRequired("pair")
+	trailingStopCmd.MarkFlagRequired("side")
+	trailingStopCmd.MarkFlagRequired("volume")
+	trailingStopCmd.MarkFlagRequired("distance")
+}
@@ -2,7 +2,15 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/ka1ne/kraken-trader/pkg/kraken"
 	"github.com/spf13/cobra"
@@ -15,51 +23,413 @@ var (
 	orders       int
 	distribution string
 	tradeVolume  float64
+	trail        string
+	interval     time.Duration
+	spacing      string
+	levels       []float64
+	weights      []float64
+	factor       float64
+	sigma        float64
+	allOrNothing bool
+	expire       time.Duration
+	outsideBand  bool
+	takeProfit   []float64
+	tpWeights    []float64
 )
 
 var trailingCmd = &cobra.Command{
 	Use:   "trailing",
 	Short: "Execute a trailing entry strategy",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if !kraken.IsValidLeverage(leverage) {
-			return fmt.Errorf("invalid leverage: must be none, 2, 3, 4, or 5")
+		config, err := trailingConfig(cmd)
+		if err != nil {
+			return err
 		}
 
-		config := kraken.TrailingEntryConfig{
-			Pair:         pair,
-			Side:         side,
-			UpperBand:    upper,
-			LowerBand:    lower,
-			TotalVolume:  tradeVolume,
-			NumOrders:    orders,
-			Distribution: kraken.VolumeDistribution(distribution),
-			Leverage:     leverage,
+		client := kraken.NewClient(
+			viper.GetString("api.key"),
+			viper.GetString("api.secret"),
+		)
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		config.ExitTargets = takeProfit
+		config.ExitWeights = tpWeights
+
+		if config.TrailDistance > 0 || len(config.ExitTargets) > 0 {
+			if expire > 0 || outsideBand {
+				return fmt.Errorf("--expire and --cancel-outside-band cannot be used with --trail or --take-profit")
+			}
+
+			// Take-profit orders follow fills on the private connection
+			if len(config.ExitTargets) > 0 {
+				err = client.ConnectWebSocket(ctx)
+			} else {
+				err = client.ConnectPublicWebSocket(ctx)
+			}
+			if err != nil {
+				return err
+			}
+			defer client.Close()
+
+			err := client.ExecuteTrailingEntry(ctx, config)
+
+			var ladderErr *kraken.LadderError
+			if errors.As(err, &ladderErr) {
+				printLadderResult(ladderErr.Result)
+			}
+			return err
 		}
 
+		return placeManagedLadder(ctx, client, config)
+	},
+}
+
+var trailingStatusCmd = &cobra.Command{
+	Use:   "status [ladder-id]",
+	Short: "Show the fills of a placed ladder",
+	Long: `Show the orders of a ladder placed by the trailing command with their fills,
+the weighted average entry and how much of the ladder has filled. Without a
+ladder ID, every saved ladder is listed. Active ladders past their --expire,
+or whose price has left the band with --cancel-outside-band, are cancelled.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
 		client := kraken.NewClient(
 			viper.GetString("api.key"),
 			viper.GetString("api.secret"),
 		)
 
-		return client.ExecuteTrailingEntry(context.Background(), config)
+		manager, err := newLadderManager(client)
+		if err != nil {
+			return err
+		}
+
+		if len(args) == 0 {
+			ladders, err := manager.List()
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%-12s %-10s %-5s %-10s %8s  %s\n", "ID", "PAIR", "SIDE", "STATUS", "FILLED", "CREATED")
+			for _, l := range ladders {
+				if !l.Done() {
+					if err := enforceLadder(cmd.Context(), client, manager, l); err != nil {
+						log.Printf("Failed to refresh ladder %s: %v", l.ID, err)
+					}
+				}
+				fmt.Printf("%-12s %-10s %-5s %-10s %7.1f%%  %s\n", l.ID, l.Pair, l.Side, l.Status,
+					l.FilledPercent(), l.CreatedAt.Format(time.RFC3339))
+			}
+			return nil
+		}
+
+		ladder, err := manager.Load(args[0])
+		if err != nil {
+			return err
+		}
+		if !ladder.Done() {
+			if err := enforceLadder(cmd.Context(), client, manager, ladder); err != nil {
+				return err
+			}
+		}
+
+		printLadder(ladder)
+		return nil
 	},
 }
 
+var trailingResumeCmd = &cobra.Command{
+	Use:   "resume <ladder-id>",
+	Short: "Follow a placed ladder again, e.g. after a restart",
+	Long: `Follow a ladder placed by the trailing command until it is done, cancelling
+its unfilled orders once it expires or, with --cancel-outside-band, once price
+leaves the band.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client := kraken.NewClient(
+			viper.GetString("api.key"),
+			viper.GetString("api.secret"),
+		)
+
+		manager, err := newLadderManager(client)
+		if err != nil {
+			return err
+		}
+
+		ladder, err := manager.Load(args[0])
+		if err != nil {
+			return err
+		}
+		if ladder.Done() {
+			printLadder(ladder)
+			return nil
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		return monitorLadder(ctx, client, manager, ladder)
+	},
+}
+
+var trailingPlanCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "Preview the orders of a trailing entry without placing them",
+	Long: `Show the orders the trailing command would place with the same flags: price,
+volume, notional and cumulative fill of each order, the average entry if the
+whole ladder fills and the estimated maker fees. Orders below the pair's
+minimum size are flagged. Only the public API is used.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config, err := trailingConfig(cmd)
+		if err != nil {
+			return err
+		}
+
+		client := kraken.NewClient("", "")
+		plan, err := client.PlanTrailingEntry(cmd.Context(), config)
+		if err != nil {
+			return err
+		}
+
+		printPlan(plan)
+		return nil
+	},
+}
+
+// newLadderManager keeps ladders in the ladders directory of the state dir
+func newLadderManager(client *kraken.Client) (*kraken.LadderManager, error) {
+	dir, err := stateDir("ladders")
+	if err != nil {
+		return nil, err
+	}
+	return kraken.NewLadderManager(client, dir), nil
+}
+
+// placeManagedLadder places a static ladder under a ladder ID and, when it
+// should be wound down later, follows it until it is done
+func placeManagedLadder(ctx context.Context, client *kraken.Client, config kraken.TrailingEntryConfig) error {
+	manager, err := newLadderManager(client)
+	if err != nil {
+		return err
+	}
+
+	opts := kraken.LadderOptions{Timeout: expire, CancelOutsideBand: outsideBand}
+	ladder, err := manager.Place(ctx, config, opts)
+
+	var ladderErr *kraken.LadderError
+	if errors.As(err, &ladderErr) {
+		printLadderResult(ladderErr.Result)
+	}
+	if ladder == nil {
+		return err
+	}
+	if err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+
+	fmt.Printf("Placed ladder %s with %d orders\n", ladder.ID, len(ladder.Rungs))
+	if expire == 0 && !outsideBand {
+		return nil
+	}
+
+	return monitorLadder(ctx, client, manager, ladder)
+}
+
+// monitorLadder follows a ladder until it is done, streaming prices when it
+// is cancelled outside its band
+func monitorLadder(ctx context.Context, client *kraken.Client, manager *kraken.LadderManager, ladder *kraken.Ladder) error {
+	var prices chan float64
+	if ladder.CancelOutsideBand {
+		if err := client.ConnectPublicWebSocket(ctx); err != nil {
+			return err
+		}
+		defer client.Close()
+
+		prices = make(chan float64, 1)
+		if err := client.SubscribeToTicker(ctx, ladder.Pair, prices); err != nil {
+			return err
+		}
+	}
+
+	if err := manager.Monitor(ctx, ladder, prices); err != nil {
+		return err
+	}
+
+	printLadder(ladder)
+	return nil
+}
+
+// enforceLadder refreshes an active ladder and applies its expiry and band,
+// which nobody may have watched since it was placed
+func enforceLadder(ctx context.Context, client *kraken.Client, manager *kraken.LadderManager, ladder *kraken.Ladder) error {
+	var price float64
+	if ladder.CancelOutsideBand {
+		ticker, err := client.GetTickerPrice(ctx, ladder.Pair)
+		if err != nil {
+			return err
+		}
+		price = ticker.Last
+	}
+	return manager.Enforce(ctx, ladder, price)
+}
+
 func init() {
 	rootCmd.AddCommand(trailingCmd)
+	trailingCmd.AddCommand(trailingStatusCmd)
+	trailingCmd.AddCommand(trailingResumeCmd)
+	trailingCmd.AddCommand(trailingPlanCmd)
+
+	ladderFlags(trailingCmd)
+	ladderFlags(trailingPlanCmd)
+
+	trailingCmd.Flags().BoolVar(&allOrNothing, "all-or-nothing", false, "Cancel already placed orders if any order of the ladder fails")
+	trailingCmd.Flags().DurationVar(&interval, "interval", time.Minute, "Minimum time between re-centring the trailing ladder")
+	trailingCmd.Flags().DurationVar(&expire, "expire", 0, "Cancel unfilled orders this long after placing the ladder (e.g. 4h)")
+	trailingCmd.Flags().Float64SliceVar(&takeProfit, "take-profit", nil, "On each fill, place take-profit orders this many percent beyond the fill price (e.g. 1,2,4)")
+	trailingCmd.Flags().Float64SliceVar(&tpWeights, "take-profit-weights", nil, "Relative share of each fill per --take-profit target (default even)")
+	trailingCmd.Flags().BoolVar(&outsideBand, "cancel-outside-band", false, "Cancel unfilled orders once price enters and then leaves the band")
+}
+
+// ladderFlags registers the flags that describe a ladder on cmd
+func ladderFlags(cmd *cobra.Command) {
+	flags := cmd.Flags()
+	flags.StringVar(&pair, "pair", "", "Trading pair (e.g., ETH/USD)")
+	flags.StringVar(&side, "side", "", "Order side (buy/sell)")
+	flags.Float64Var(&upper, "upper", 0, "Upper price band")
+	flags.Float64Var(&lower, "lower", 0, "Lower price band")
+	flags.Float64Var(&tradeVolume, "volume", 0, "Total volume to trade")
+	flags.IntVar(&orders, "orders", 5, "Number of orders to place")
+	flags.StringVar(&distribution, "distribution", "even", "Volume distribution (even, normal, gaussian, pyramid, inverse-pyramid, exponential, custom)")
+	flags.Float64SliceVar(&weights, "weights", nil, "Relative volume per order for --distribution custom, nearest to the market first (e.g. 1,2,3)")
+	flags.Float64Var(&factor, "factor", 1.5, "Volume growth per order for --distribution exponential")
+	flags.Float64Var(&sigma, "sigma", 0, "Width in orders of the bell curve for --distribution gaussian (default a quarter of the ladder)")
+	flags.StringVar(&leverage, "leverage", "none", "Leverage (none, 2, 3, 4, 5)")
+	flags.StringVar(&spacing, "spacing", "linear", "Price spacing between orders (linear, geometric, explicit)")
+	flags.Float64SliceVar(&levels, "prices", nil, "Explicit order prices for --spacing explicit (e.g. 48000,46500,45000)")
+	flags.StringVar(&trail, "trail", "", "Wait for price to reverse by this distance before placing (e.g. 150 or 1.5%)")
+
+	cmd.MarkFlagRequired("pair")
+	cmd.MarkFlagRequired("side")
+	cmd.MarkFlagRequired("upper")
+	cmd.MarkFlagRequired("lower")
+	cmd.MarkFlagRequired("volume")
+}
+
+// trailingConfig builds the ladder config from the flags shared by trailing
+// and trailing plan
+func trailingConfig(cmd *cobra.Command) (kraken.TrailingEntryConfig, error) {
+	config := kraken.TrailingEntryConfig{
+		Pair:         pair,
+		Side:         side,
+		UpperBand:    upper,
+		LowerBand:    lower,
+		TotalVolume:  tradeVolume,
+		NumOrders:    orders,
+		Distribution: kraken.VolumeDistribution(distribution),
+		Leverage:     leverage,
+		Interval:     interval,
+		Spacing:      kraken.PriceSpacing(spacing),
+		Prices:       levels,
+		Weights:      weights,
+		Factor:       factor,
+		Sigma:        sigma,
+		AllOrNothing: allOrNothing,
+	}
+
+	if !kraken.IsValidLeverage(leverage) {
+		return config, fmt.Errorf("invalid leverage: must be none, 2, 3, 4, or 5")
+	}
+
+	if len(weights) > 0 && !cmd.Flags().Changed("distribution") {
+		config.Distribution = kraken.CustomDistribution
+	}
+	if !kraken.IsValidDistribution(string(config.Distribution)) {
+		return config, fmt.Errorf("invalid distribution: %s", distribution)
+	}
+	if config.Distribution == kraken.CustomDistribution && len(weights) == 0 {
+		return config, fmt.Errorf("--distribution custom requires --weights")
+	}
+
+	if len(levels) > 0 && !cmd.Flags().Changed("spacing") {
+		config.Spacing = kraken.ExplicitSpacing
+	}
+	switch config.Spacing {
+	case kraken.LinearSpacing, kraken.GeometricSpacing:
+	case kraken.ExplicitSpacing:
+		if len(levels) == 0 {
+			return config, fmt.Errorf("--spacing explicit requires --prices")
+		}
+	default:
+		return config, fmt.Errorf("invalid spacing: must be linear, geometric, or explicit")
+	}
+
+	if trail != "" {
+		distance, percent, err := parseTrail(trail)
+		if err != nil {
+			return config, err
+		}
+		config.TrailDistance = distance
+		config.TrailPercent = percent
+	}
+
+	return config, nil
+}
+
+// printLadderResult lists which orders of a ladder are resting and which failed
+func printLadderResult(result *kraken.LadderResult) {
+	fmt.Printf("%-4s %12s %14s  %s\n", "#", "PRICE", "VOLUME", "STATUS")
+	for _, rung := range result.Rungs {
+		status := "placed " + rung.TxID
+		switch {
+		case rung.Err != nil:
+			status = "failed: " + rung.Err.Error()
+		case rung.RolledBack:
+			status = "cancelled " + rung.TxID
+		}
+		fmt.Printf("%-4d %12.2f %14.8f  %s\n", rung.Index+1, rung.Price, rung.Volume, status)
+	}
+}
+
+// printPlan shows a ladder plan as a table followed by its totals
+func printPlan(plan *kraken.LadderPlan) {
+	fmt.Printf("%-4s %12s %14s %14s %14s\n", "#", "PRICE", "VOLUME", "NOTIONAL", "CUMULATIVE")
+	for i, rung := range plan.Rungs {
+		mark := ""
+		if rung.BelowMin {
+			mark = "  below minimum"
+		}
+		fmt.Printf("%-4d %12.2f %14.8f %14.2f %14.8f%s\n", i+1, rung.Price, rung.Volume, rung.Notional, rung.CumulativeVolume, mark)
+	}
+
+	fmt.Printf("\nTotal volume:   %.8f\n", plan.TotalVolume)
+	fmt.Printf("Total notional: %.2f\n", plan.TotalNotional)
+	fmt.Printf("Average entry:  %.2f\n", plan.AverageEntry)
+	fmt.Printf("Maker fees:     %.2f (%.2f%%)\n", plan.EstimatedFees, plan.MakerFee)
+
+	for _, w := range plan.Warnings {
+		fmt.Printf("Warning: %s\n", w)
+	}
+}
+
+// printLadder shows the fills of a managed ladder
+func printLadder(ladder *kraken.Ladder) {
+	fmt.Printf("Ladder %s: %s %s, %s\n", ladder.ID, ladder.Side, ladder.Pair, ladder.Status)
+	fmt.Printf("%-4s %12s %14s %14s %12s  %s\n", "#", "PRICE", "VOLUME", "FILLED", "AVG PRICE", "STATUS")
+	for i, rung := range ladder.Rungs {
+		fmt.Printf("%-4d %12.2f %14.8f %14.8f %12.2f  %s\n", i+1, rung.Price, rung.Volume, rung.Filled, rung.AvgPrice, rung.Status)
+	}
+	fmt.Printf("Filled %.8f of %.8f (%.1f%%), average entry %.2f\n",
+		ladder.FilledVolume(), ladder.TotalVolume(), ladder.FilledPercent(), ladder.AverageEntry())
+}
+
+// parseTrail accepts an absolute distance ("150") or a percentage ("1.5%")
+func parseTrail(s string) (float64, bool, error) {
+	percent := strings.HasSuffix(s, "%")
+
+	distance, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+	if err != nil || distance <= 0 {
+		return 0, false, fmt.Errorf("invalid trail distance %q", s)
+	}
 
-	trailingCmd.Flags().StringVar(&pair, "pair", "", "Trading pair (e.g., ETH/USD)")
-	trailingCmd.Flags().StringVar(&side, "side", "", "Order side (buy/sell)")
-	trailingCmd.Flags().Float64Var(&upper, "upper", 0, "Upper price band")
-	trailingCmd.Flags().Float64Var(&lower, "lower", 0, "Lower price band")
-	trailingCmd.Flags().Float64Var(&tradeVolume, "volume", 0, "Total volume to trade")
-	trailingCmd.Flags().IntVar(&orders, "orders", 5, "Number of orders to place")
-	trailingCmd.Flags().StringVar(&distribution, "distribution", "even", "Volume distribution (even, normal)")
-	trailingCmd.Flags().StringVar(&leverage, "leverage", "none", "Leverage (none, 2, 3, 4, 5)")
-
-	trailingCmd.MarkFlagRequired("pair")
-	trailingCmd.MarkFlagRequired("side")
-	trailingCmd.MarkFlagRequired("upper")
-	trailingCmd.MarkFlagRequired("lower")
-	trailingCmd.MarkFlagRequired("volume")
+	return distance, percent, nil
 }
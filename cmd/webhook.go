@@ -1,9 +1,18 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/ka1ne/kraken-trader/pkg/kraken"
 	"github.com/spf13/cobra"
@@ -11,7 +20,8 @@ import (
 )
 
 var (
-	port int
+	port           int
+	deadManTimeout time.Duration
 )
 
 var webhookCmd = &cobra.Command{
@@ -23,17 +33,259 @@ var webhookCmd = &cobra.Command{
 			viper.GetString("api.secret"),
 		)
 
-		http.HandleFunc("/webhook", kraken.WebhookHandler(client))
+		if deadManTimeout > 0 {
+			ctx := context.Background()
+			if err := client.ConnectPrivateWebSocket(ctx); err != nil {
+				log.Fatalf("Failed to connect websocket: %v", err)
+			}
+			defer client.Close()
 
-		addr := fmt.Sprintf(":%d", port)
-		log.Printf("Starting webhook server on %s", addr)
-		if err := http.ListenAndServe(addr, nil); err != nil {
-			log.Fatalf("Server error: %v", err)
+			if err := client.EnableDeadMansSwitch(ctx, kraken.DeadMansSwitch{Timeout: deadManTimeout}); err != nil {
+				log.Fatalf("Failed to enable dead man's switch: %v", err)
+			}
+			log.Printf("Dead man's switch armed: orders are cancelled %v after the bot stops", deadManTimeout)
 		}
+
+		auth, err := webhookAuth()
+		if err != nil {
+			log.Fatalf("Invalid webhook configuration: %v", err)
+		}
+
+		dir, err := stateDir("webhook")
+		if err != nil {
+			log.Fatalf("Failed to find state directory: %v", err)
+		}
+
+		sizing, err := webhookSizing()
+		if err != nil {
+			log.Fatalf("Invalid webhook configuration: %v", err)
+		}
+
+		config := kraken.WebhookConfig{
+			Auth:         auth,
+			Sizing:       sizing,
+			ResponseWait: viper.GetDuration("webhook.response_wait"),
+		}
+		if window := viper.GetDuration("webhook.dedupe_window"); window > 0 {
+			if config.Dedupe, err = kraken.NewAlertDeduper(filepath.Join(dir, "alerts.json"), window); err != nil {
+				log.Fatalf("Failed to load seen alerts: %v", err)
+			}
+		}
+
+		queue, err := kraken.NewAlertQueue(client, filepath.Join(dir, "queue"), viper.GetInt("webhook.workers"))
+		if err != nil {
+			log.Fatalf("Failed to load alert queue: %v", err)
+		}
+		queue.SetDeduper(config.Dedupe)
+		queue.SetMaxAlertAge(viper.GetDuration("webhook.max_alert_age"))
+		queue.SetCloseSpotBalance(viper.GetBool("webhook.close_spot_balance"))
+
+		path := viper.GetString("webhook.path")
+		routes, err := webhookRoutes(path)
+		if err != nil {
+			log.Fatalf("Invalid webhook configuration: %v", err)
+		}
+
+		mux := http.NewServeMux()
+		mux.HandleFunc(path, kraken.WebhookHandler(queue, config))
+		for route, mapping := range routes {
+			routeConfig := config
+			routeConfig.Mapping = mapping
+			mux.HandleFunc(route, kraken.WebhookHandler(queue, routeConfig))
+			log.Printf("Mapped alerts accepted on %s", route)
+		}
+
+		srv, err := kraken.NewWebhookServer(kraken.ServerConfig{
+			Addr:         net.JoinHostPort(viper.GetString("webhook.bind"), strconv.Itoa(port)),
+			CertFile:     viper.GetString("webhook.tls_cert"),
+			KeyFile:      viper.GetString("webhook.tls_key"),
+			MaxBodyBytes: viper.GetInt64("webhook.max_body"),
+			ReadTimeout:  viper.GetDuration("webhook.read_timeout"),
+			WriteTimeout: viper.GetDuration("webhook.write_timeout"),
+		}, mux)
+		if err != nil {
+			log.Fatalf("Invalid webhook configuration: %v", err)
+		}
+		if config.ResponseWait >= srv.WriteTimeout {
+			log.Fatalf("Invalid webhook configuration: response wait %v must be shorter than the write timeout %v", config.ResponseWait, srv.WriteTimeout)
+		}
+
+		queueCtx, stopQueue := context.WithCancel(context.Background())
+		queueDone := make(chan struct{})
+		go func() {
+			queue.Run(queueCtx)
+			close(queueDone)
+		}()
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		scheme := "http"
+		if srv.TLSConfig != nil {
+			scheme = "https"
+		}
+		log.Printf("Starting webhook server on %s://%s%s", scheme, srv.Addr, path)
+
+		shutdownTimeout := viper.GetDuration("webhook.shutdown_timeout")
+		if err := kraken.ServeWebhook(ctx, srv, shutdownTimeout); err != nil {
+			log.Printf("Server error: %v", err)
+		}
+
+		// No new alerts arrive now; give the queued ones the same time to
+		// finish, and leave the rest on disk for the next start
+		log.Printf("Shutting down: processing %d queued alerts", queue.Len())
+		drainCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := queue.Drain(drainCtx); err != nil {
+			log.Printf("Stopping with %v", err)
+		}
+		stopQueue()
+		<-queueDone
+		log.Printf("Webhook server stopped")
 	},
 }
 
+// webhookAuth reads the webhook authentication settings. A passphrase or an
+// HMAC secret is required, and alerts are only accepted from TradingView's
+// addresses unless webhook.allowed_ips says otherwise ("*" allows any).
+func webhookAuth() (kraken.WebhookAuth, error) {
+	auth := kraken.WebhookAuth{
+		Passphrase: viper.GetString("webhook.passphrase"),
+		HMACSecret: viper.GetString("webhook.hmac_secret"),
+		MaxAge:     viper.GetDuration("webhook.max_age"),
+		AllowedIPs: viper.GetStringSlice("webhook.allowed_ips"),
+		TrustProxy: viper.GetBool("webhook.trust_proxy"),
+	}
+
+	if auth.Passphrase == "" && auth.HMACSecret == "" {
+		return auth, fmt.Errorf("set webhook.passphrase or webhook.hmac_secret so that only your alerts can place orders")
+	}
+
+	for _, ip := range auth.AllowedIPs {
+		if ip == "*" {
+			auth.AllowedIPs = nil
+			break
+		}
+	}
+	return auth, nil
+}
+
+// webhookSizing reads the sizing rules alerts fall back to:
+//
+//	webhook:
+//	  sizing:
+//	    default: {mode: quote, size: 100}
+//	    strategies:
+//	      trend: {mode: risk, size: 1}
+func webhookSizing() (kraken.SizingConfig, error) {
+	var raw struct {
+		Default    *kraken.SizingRule           `mapstructure:"default"`
+		Strategies map[string]kraken.SizingRule `mapstructure:"strategies"`
+	}
+	if err := viper.UnmarshalKey("webhook.sizing", &raw); err != nil {
+		return kraken.SizingConfig{}, fmt.Errorf("invalid webhook.sizing: %w", err)
+	}
+
+	if raw.Default != nil {
+		if err := raw.Default.Validate(); err != nil {
+			return kraken.SizingConfig{}, fmt.Errorf("invalid default sizing: %w", err)
+		}
+	}
+	for name, rule := range raw.Strategies {
+		if err := rule.Validate(); err != nil {
+			return kraken.SizingConfig{}, fmt.Errorf("invalid sizing for strategy %s: %w", name, err)
+		}
+	}
+
+	return kraken.SizingConfig{Strategies: raw.Strategies, Default: raw.Default}, nil
+}
+
+// webhookRoutes reads extra webhook paths, besides the main path, whose alerts are mapped into the
+// TradingViewAlert fields, from JSON paths or a plain-text pattern:
+//
+//	webhook:
+//	  routes:
+//	    - path: /webhook/tv
+//	      fields: {action: strategy.order.action, pair: ticker, volume: strategy.order.contracts}
+//	      defaults: {orderType: market}
+//	    - path: /webhook/text
+//	      text: "{action} {volume} {pair} {passphrase}"
+func webhookRoutes(path string) (map[string]*kraken.AlertMapping, error) {
+	var raw []struct {
+		Path     string                 `mapstructure:"path"`
+		Fields   map[string]string      `mapstructure:"fields"`
+		Text     string                 `mapstructure:"text"`
+		Defaults map[string]interface{} `mapstructure:"defaults"`
+	}
+	if err := viper.UnmarshalKey("webhook.routes", &raw); err != nil {
+		return nil, fmt.Errorf("invalid webhook.routes: %w", err)
+	}
+
+	if !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("webhook path %q must start with /", path)
+	}
+
+	routes := make(map[string]*kraken.AlertMapping, len(raw))
+	for _, r := range raw {
+		if !strings.HasPrefix(r.Path, "/") || r.Path == path {
+			return nil, fmt.Errorf("route path %q must start with / and differ from %s", r.Path, path)
+		}
+		if _, ok := routes[r.Path]; ok {
+			return nil, fmt.Errorf("route %s is defined twice", r.Path)
+		}
+
+		mapping, err := kraken.NewAlertMapping(r.Fields, r.Text, r.Defaults)
+		if err != nil {
+			return nil, fmt.Errorf("invalid route %s: %w", r.Path, err)
+		}
+		routes[r.Path] = mapping
+	}
+	return routes, nil
+}
+
 func init() {
-	webhookCmd.Flags().IntVarP(&port, "port", "p", 8080, "Port to run webhook server on")
+	flags := webhookCmd.Flags()
+	flags.IntVarP(&port, "port", "p", 8080, "Port to run webhook server on")
+	flags.String("bind", "", "Address to listen on, e.g. 127.0.0.1 behind a reverse proxy (default all interfaces)")
+	flags.String("path", "/webhook", "Path alerts are posted to")
+	flags.String("tls-cert", "", "TLS certificate chain file; reloaded when it changes")
+	flags.String("tls-key", "", "TLS private key file")
+	flags.Int64("max-body", kraken.DefaultMaxBodyBytes, "Largest request body accepted, in bytes")
+	flags.Duration("read-timeout", kraken.DefaultReadTimeout, "Time allowed to read a request")
+	flags.Duration("write-timeout", kraken.DefaultWriteTimeout, "Time allowed to answer a request, including --response-wait")
+	flags.Duration("shutdown-timeout", 30*time.Second, "On SIGINT or SIGTERM, how long to wait for requests and queued alerts to finish")
+	flags.DurationVar(&deadManTimeout, "dead-man-timeout", 0, "Cancel all orders this long after the bot stops responding (e.g. 60s, 0 disables)")
+	flags.String("passphrase", "", "Passphrase alerts must carry in their passphrase field")
+	flags.String("hmac-secret", "", "Secret for the X-Signature HMAC of \"<X-Timestamp>.<body>\"")
+	flags.Duration("max-age", kraken.DefaultSignatureMaxAge, "How old a signed alert may be before it is rejected as a replay")
+	flags.StringSlice("allow-ip", kraken.TradingViewIPs, "IPs or CIDRs alerts are accepted from, * for any")
+	flags.Bool("trust-proxy", false, "Take the client IP from X-Forwarded-For set by a reverse proxy")
+	flags.Int("workers", kraken.DefaultAlertWorkers, "Alerts processed at once; alerts for one pair are always processed in order")
+	flags.Bool("close-spot-balance", false, "Let close and reverse alerts without a volume sell the whole spot balance of the base asset")
+	flags.Duration("max-alert-age", kraken.DefaultMaxAlertAge, "Fail queued alerts older than this instead of placing their orders (0 disables)")
+	flags.Duration("response-wait", 0, "How long a response waits for the alert's orders before answering 202 Accepted (0 answers at once)")
+	flags.Duration("dedupe-window", kraken.DefaultDedupeWindow, "How long repeated alerts are answered with their first result (0 disables)")
+
+	viper.BindPFlag("webhook.bind", flags.Lookup("bind"))
+	viper.BindPFlag("webhook.path", flags.Lookup("path"))
+	viper.BindPFlag("webhook.tls_cert", flags.Lookup("tls-cert"))
+	viper.BindPFlag("webhook.tls_key", flags.Lookup("tls-key"))
+	viper.BindPFlag("webhook.max_body", flags.Lookup("max-body"))
+	viper.BindPFlag("webhook.read_timeout", flags.Lookup("read-timeout"))
+	viper.BindPFlag("webhook.write_timeout", flags.Lookup("write-timeout"))
+	viper.BindPFlag("webhook.shutdown_timeout", flags.Lookup("shutdown-timeout"))
+	viper.BindPFlag("webhook.passphrase", flags.Lookup("passphrase"))
+	viper.BindPFlag("webhook.hmac_secret", flags.Lookup("hmac-secret"))
+	viper.BindPFlag("webhook.max_age", flags.Lookup("max-age"))
+	viper.BindPFlag("webhook.allowed_ips", flags.Lookup("allow-ip"))
+	viper.BindPFlag("webhook.trust_proxy", flags.Lookup("trust-proxy"))
+	viper.BindPFlag("webhook.dedupe_window", flags.Lookup("dedupe-window"))
+	viper.BindPFlag("webhook.workers", flags.Lookup("workers"))
+	viper.BindPFlag("webhook.response_wait", flags.Lookup("response-wait"))
+	viper.BindPFlag("webhook.max_alert_age", flags.Lookup("max-alert-age"))
+	viper.BindPFlag("webhook.close_spot_balance", flags.Lookup("close-spot-balance"))
+	viper.BindEnv("webhook.passphrase", "KRAKEN_WEBHOOK_PASSPHRASE")
+	viper.BindEnv("webhook.hmac_secret", "KRAKEN_WEBHOOK_HMAC_SECRET")
+
 	rootCmd.AddCommand(webhookCmd)
 }
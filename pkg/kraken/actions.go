@@ -0,0 +1,440 @@
+package kraken
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type AlertAction string
+
+const (
+	BuyAction        AlertAction = "buy"
+	SellAction       AlertAction = "sell"
+	CloseAction      AlertAction = "close"       // Exit the position in the pair
+	ReverseAction    AlertAction = "reverse"     // Close the position and open the opposite one
+	CancelAction     AlertAction = "cancel"      // Cancel open orders of the pair and/or strategy
+	FlattenAllAction AlertAction = "flatten_all" // Cancel every order and close every margin position
+	LadderAction     AlertAction = "ladder"      // Place a ladder of limit orders across a band
+)
+
+// Validate checks that an alert carries what its action needs
+func (a *TradingViewAlert) Validate() error {
+	switch AlertAction(a.Action) {
+	case BuyAction, SellAction:
+		if a.Pair == "" {
+			return fmt.Errorf("pair is required")
+		}
+		if err := a.validateSizing(a.Action); err != nil {
+			return err
+		}
+		if err := a.validateExits(); err != nil {
+			return err
+		}
+		switch OrderType(a.OrderType) {
+		case MarketOrder:
+		case LimitOrder:
+			if a.Price <= 0 {
+				return fmt.Errorf("price is required for limit orders")
+			}
+		default:
+			return fmt.Errorf("invalid order type %q: must be market or limit", a.OrderType)
+		}
+	case CloseAction, ReverseAction:
+		if a.Pair == "" {
+			return fmt.Errorf("pair is required")
+		}
+		if a.Volume < 0 {
+			return fmt.Errorf("volume must not be negative")
+		}
+	case CancelAction:
+		if a.Pair == "" && a.Strategy == "" {
+			return fmt.Errorf("pair or strategy is required; use flatten_all to cancel everything")
+		}
+	case FlattenAllAction:
+	case LadderAction:
+		if a.Pair == "" {
+			return fmt.Errorf("pair is required")
+		}
+		if a.Side != "buy" && a.Side != "sell" {
+			return fmt.Errorf("side must be buy or sell")
+		}
+		if err := a.validateSizing(a.Side); err != nil {
+			return err
+		}
+		if a.LowerBand <= 0 || a.UpperBand <= a.LowerBand {
+			return fmt.Errorf("upperBand must be above a positive lowerBand")
+		}
+		if a.Orders < 0 {
+			return fmt.Errorf("orders must not be negative")
+		}
+		if a.Distribution != "" && (!IsValidDistribution(a.Distribution) || a.Distribution == string(CustomDistribution)) {
+			return fmt.Errorf("invalid distribution %q", a.Distribution)
+		}
+		if a.StopPrice > 0 && ((a.Side == "buy" && a.StopPrice >= a.LowerBand) || (a.Side == "sell" && a.StopPrice <= a.UpperBand)) {
+			return fmt.Errorf("stopPrice must be outside the band on the losing side")
+		}
+	default:
+		return fmt.Errorf("unknown action %q", a.Action)
+	}
+
+	if a.TakeProfit != 0 && a.Action != string(BuyAction) && a.Action != string(SellAction) {
+		return fmt.Errorf("takeProfit only applies to buy and sell")
+	}
+
+	if a.Leverage != "" && !IsValidLeverage(a.Leverage) {
+		return fmt.Errorf("invalid leverage: must be none, 2, 3, 4, or 5")
+	}
+	return nil
+}
+
+// validateExits checks that the stop and take-profit of an entry are on the
+// losing and winning side of it
+func (a *TradingViewAlert) validateExits() error {
+	if a.StopPrice < 0 || a.TakeProfit < 0 {
+		return fmt.Errorf("stopPrice and takeProfit must not be negative")
+	}
+
+	// Below the entry for buys, above it for sells
+	below := func(p, ref float64) bool {
+		if a.Action == "sell" {
+			return p > ref
+		}
+		return p < ref
+	}
+
+	if a.Price > 0 {
+		if a.StopPrice > 0 && !below(a.StopPrice, a.Price) {
+			return fmt.Errorf("stopPrice must be on the losing side of the entry")
+		}
+		if a.TakeProfit > 0 && below(a.TakeProfit, a.Price) {
+			return fmt.Errorf("takeProfit must be on the winning side of the entry")
+		}
+	}
+	if a.StopPrice > 0 && a.TakeProfit > 0 && !below(a.StopPrice, a.TakeProfit) {
+		return fmt.Errorf("stopPrice and takeProfit are the wrong way round")
+	}
+	return nil
+}
+
+// execute carries out a queued alert and returns the orders it placed or
+// cancelled. Every order placed gets a cl_ord_id derived from the queue
+// entry (see QueuedAlert.clOrdID), so that a retry of the entry finds the
+// orders it already placed.
+func (q *AlertQueue) execute(ctx context.Context, a *QueuedAlert) ([]OrderResult, error) {
+	alert := &a.Alert
+
+	switch AlertAction(alert.Action) {
+	case CloseAction:
+		return q.closePosition(ctx, a)
+	case ReverseAction:
+		return q.reversePosition(ctx, a)
+	case CancelAction:
+		return q.cancelOrders(ctx, alert)
+	case FlattenAllAction:
+		return q.flattenAll(ctx, a)
+	case LadderAction:
+		return q.placeLadder(ctx, a)
+	}
+
+	volume, err := q.sizeOrder(ctx, alert, alert.Action)
+	if err != nil {
+		return nil, err
+	}
+
+	order := OrderRequest{
+		Pair:     alert.Pair,
+		Type:     OrderType(alert.OrderType),
+		Side:     alert.Action,
+		Volume:   strconv.FormatFloat(volume, 'f', 8, 64),
+		Leverage: alert.Leverage,
+		ClOrdID:  a.clOrdID(""),
+	}
+	if order.Type == LimitOrder {
+		order.Price = strconv.FormatFloat(alert.Price, 'f', 2, 64)
+	}
+
+	// Kraken attaches one conditional close to an order. With both exits the
+	// entry carries the stop and the take-profit is left to a bracket.
+	switch {
+	case alert.StopPrice > 0:
+		order.Close = &ConditionalClose{Type: StopLossOrder, Price: strconv.FormatFloat(alert.StopPrice, 'f', 2, 64)}
+	case alert.TakeProfit > 0:
+		order.Close = &ConditionalClose{Type: TakeProfitOrder, Price: strconv.FormatFloat(alert.TakeProfit, 'f', 2, 64)}
+	}
+
+	placed, err := q.place(ctx, order)
+	if err == nil && alert.StopPrice > 0 && alert.TakeProfit > 0 && len(placed) > 0 {
+		a.Bracket = &Bracket{EntryTxID: placed[0].TxID}
+	}
+	return placed, err
+}
+
+// place adds an order and returns it. An order whose cl_ord_id is already on
+// the exchange, placed by an earlier attempt at the alert whose response was
+// lost, is returned instead of being placed again.
+func (q *AlertQueue) place(ctx context.Context, order OrderRequest) ([]OrderResult, error) {
+	if order.ClOrdID != "" {
+		txid, existing, err := q.client.FindOrder(ctx, order.ClOrdID)
+		if err != nil {
+			return nil, err
+		}
+		if txid != "" {
+			fmt.Printf("Order %s was already placed as %s\n", order.ClOrdID, txid)
+			return []OrderResult{{TxID: txid, Description: existing.Description.Order}}, nil
+		}
+	}
+
+	resp, err := q.client.AddOrder(ctx, order)
+	if err != nil {
+		return nil, err
+	}
+
+	var placed []OrderResult
+	for _, txid := range resp.TransactionIds {
+		placed = append(placed, OrderResult{TxID: txid, Description: resp.Description.Order})
+	}
+	return placed, nil
+}
+
+// closePosition exits the alert's volume of the position in its pair, or
+// all of it without a volume
+func (q *AlertQueue) closePosition(ctx context.Context, a *QueuedAlert) ([]OrderResult, error) {
+	alert := &a.Alert
+	pos, err := q.client.GetPosition(ctx, alert.Pair)
+	if err != nil {
+		return nil, err
+	}
+	if pos.Side() == "" {
+		fmt.Printf("No %s position to close\n", alert.Pair)
+		return nil, nil
+	}
+
+	order, err := q.closingOrder(pos, alert.Volume)
+	if err != nil {
+		return nil, err
+	}
+	order.ClOrdID = a.clOrdID("")
+	return q.place(ctx, order)
+}
+
+// closingOrder returns the order closing volume of pos, or all of it when
+// volume is 0. All of a spot position is the whole balance of the base
+// asset, which is only sold with SetCloseSpotBalance.
+func (q *AlertQueue) closingOrder(pos *Position, volume float64) (OrderRequest, error) {
+	if volume == 0 && !pos.Margin && !q.spotAll {
+		return OrderRequest{}, reject(InvalidAlert, "closing spot %s needs a volume; the whole balance is only sold when enabled on the server", pos.Pair)
+	}
+
+	order := pos.ClosingOrder()
+	if volume > 0 && volume < math.Abs(pos.Volume) {
+		order.Volume = strconv.FormatFloat(volume, 'f', 8, 64)
+	}
+	return order, nil
+}
+
+// reversePosition closes the position and opens one of the alert's volume,
+// or the same size, on the other side. The opening leg is saved on the alert
+// once the position is closed, so that a retry of the alert opens it rather
+// than finding no position to reverse.
+func (q *AlertQueue) reversePosition(ctx context.Context, a *QueuedAlert) ([]OrderResult, error) {
+	alert := &a.Alert
+	if a.Reverse == nil {
+		leg, err := q.closeForReverse(ctx, a)
+		if err != nil {
+			return nil, err
+		}
+		a.Reverse = leg
+		if err := saveState(q.path(a.Seq), a); err != nil {
+			return leg.Closed, fmt.Errorf("closed the position but failed to save the reverse: %w", err)
+		}
+	}
+
+	opened, err := q.place(ctx, OrderRequest{
+		Pair:     alert.Pair,
+		Type:     MarketOrder,
+		Side:     a.Reverse.Side,
+		Volume:   a.Reverse.Volume,
+		Leverage: alert.Leverage,
+		ClOrdID:  a.clOrdID(""),
+	})
+	if err != nil {
+		return a.Reverse.Closed, fmt.Errorf("closed the position but failed to open the reverse: %w", err)
+	}
+	return append(a.Reverse.Closed, opened...), nil
+}
+
+// closeForReverse closes the position of a reverse and returns the leg that
+// opens the other side. A position already closed by an earlier attempt
+// whose outcome was lost is recognised by the closing order's cl_ord_id.
+func (q *AlertQueue) closeForReverse(ctx context.Context, a *QueuedAlert) (*ReverseLeg, error) {
+	alert := &a.Alert
+	closeID := a.clOrdID("close")
+
+	pos, err := q.client.GetPosition(ctx, alert.Pair)
+	if err != nil {
+		return nil, err
+	}
+	if pos.Side() == "" {
+		txid, closed, err := q.client.FindOrder(ctx, closeID)
+		if err != nil {
+			return nil, err
+		}
+		if txid == "" {
+			return nil, reject(RiskRejected, "no %s position to reverse", alert.Pair)
+		}
+
+		// The closing order is on the side the reverse opens
+		leg := &ReverseLeg{
+			Closed: []OrderResult{{TxID: txid, Description: closed.Description.Order}},
+			Side:   closed.Description.Type,
+			Volume: closed.Volume,
+		}
+		if alert.Volume > 0 {
+			leg.Volume = strconv.FormatFloat(alert.Volume, 'f', 8, 64)
+		}
+		return leg, nil
+	}
+
+	leg := &ReverseLeg{
+		Side:   oppositeSide(pos.Side()),
+		Volume: strconv.FormatFloat(math.Abs(pos.Volume), 'f', 8, 64),
+	}
+	if alert.Volume > 0 {
+		leg.Volume = strconv.FormatFloat(alert.Volume, 'f', 8, 64)
+	}
+	if leg.Side == "sell" && (alert.Leverage == "" || alert.Leverage == string(NoLeverage)) {
+		return nil, reject(InvalidAlert, "going short on %s needs leverage", alert.Pair)
+	}
+
+	closing, err := q.closingOrder(pos, 0)
+	if err != nil {
+		return nil, err
+	}
+	closing.ClOrdID = closeID
+	if leg.Closed, err = q.place(ctx, closing); err != nil {
+		return nil, fmt.Errorf("failed to close position: %w", err)
+	}
+	return leg, nil
+}
+
+// cancelOrders cancels the open orders of the alert's pair and/or the orders
+// earlier alerts of its strategy placed, which carry the strategy's tag in
+// their cl_ord_id
+func (q *AlertQueue) cancelOrders(ctx context.Context, alert *TradingViewAlert) ([]OrderResult, error) {
+	open, err := q.client.GetOpenOrders(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var names map[string]bool
+	if alert.Pair != "" {
+		info, err := q.client.GetAssetPair(ctx, alert.Pair)
+		if err != nil {
+			return nil, err
+		}
+		names = map[string]bool{info.Name: true, info.Altname: true, restPair(alert.Pair): true}
+	}
+
+	var tag string
+	if alert.Strategy != "" {
+		tag = strategyTag(alert.Strategy)
+	}
+
+	var txids []string
+	for txid, order := range open {
+		if (names != nil && !names[order.Description.Pair]) || !strings.HasPrefix(order.ClOrdID, tag) {
+			continue
+		}
+		txids = append(txids, txid)
+	}
+	sort.Strings(txids)
+
+	var cancelled []OrderResult
+	for _, txid := range txids {
+		if err := q.client.CancelOrder(ctx, txid); err != nil {
+			return cancelled, err
+		}
+		cancelled = append(cancelled, OrderResult{TxID: txid, Description: open[txid].Description.Order, Cancelled: true})
+	}
+	return cancelled, nil
+}
+
+// flattenAll cancels every open order and closes every margin position.
+// Spot balances are left alone.
+func (q *AlertQueue) flattenAll(ctx context.Context, a *QueuedAlert) ([]OrderResult, error) {
+	count, err := q.client.CancelAllOrders(ctx)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("Cancelled %d open orders\n", count)
+
+	positions, err := q.client.OpenMarginPositions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var placed []OrderResult
+	for _, pos := range positions {
+		if pos.Side() == "" {
+			continue
+		}
+		order := pos.ClosingOrder()
+		order.ClOrdID = a.clOrdID(pos.Pair)
+		closed, err := q.place(ctx, order)
+		if err != nil {
+			return placed, fmt.Errorf("failed to close %s position: %w", pos.Pair, err)
+		}
+		placed = append(placed, closed...)
+	}
+	return placed, nil
+}
+
+// placeLadder places a ladder of limit orders across the alert's band. Each
+// rung has its own cl_ord_id, so a retry only places the missing rungs.
+func (q *AlertQueue) placeLadder(ctx context.Context, a *QueuedAlert) ([]OrderResult, error) {
+	alert := &a.Alert
+	volume, err := q.sizeOrder(ctx, alert, alert.Side)
+	if err != nil {
+		return nil, err
+	}
+
+	config := TrailingEntryConfig{
+		Pair:         alert.Pair,
+		Side:         alert.Side,
+		UpperBand:    alert.UpperBand,
+		LowerBand:    alert.LowerBand,
+		StopLoss:     alert.StopPrice,
+		TotalVolume:  volume,
+		NumOrders:    alert.Orders,
+		Distribution: VolumeDistribution(alert.Distribution),
+		Leverage:     alert.Leverage,
+		Spacing:      LinearSpacing,
+	}
+	if config.NumOrders == 0 {
+		config.NumOrders = 5
+	}
+	for i := 0; i < config.NumOrders; i++ {
+		config.ClOrdIDs = append(config.ClOrdIDs, a.clOrdID(fmt.Sprintf("rung-%d", i)))
+	}
+	if config.Distribution == "" {
+		config.Distribution = EvenDistribution
+	}
+
+	result, err := q.client.PlaceLadder(ctx, config)
+	if result == nil {
+		return nil, err
+	}
+
+	var placed []OrderResult
+	for _, rung := range result.Placed() {
+		placed = append(placed, OrderResult{
+			TxID:        rung.TxID,
+			Description: fmt.Sprintf("%s %.8f %s @ limit %.2f", alert.Side, rung.Volume, alert.Pair, rung.Price),
+		})
+	}
+	return placed, err
+}
@@ -0,0 +1,324 @@
+package kraken
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTradingViewAlert_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		alert   TradingViewAlert
+		wantErr bool
+	}{
+		{"market buy", TradingViewAlert{Action: "buy", Pair: "XBTUSD", Volume: 1, OrderType: "market"}, false},
+		{"limit without price", TradingViewAlert{Action: "sell", Pair: "XBTUSD", Volume: 1, OrderType: "limit"}, true},
+		{"buy without volume", TradingViewAlert{Action: "buy", Pair: "XBTUSD", OrderType: "market"}, true},
+		{"close", TradingViewAlert{Action: "close", Pair: "XBTUSD"}, false},
+		{"close without pair", TradingViewAlert{Action: "close"}, true},
+		{"cancel by strategy", TradingViewAlert{Action: "cancel", Strategy: "s1"}, false},
+		{"cancel everything", TradingViewAlert{Action: "cancel"}, true},
+		{"flatten", TradingViewAlert{Action: "flatten_all"}, false},
+		{"ladder", TradingViewAlert{Action: "ladder", Pair: "XBTUSD", Side: "buy", Volume: 1, LowerBand: 900, UpperBand: 1000}, false},
+		{"ladder without side", TradingViewAlert{Action: "ladder", Pair: "XBTUSD", Volume: 1, LowerBand: 900, UpperBand: 1000}, true},
+		{"ladder inverted band", TradingViewAlert{Action: "ladder", Pair: "XBTUSD", Side: "buy", Volume: 1, LowerBand: 1000, UpperBand: 900}, true},
+		{"ladder custom weights", TradingViewAlert{Action: "ladder", Pair: "XBTUSD", Side: "buy", Volume: 1, LowerBand: 900, UpperBand: 1000, Distribution: "custom"}, true},
+		{"bad leverage", TradingViewAlert{Action: "close", Pair: "XBTUSD", Leverage: "50"}, true},
+		{"unknown action", TradingViewAlert{Action: "hodl", Pair: "XBTUSD"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.alert.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func newTestActionQueue(t *testing.T) (*AlertQueue, *mockTradingAPI) {
+	t.Helper()
+	api := newMockTradingAPI()
+	t.Cleanup(api.Close)
+
+	queue, err := NewAlertQueue(NewTestClient(t, &TestConfig{DemoAPIURL: api.URL}), t.TempDir(), 1)
+	if err != nil {
+		t.Fatalf("NewAlertQueue() error = %v", err)
+	}
+	return queue, api
+}
+
+func TestAlertQueue_Close(t *testing.T) {
+	t.Run("spot", func(t *testing.T) {
+		queue, api := newTestActionQueue(t)
+		api.balances["XXBT"] = "0.5"
+		ctx := context.Background()
+
+		// The whole balance is only sold once enabled
+		_, err := queue.execute(ctx, &QueuedAlert{ID: "a", Alert: TradingViewAlert{Action: "close", Pair: "XBTUSD"}})
+		var rejected *rejection
+		if !errors.As(err, &rejected) || rejected.code != InvalidAlert || len(api.placed) != 0 {
+			t.Fatalf("execute() error = %v, placed %d; want an invalid_alert rejection", err, len(api.placed))
+		}
+
+		// A volume closes part of the balance
+		if _, err := queue.execute(ctx, &QueuedAlert{ID: "b", Alert: TradingViewAlert{Action: "close", Pair: "XBTUSD", Volume: 0.2}}); err != nil {
+			t.Fatalf("execute() error = %v", err)
+		}
+		if order := api.placed[0]; order.Get("type") != "sell" || order.Get("volume") != "0.20000000" {
+			t.Errorf("close order = %v, want spot sell of 0.2", order)
+		}
+
+		queue.SetCloseSpotBalance(true)
+		txids, err := queue.execute(ctx, &QueuedAlert{ID: "c", Alert: TradingViewAlert{Action: "close", Pair: "XBTUSD"}})
+		if err != nil || len(txids) != 1 {
+			t.Fatalf("execute() = %v, %v", txids, err)
+		}
+		order := api.placed[1]
+		if order.Get("type") != "sell" || order.Get("volume") != "0.50000000" || order.Get("reduce_only") != "" {
+			t.Errorf("close order = %v, want spot sell of 0.5", order)
+		}
+	})
+
+	t.Run("partial margin", func(t *testing.T) {
+		queue, api := newTestActionQueue(t)
+		api.positions["P1"] = PositionInfo{Pair: "XXBTZUSD", Type: "buy", Volume: "2", Cost: "3000", Margin: "1500"}
+
+		if _, err := queue.execute(context.Background(), &QueuedAlert{ID: "a", Alert: TradingViewAlert{Action: "close", Pair: "XBTUSD", Volume: 0.5}}); err != nil {
+			t.Fatalf("execute() error = %v", err)
+		}
+		order := api.placed[0]
+		if order.Get("type") != "sell" || order.Get("volume") != "0.50000000" || order.Get("reduce_only") != "true" {
+			t.Errorf("close order = %v, want reduce-only sell of 0.5", order)
+		}
+	})
+
+	t.Run("margin short", func(t *testing.T) {
+		queue, api := newTestActionQueue(t)
+		api.balances["XXBT"] = "3"
+		api.positions["P1"] = PositionInfo{Pair: "XXBTZUSD", Type: "sell", Volume: "2", VolClosed: "0.5", Cost: "3000", Margin: "1000"}
+
+		if _, err := queue.execute(context.Background(), &QueuedAlert{ID: "a", Alert: TradingViewAlert{Action: "close", Pair: "XBTUSD"}}); err != nil {
+			t.Fatalf("execute() error = %v", err)
+		}
+		order := api.placed[0]
+		if order.Get("type") != "buy" || order.Get("volume") != "1.50000000" ||
+			order.Get("leverage") != "3" || order.Get("reduce_only") != "true" || order.Get("cl_ord_id") == "" {
+			t.Errorf("close order = %v, want reduce-only buy of 1.5 at 3x", order)
+		}
+	})
+
+	t.Run("flat", func(t *testing.T) {
+		queue, api := newTestActionQueue(t)
+
+		txids, err := queue.execute(context.Background(), &QueuedAlert{ID: "a", Alert: TradingViewAlert{Action: "close", Pair: "XBTUSD"}})
+		if err != nil || len(txids) != 0 || len(api.placed) != 0 {
+			t.Errorf("execute() = %v, %v, placed %d; want nothing to do", txids, err, len(api.placed))
+		}
+	})
+}
+
+func TestAlertQueue_Reverse(t *testing.T) {
+	queue, api := newTestActionQueue(t)
+	queue.SetCloseSpotBalance(true)
+	api.balances["XXBT"] = "1"
+	ctx := context.Background()
+
+	// A spot long cannot become a short without leverage
+	if _, err := queue.execute(ctx, &QueuedAlert{ID: "a", Alert: TradingViewAlert{Action: "reverse", Pair: "XBTUSD"}}); err == nil {
+		t.Error("reverse of a spot long without leverage should fail")
+	}
+	if len(api.placed) != 0 {
+		t.Fatalf("placed %d orders before failing", len(api.placed))
+	}
+
+	txids, err := queue.execute(ctx, &QueuedAlert{ID: "b", Alert: TradingViewAlert{Action: "reverse", Pair: "XBTUSD", Volume: 2, Leverage: "2"}})
+	if err != nil || len(txids) != 2 {
+		t.Fatalf("execute() = %v, %v", txids, err)
+	}
+	closing, open := api.placed[0], api.placed[1]
+	if closing.Get("type") != "sell" || closing.Get("volume") != "1.00000000" {
+		t.Errorf("closing order = %v", closing)
+	}
+	if open.Get("type") != "sell" || open.Get("volume") != "2.00000000" || open.Get("leverage") != "2" {
+		t.Errorf("reverse order = %v", open)
+	}
+	if closing.Get("cl_ord_id") == open.Get("cl_ord_id") {
+		t.Error("both orders of a reverse share a cl_ord_id")
+	}
+}
+
+func TestAlertQueue_ReverseResumes(t *testing.T) {
+	long := PositionInfo{Pair: "XXBTZUSD", Type: "buy", Volume: "1.5", Cost: "1500", Margin: "500"}
+	reverse := TradingViewAlert{Action: "reverse", Pair: "XBTUSD", Leverage: "3"}
+
+	t.Run("after a failed open", func(t *testing.T) {
+		queue, api := newTestActionQueue(t)
+		api.positions["P1"] = long
+		api.reject[2] = true
+		ctx := context.Background()
+
+		a := &QueuedAlert{ID: "a", Alert: reverse}
+		if _, err := queue.execute(ctx, a); err == nil {
+			t.Fatal("execute() should fail to open the reverse")
+		}
+		if a.Reverse == nil || len(a.Reverse.Closed) != 1 {
+			t.Fatalf("reverse leg = %+v, want the close recorded", a.Reverse)
+		}
+
+		// The saved entry is retried once the position is flat
+		var saved QueuedAlert
+		if _, err := loadState(queue.path(a.Seq), &saved); err != nil || saved.Reverse == nil {
+			t.Fatalf("saved alert = %+v, %v", saved, err)
+		}
+		delete(api.positions, "P1")
+
+		orders, err := queue.execute(ctx, &saved)
+		if err != nil || len(orders) != 2 || orders[0].TxID != "TX-1" || orders[1].TxID != "TX-2" {
+			t.Fatalf("retry = %v, %v, want the close and the reverse", orders, err)
+		}
+		if len(api.placed) != 2 {
+			t.Fatalf("placed %d orders, want the close and one reverse", len(api.placed))
+		}
+		if open := api.placed[1]; open.Get("type") != "sell" || open.Get("volume") != "1.50000000" {
+			t.Errorf("reverse order = %v", open)
+		}
+	})
+
+	t.Run("after a lost close", func(t *testing.T) {
+		queue, api := newTestActionQueue(t)
+		api.positions["P1"] = long
+		api.lost[1] = true
+		ctx := context.Background()
+
+		a := &QueuedAlert{ID: "a", Alert: reverse}
+		if _, err := queue.execute(ctx, a); err == nil {
+			t.Fatal("execute() should fail when the close response is lost")
+		}
+		delete(api.positions, "P1")
+
+		// The close is found by its cl_ord_id and the reverse is opened
+		orders, err := queue.execute(ctx, a)
+		if err != nil || len(orders) != 2 || orders[0].TxID != "TX-1" {
+			t.Fatalf("retry = %v, %v, want the close and the reverse", orders, err)
+		}
+		if open := api.placed[1]; open.Get("type") != "sell" || open.Get("volume") != "1.50000000" {
+			t.Errorf("reverse order = %v", open)
+		}
+	})
+}
+
+func TestAlertQueue_Cancel(t *testing.T) {
+	queue, api := newTestActionQueue(t)
+	ctx := context.Background()
+
+	for _, strategy := range []string{"s1", "s2"} {
+		a, err := queue.Enqueue(strategy, TradingViewAlert{
+			Strategy: strategy, Action: "buy", Pair: "XBTUSD", Volume: 1, OrderType: "limit", Price: 900,
+		})
+		if err != nil {
+			t.Fatalf("Enqueue() error = %v", err)
+		}
+		queue.process(ctx, queue.lanes[0].pop())
+		if a.Status != AlertDone {
+			t.Fatalf("alert %s = %+v", strategy, a)
+		}
+	}
+	api.placed = append(api.placed, map[string][]string{"pair": {"ETHUSD"}})
+
+	// Orders are found on the exchange, not in the queue files
+	entries, _ := os.ReadDir(queue.dir)
+	for _, e := range entries {
+		os.Remove(filepath.Join(queue.dir, e.Name()))
+	}
+
+	cancelled, err := queue.execute(ctx, &QueuedAlert{ID: "c", Alert: TradingViewAlert{Action: "cancel", Strategy: "s1"}})
+	if err != nil || len(cancelled) != 1 || cancelled[0].TxID != "TX-1" || !cancelled[0].Cancelled {
+		t.Errorf("cancel by strategy = %v, %v, want TX-1", cancelled, err)
+	}
+
+	cancelled, err = queue.execute(ctx, &QueuedAlert{ID: "d", Alert: TradingViewAlert{Action: "cancel", Pair: "XBT/USD"}})
+	if err != nil || len(cancelled) != 1 || cancelled[0].TxID != "TX-2" || !cancelled[0].Cancelled {
+		t.Errorf("cancel by pair = %v, %v, want TX-2", cancelled, err)
+	}
+}
+
+func TestAlertQueue_FlattenAll(t *testing.T) {
+	queue, api := newTestActionQueue(t)
+	api.balances["XXBT"] = "5"
+	api.positions["P1"] = PositionInfo{Pair: "XXBTZUSD", Type: "buy", Volume: "1", Cost: "1000", Margin: "500"}
+	api.positions["P2"] = PositionInfo{Pair: "XETHZUSD", Type: "sell", Volume: "3", Cost: "900", Margin: "300"}
+	api.placed = append(api.placed, map[string][]string{"pair": {"XBTUSD"}})
+
+	txids, err := queue.execute(context.Background(), &QueuedAlert{ID: "a", Alert: TradingViewAlert{Action: "flatten_all"}})
+	if err != nil || len(txids) != 2 {
+		t.Fatalf("execute() = %v, %v", txids, err)
+	}
+	if len(api.cancelled) != 1 || api.cancelled[0] != "TX-1" {
+		t.Errorf("cancelled = %v, want the open order", api.cancelled)
+	}
+
+	eth, xbt := api.placed[1], api.placed[2]
+	if eth.Get("pair") != "XETHZUSD" || eth.Get("type") != "buy" || eth.Get("volume") != "3.00000000" || eth.Get("leverage") != "3" {
+		t.Errorf("ETH close = %v", eth)
+	}
+	if xbt.Get("pair") != "XXBTZUSD" || xbt.Get("type") != "sell" || xbt.Get("volume") != "1.00000000" || xbt.Get("reduce_only") != "true" {
+		t.Errorf("XBT close = %v", xbt)
+	}
+}
+
+func TestAlertQueue_Ladder(t *testing.T) {
+	queue, api := newTestActionQueue(t)
+
+	a := &QueuedAlert{ID: "a", Seq: 1, ReceivedAt: time.Now(), Alert: TradingViewAlert{
+		Action: "ladder", Pair: "XBTUSD", Side: "buy", Volume: 3, LowerBand: 900, UpperBand: 1100, Orders: 3,
+	}}
+	txids, err := queue.execute(context.Background(), a)
+	if err != nil || len(txids) != 3 {
+		t.Fatalf("execute() = %v, %v", txids, err)
+	}
+
+	if got := strings.Join(api.prices(), ","); got != "1100.00,1000.00,900.00" {
+		t.Errorf("ladder prices = %s", got)
+	}
+	ids := map[string]bool{}
+	for _, p := range api.placed {
+		ids[p.Get("cl_ord_id")] = true
+	}
+	if len(ids) != 3 || ids[""] {
+		t.Errorf("rung cl_ord_ids = %v, want one per rung", ids)
+	}
+
+	// A retry of the entry, e.g. after a crash mid-ladder, finds its rungs
+	txids, err = queue.execute(context.Background(), a)
+	if err != nil || len(txids) != 3 || len(api.placed) != 3 {
+		t.Errorf("retry = %v, %v, placed %d; want the same 3 rungs", txids, err, len(api.placed))
+	}
+}
+
+func TestAlertQueue_RepeatedAlertIDs(t *testing.T) {
+	queue, api := newTestActionQueue(t)
+	ctx := context.Background()
+
+	// Without dedupe, identical alerts share an ID but are separate entries
+	alert := TradingViewAlert{Action: "buy", Pair: "XBTUSD", Volume: 1, OrderType: "market"}
+	for i := 0; i < 2; i++ {
+		a, err := queue.Enqueue(AlertID(&alert), alert)
+		if err != nil {
+			t.Fatalf("Enqueue() error = %v", err)
+		}
+		queue.process(ctx, queue.lanes[0].pop())
+		if a.Status != AlertDone {
+			t.Fatalf("alert %d = %+v", i, a)
+		}
+	}
+
+	if len(api.placed) != 2 || api.placed[0].Get("cl_ord_id") == api.placed[1].Get("cl_ord_id") {
+		t.Errorf("placed %d orders; the repeat should trade under its own cl_ord_id", len(api.placed))
+	}
+}
@@ -0,0 +1,387 @@
+package kraken
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"time"
+)
+
+type ExecAlgo string
+
+const (
+	TWAP ExecAlgo = "twap" // Equal slices spread evenly over the duration
+	VWAP ExecAlgo = "vwap" // Slices weighted by the historical intraday volume profile
+)
+
+// vwapProfileInterval is the candle length in minutes the VWAP volume
+// profile is built from; Kraken's 720 candle limit covers 7.5 days
+const vwapProfileInterval = 15
+
+// AlgoOrderConfig slices a parent order into child orders over Duration
+type AlgoOrderConfig struct {
+	Pair       string
+	Side       string
+	Volume     float64
+	Algo       ExecAlgo
+	Duration   time.Duration
+	Slices     int
+	Randomize  float64   // 0-1, how much slice timing and size vary
+	ChildType  OrderType // MarketOrder, or LimitOrder at the touch
+	LimitPrice float64   // Never buy above or sell below this; 0 for no limit
+	Leverage   string
+}
+
+// AlgoSlice is the outcome of one child order
+type AlgoSlice struct {
+	Time        time.Time
+	Target      float64 // Volume the slice tried to execute
+	MarketPrice float64 // Last trade when the slice was due
+	TxID        string
+	Filled      float64
+	AvgPrice    float64
+	Skipped     string // Why no order was sent
+}
+
+// AlgoReport compares the achieved price with the arrival price and the
+// algo's benchmark: the time-weighted average price for TWAP and the
+// market's volume-weighted average price over the run for VWAP
+type AlgoReport struct {
+	Algo         ExecAlgo
+	Pair         string
+	Side         string
+	Volume       float64
+	Filled       float64
+	AvgPrice     float64
+	ArrivalPrice float64
+	Benchmark    float64
+	Slices       []AlgoSlice
+	Start        time.Time
+	End          time.Time
+}
+
+// SlippageBps is how much worse than the benchmark the order executed, in
+// basis points; negative means better
+func (r *AlgoReport) SlippageBps() float64 {
+	if r.Benchmark == 0 || r.AvgPrice == 0 {
+		return 0
+	}
+	slip := (r.AvgPrice - r.Benchmark) / r.Benchmark * 10000
+	if r.Side == "sell" {
+		slip = -slip
+	}
+	return slip
+}
+
+func (c *AlgoOrderConfig) Validate() error {
+	if c.Pair == "" {
+		return fmt.Errorf("pair is required")
+	}
+	if c.Side != "buy" && c.Side != "sell" {
+		return fmt.Errorf("invalid side: must be buy or sell")
+	}
+	if c.Volume <= 0 {
+		return fmt.Errorf("volume must be positive")
+	}
+	if c.Algo != TWAP && c.Algo != VWAP {
+		return fmt.Errorf("invalid algo: must be twap or vwap")
+	}
+	if c.Duration <= 0 {
+		return fmt.Errorf("duration must be positive")
+	}
+	if c.Slices < 1 {
+		return fmt.Errorf("at least one slice is required")
+	}
+	if c.Randomize < 0 || c.Randomize > 1 {
+		return fmt.Errorf("randomize must be between 0 and 1")
+	}
+	if c.ChildType != MarketOrder && c.ChildType != LimitOrder {
+		return fmt.Errorf("child orders must be market or limit")
+	}
+	return nil
+}
+
+// volumeProfile weights n slices of sliceLen starting at start by the average
+// volume historically traded at the same time of day. Without history every
+// slice weighs the same.
+func volumeProfile(candles []Candle, start time.Time, sliceLen time.Duration, n int) []float64 {
+	const day = 24 * time.Hour
+	offset := func(t time.Time) time.Duration {
+		return t.UTC().Sub(t.UTC().Truncate(day))
+	}
+
+	weights := make([]float64, n)
+	total := 0.0
+	for i := range weights {
+		from := offset(start.Add(time.Duration(i) * sliceLen))
+		to := from + sliceLen
+
+		sum, count := 0.0, 0
+		for _, candle := range candles {
+			o := offset(candle.Time)
+			// The slice may wrap past midnight
+			if (o >= from && o < to) || (to > day && o < to-day) {
+				sum += candle.Volume
+				count++
+			}
+		}
+		if count > 0 {
+			weights[i] = sum / float64(count)
+		}
+		total += weights[i]
+	}
+
+	for i := range weights {
+		if total == 0 {
+			weights[i] = 1 / float64(n)
+		} else {
+			weights[i] /= total
+		}
+	}
+	return weights
+}
+
+// jitter returns v scaled by a random factor within ±amount
+func jitter(v, amount float64) float64 {
+	return v * (1 + amount*(2*rand.Float64()-1))
+}
+
+// ExecuteAlgoOrder works a parent order with TWAP or VWAP slicing. Volume a
+// slice cannot execute, because of the price limit or a limit child left
+// unfilled, is carried into the next slice. It stops early when ctx is done
+// and reports what was executed so far.
+func (c *Client) ExecuteAlgoOrder(ctx context.Context, config AlgoOrderConfig) (*AlgoReport, error) {
+	if config.ChildType == "" {
+		config.ChildType = MarketOrder
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid algo order: %w", err)
+	}
+
+	report := &AlgoReport{
+		Algo:   config.Algo,
+		Pair:   config.Pair,
+		Side:   config.Side,
+		Volume: config.Volume,
+		Start:  time.Now(),
+	}
+
+	arrival, err := c.GetTickerPrice(ctx, config.Pair)
+	if err != nil {
+		return nil, err
+	}
+	report.ArrivalPrice = arrival.Last
+
+	sliceLen := config.Duration / time.Duration(config.Slices)
+	weights := make([]float64, config.Slices)
+	for i := range weights {
+		weights[i] = 1 / float64(config.Slices)
+	}
+	if config.Algo == VWAP {
+		candles, err := c.GetOHLC(ctx, config.Pair, vwapProfileInterval)
+		if err != nil {
+			return nil, err
+		}
+		weights = volumeProfile(candles, report.Start, sliceLen, config.Slices)
+	}
+
+	fmt.Printf("Executing %s %s %v %s in %d slices over %v\n",
+		config.Algo, config.Side, config.Volume, config.Pair, config.Slices, config.Duration)
+
+	// A child whose fill is unknown, or that may still rest, stops the algo:
+	// sending its volume again could execute more than the parent
+	var settleErr error
+	settle := func(slice *AlgoSlice) bool {
+		if settleErr = c.settleSlice(context.WithoutCancel(ctx), slice); settleErr != nil {
+			return false
+		}
+		report.Filled += slice.Filled
+		return true
+	}
+
+	var pending *AlgoSlice
+	for i := 0; i < config.Slices; i++ {
+		due := report.Start.Add(time.Duration(i) * sliceLen)
+		if i > 0 {
+			due = due.Add(time.Duration(jitter(float64(sliceLen), config.Randomize/2)) - sliceLen)
+		}
+
+		timer := time.NewTimer(time.Until(due))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+		case <-timer.C:
+		}
+
+		if pending != nil {
+			ok := settle(pending)
+			pending = nil
+			if !ok {
+				break
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		remaining := config.Volume - report.Filled
+		target := remaining
+		if i < config.Slices-1 {
+			// Spread what is left over the remaining slices by their weights
+			rest := 0.0
+			for _, w := range weights[i:] {
+				rest += w
+			}
+			target = math.Min(remaining, jitter(remaining*weights[i]/rest, config.Randomize))
+		}
+
+		slice := c.executeSlice(ctx, config, target)
+		report.Slices = append(report.Slices, slice)
+		if slice.TxID == "" {
+			continue
+		}
+
+		// A limit child rests until the next slice; a market child has
+		// already executed
+		pending = &report.Slices[len(report.Slices)-1]
+		if config.ChildType == MarketOrder {
+			ok := settle(pending)
+			pending = nil
+			if !ok {
+				break
+			}
+		}
+	}
+
+	if pending != nil {
+		// Give the last child the rest of its slice to fill
+		timer := time.NewTimer(time.Until(report.Start.Add(config.Duration)))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+		case <-timer.C:
+		}
+		settle(pending)
+	}
+
+	report.End = time.Now()
+	c.finishReport(context.WithoutCancel(ctx), report)
+	if settleErr != nil {
+		return report, fmt.Errorf("stopped %s: %w", config.Algo, settleErr)
+	}
+	return report, ctx.Err()
+}
+
+// executeSlice sends one child order unless the market is beyond the limit
+func (c *Client) executeSlice(ctx context.Context, config AlgoOrderConfig, target float64) AlgoSlice {
+	slice := AlgoSlice{Time: time.Now(), Target: target}
+	if target < minRemainingVolume {
+		slice.Skipped = "nothing left to execute"
+		return slice
+	}
+
+	ticker, err := c.GetTickerPrice(ctx, config.Pair)
+	if err != nil {
+		slice.Skipped = err.Error()
+		return slice
+	}
+	slice.MarketPrice = ticker.Last
+
+	touch := ticker.Ask
+	if config.Side == "sell" {
+		touch = ticker.Bid
+	}
+	if config.LimitPrice > 0 && ((config.Side == "buy" && touch > config.LimitPrice) ||
+		(config.Side == "sell" && touch < config.LimitPrice)) {
+		slice.Skipped = fmt.Sprintf("price %.2f is beyond the limit %.2f", touch, config.LimitPrice)
+		return slice
+	}
+
+	req := OrderRequest{
+		Pair:     config.Pair,
+		Type:     config.ChildType,
+		Side:     config.Side,
+		Volume:   strconv.FormatFloat(target, 'f', 8, 64),
+		Leverage: config.Leverage,
+	}
+	if config.ChildType == LimitOrder {
+		req.Price = strconv.FormatFloat(touch, 'f', 2, 64)
+	}
+
+	resp, err := c.AddOrder(ctx, req)
+	if err != nil {
+		slice.Skipped = err.Error()
+		return slice
+	}
+	if len(resp.TransactionIds) > 0 {
+		slice.TxID = resp.TransactionIds[0]
+	}
+	return slice
+}
+
+// settleSlice cancels what is left of a child order and records its fill.
+// It fails when the fill is unknown or the order may still be resting.
+func (c *Client) settleSlice(ctx context.Context, slice *AlgoSlice) error {
+	orders, err := c.QueryOrders(ctx, slice.TxID)
+	if err != nil {
+		return fmt.Errorf("failed to settle child order %s: %w", slice.TxID, err)
+	}
+	if status := orders[slice.TxID].Status; status == "open" || status == "pending" {
+		if err := c.CancelOrder(ctx, slice.TxID); err != nil {
+			// It may have filled in the meantime; the query tells
+			fmt.Printf("%v\n", err)
+		}
+		if orders, err = c.QueryOrders(ctx, slice.TxID); err != nil {
+			return fmt.Errorf("failed to settle child order %s: %w", slice.TxID, err)
+		}
+		if status := orders[slice.TxID].Status; status == "open" || status == "pending" {
+			return fmt.Errorf("child order %s could not be cancelled", slice.TxID)
+		}
+	}
+
+	info := orders[slice.TxID]
+	slice.Filled, _ = strconv.ParseFloat(info.VolumeExec, 64)
+	slice.AvgPrice, _ = strconv.ParseFloat(info.AvgPrice, 64)
+	return nil
+}
+
+// finishReport works out the achieved average price and the benchmark
+func (c *Client) finishReport(ctx context.Context, report *AlgoReport) {
+	cost, sampled, samples := 0.0, 0.0, 0
+	for _, s := range report.Slices {
+		cost += s.Filled * s.AvgPrice
+		if s.MarketPrice > 0 {
+			sampled += s.MarketPrice
+			samples++
+		}
+	}
+	if report.Filled > 0 {
+		report.AvgPrice = cost / report.Filled
+	}
+	if samples > 0 {
+		report.Benchmark = sampled / float64(samples)
+	}
+
+	if report.Algo != VWAP {
+		return
+	}
+
+	candles, err := c.GetOHLC(ctx, report.Pair, 1)
+	if err != nil {
+		fmt.Printf("failed to get market VWAP, benchmarking against TWAP: %v\n", err)
+		return
+	}
+
+	value, volume := 0.0, 0.0
+	for _, candle := range candles {
+		if candle.Time.Add(time.Minute).After(report.Start) && !candle.Time.After(report.End) {
+			value += candle.VWAP * candle.Volume
+			volume += candle.Volume
+		}
+	}
+	if volume > 0 {
+		report.Benchmark = value / volume
+	}
+}
@@ -0,0 +1,165 @@
+package kraken
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestVolumeProfile(t *testing.T) {
+	day := time.Date(2024, 5, 20, 0, 0, 0, 0, time.UTC)
+	var candles []Candle
+	for d := 0; d < 3; d++ {
+		base := day.AddDate(0, 0, -d)
+		candles = append(candles,
+			Candle{Time: base.Add(9 * time.Hour), Volume: 30},
+			Candle{Time: base.Add(10 * time.Hour), Volume: 10},
+			Candle{Time: base.Add(23*time.Hour + 30*time.Minute), Volume: 20},
+			Candle{Time: base.Add(5 * time.Minute), Volume: 40},
+			Candle{Time: base.Add(30 * time.Minute), Volume: 90},
+		)
+	}
+
+	weights := volumeProfile(candles, day.Add(9*time.Hour), time.Hour, 2)
+	if math.Abs(weights[0]-0.75) > 1e-9 || math.Abs(weights[1]-0.25) > 1e-9 {
+		t.Errorf("weights = %v, want [0.75 0.25]", weights)
+	}
+
+	// A slice running past midnight picks up the early candles of the day
+	weights = volumeProfile(candles, day.Add(23*time.Hour+15*time.Minute), time.Hour, 2)
+	if math.Abs(weights[0]-0.25) > 1e-9 || math.Abs(weights[1]-0.75) > 1e-9 {
+		t.Errorf("weights = %v, want [0.25 0.75]", weights)
+	}
+
+	weights = volumeProfile(nil, day, time.Hour, 4)
+	for _, w := range weights {
+		if w != 0.25 {
+			t.Fatalf("weights without history = %v, want even", weights)
+		}
+	}
+}
+
+func TestAlgoReport_SlippageBps(t *testing.T) {
+	buy := AlgoReport{Side: "buy", AvgPrice: 101, Benchmark: 100}
+	sell := AlgoReport{Side: "sell", AvgPrice: 101, Benchmark: 100}
+	if math.Abs(buy.SlippageBps()-100) > 1e-9 || math.Abs(sell.SlippageBps()+100) > 1e-9 {
+		t.Errorf("slippage = %v buy, %v sell, want 100 and -100", buy.SlippageBps(), sell.SlippageBps())
+	}
+}
+
+func TestExecuteAlgoOrder_TWAP(t *testing.T) {
+	api := newMockTradingAPI()
+	defer api.Close()
+	api.ticker = 100
+
+	// The second child is left unfilled; its volume moves to the later slices
+	api.filled["TX-1"] = true
+	api.filled["TX-3"] = true
+	api.filled["TX-4"] = true
+
+	client := NewTestClient(t, &TestConfig{DemoAPIURL: api.URL})
+	report, err := client.ExecuteAlgoOrder(context.Background(), AlgoOrderConfig{
+		Pair:      "XBT/USD",
+		Side:      "buy",
+		Volume:    4,
+		Algo:      TWAP,
+		Duration:  200 * time.Millisecond,
+		Slices:    4,
+		ChildType: LimitOrder,
+	})
+	if err != nil {
+		t.Fatalf("ExecuteAlgoOrder() error = %v", err)
+	}
+
+	wantTargets := []float64{1, 1, 1.5, 1.5}
+	if len(report.Slices) != 4 {
+		t.Fatalf("got %d slices, want 4", len(report.Slices))
+	}
+	for i, s := range report.Slices {
+		if math.Abs(s.Target-wantTargets[i]) > 1e-9 {
+			t.Errorf("slice %d target = %v, want %v", i, s.Target, wantTargets[i])
+		}
+	}
+
+	if len(api.cancelled) != 1 || api.cancelled[0] != "TX-2" {
+		t.Errorf("cancelled = %v, want the unfilled TX-2", api.cancelled)
+	}
+	if report.Filled != 4 || report.AvgPrice != 100 || report.Benchmark != 100 || report.ArrivalPrice != 100 {
+		t.Errorf("report = %+v", report)
+	}
+}
+
+func TestExecuteAlgoOrder_StopsOnUnsettledChild(t *testing.T) {
+	api := newMockTradingAPI()
+	defer api.Close()
+	api.ticker = 100
+	api.stuck = true
+
+	client := NewTestClient(t, &TestConfig{DemoAPIURL: api.URL})
+	report, err := client.ExecuteAlgoOrder(context.Background(), AlgoOrderConfig{
+		Pair:      "XBT/USD",
+		Side:      "buy",
+		Volume:    4,
+		Algo:      TWAP,
+		Duration:  100 * time.Millisecond,
+		Slices:    4,
+		ChildType: LimitOrder,
+	})
+	if err == nil {
+		t.Fatal("ExecuteAlgoOrder() should fail while a child may still rest")
+	}
+	if len(api.placed) != 1 || report.Filled != 0 {
+		t.Errorf("placed %d orders, filled %v, want the algo stopped after the first", len(api.placed), report.Filled)
+	}
+}
+
+func TestExecuteAlgoOrder_PriceLimit(t *testing.T) {
+	api := newMockTradingAPI()
+	defer api.Close()
+	api.ticker = 100
+
+	client := NewTestClient(t, &TestConfig{DemoAPIURL: api.URL})
+	report, err := client.ExecuteAlgoOrder(context.Background(), AlgoOrderConfig{
+		Pair:       "XBT/USD",
+		Side:       "buy",
+		Volume:     2,
+		Algo:       TWAP,
+		Duration:   20 * time.Millisecond,
+		Slices:     2,
+		LimitPrice: 99,
+	})
+	if err != nil {
+		t.Fatalf("ExecuteAlgoOrder() error = %v", err)
+	}
+
+	if len(api.placed) != 0 || report.Filled != 0 {
+		t.Errorf("placed %d orders above the limit", len(api.placed))
+	}
+	for _, s := range report.Slices {
+		if s.Skipped == "" {
+			t.Errorf("slice %+v should be skipped", s)
+		}
+	}
+}
+
+func TestAlgoOrderConfig_Validate(t *testing.T) {
+	valid := AlgoOrderConfig{Pair: "XBT/USD", Side: "buy", Volume: 1, Algo: VWAP, Duration: time.Hour, Slices: 6, ChildType: MarketOrder}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	for name, modify := range map[string]func(*AlgoOrderConfig){
+		"algo":       func(c *AlgoOrderConfig) { c.Algo = "pov" },
+		"duration":   func(c *AlgoOrderConfig) { c.Duration = 0 },
+		"slices":     func(c *AlgoOrderConfig) { c.Slices = 0 },
+		"randomize":  func(c *AlgoOrderConfig) { c.Randomize = 1.5 },
+		"child type": func(c *AlgoOrderConfig) { c.ChildType = StopLossOrder },
+	} {
+		config := valid
+		modify(&config)
+		if err := config.Validate(); err == nil {
+			t.Errorf("Validate() should reject an invalid %s", name)
+		}
+	}
+}
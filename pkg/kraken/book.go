@@ -0,0 +1,120 @@
+package kraken
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+)
+
+// BookTop is the best bid and ask of an order book
+type BookTop struct {
+	Bid    float64
+	BidQty float64
+	Ask    float64
+	AskQty float64
+}
+
+// bookLevel is one price level of a book message
+type bookLevel struct {
+	Price float64 `json:"price"`
+	Qty   float64 `json:"qty"`
+}
+
+// orderBook keeps the levels of a book subscription truncated to its depth
+type orderBook struct {
+	depth int
+	bids  map[float64]float64
+	asks  map[float64]float64
+	mu    sync.Mutex
+}
+
+func newOrderBook(depth int) *orderBook {
+	return &orderBook{
+		depth: depth,
+		bids:  make(map[float64]float64),
+		asks:  make(map[float64]float64),
+	}
+}
+
+// apply merges a snapshot or update into the book and returns the new top
+func (b *orderBook) apply(snapshot bool, bids, asks []bookLevel) BookTop {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if snapshot {
+		b.bids = make(map[float64]float64)
+		b.asks = make(map[float64]float64)
+	}
+
+	for _, side := range []struct {
+		levels []bookLevel
+		book   map[float64]float64
+		best   func(a, b float64) bool
+	}{
+		{bids, b.bids, func(x, y float64) bool { return x > y }},
+		{asks, b.asks, func(x, y float64) bool { return x < y }},
+	} {
+		for _, l := range side.levels {
+			if l.Qty == 0 {
+				delete(side.book, l.Price)
+			} else {
+				side.book[l.Price] = l.Qty
+			}
+		}
+
+		// Levels pushed out of the subscribed depth are not updated anymore
+		if len(side.book) > b.depth {
+			prices := make([]float64, 0, len(side.book))
+			for p := range side.book {
+				prices = append(prices, p)
+			}
+			sort.Slice(prices, func(i, j int) bool { return side.best(prices[i], prices[j]) })
+			for _, p := range prices[b.depth:] {
+				delete(side.book, p)
+			}
+		}
+	}
+
+	var top BookTop
+	for p, q := range b.bids {
+		if p > top.Bid {
+			top.Bid, top.BidQty = p, q
+		}
+	}
+	for p, q := range b.asks {
+		if top.Ask == 0 || p < top.Ask {
+			top.Ask, top.AskQty = p, q
+		}
+	}
+	return top
+}
+
+// SubscribeToBook streams the best bid and ask of a pair from the public
+// book channel whenever either changes. The subscription survives reconnects
+// and ends when ctx is done. A consumer that is behind only receives the
+// latest top.
+func (c *Client) SubscribeToBook(ctx context.Context, pair string, depth int, topChan chan<- BookTop) error {
+	book := newOrderBook(depth)
+	var last BookTop
+	send := latestRelay(ctx, topChan)
+
+	params := map[string]interface{}{"depth": depth}
+	return c.public.subscribe(ctx, "book", pair, params, func(msgType string, data json.RawMessage) {
+		var update struct {
+			Bids []bookLevel `json:"bids"`
+			Asks []bookLevel `json:"asks"`
+		}
+		if err := json.Unmarshal(data, &update); err != nil {
+			return
+		}
+
+		top := book.apply(msgType == "snapshot", update.Bids, update.Asks)
+		if top.Bid == 0 || top.Ask == 0 || top == last {
+			return
+		}
+		last = top
+
+		send(top)
+	})
+}
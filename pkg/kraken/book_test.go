@@ -0,0 +1,32 @@
+package kraken
+
+import "testing"
+
+func TestOrderBook_Apply(t *testing.T) {
+	book := newOrderBook(2)
+
+	top := book.apply(true,
+		[]bookLevel{{100, 1}, {99, 2}, {98, 3}},
+		[]bookLevel{{101, 1}, {102, 2}})
+	if top != (BookTop{Bid: 100, BidQty: 1, Ask: 101, AskQty: 1}) {
+		t.Errorf("snapshot top = %+v", top)
+	}
+	if len(book.bids) != 2 {
+		t.Errorf("bids = %v, want truncated to depth 2", book.bids)
+	}
+
+	// Removing the best bid exposes the next level, a new ask improves the touch
+	top = book.apply(false, []bookLevel{{100, 0}}, []bookLevel{{100.5, 4}})
+	if top != (BookTop{Bid: 99, BidQty: 2, Ask: 100.5, AskQty: 4}) {
+		t.Errorf("updated top = %+v", top)
+	}
+	if _, ok := book.asks[102]; ok {
+		t.Error("ask pushed out of the depth should be dropped")
+	}
+
+	// A new snapshot replaces the book, e.g. after a reconnect
+	top = book.apply(true, []bookLevel{{90, 1}}, []bookLevel{{91, 1}})
+	if top != (BookTop{Bid: 90, BidQty: 1, Ask: 91, AskQty: 1}) || len(book.bids) != 1 {
+		t.Errorf("resnapshot top = %+v, bids = %v", top, book.bids)
+	}
+}
@@ -0,0 +1,175 @@
+package kraken
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// bracketPollInterval is how often brackets are checked against the market
+const bracketPollInterval = 10 * time.Second
+
+// Bracket is the take-profit of an alert whose entry also carries a stop.
+// Kraken attaches a single conditional close to an order, so the stop-loss
+// rides on the entry and stays on the exchange, while the take-profit is
+// watched by the queue: once price reaches it, the stop is cancelled and
+// the filled volume closed at market.
+type Bracket struct {
+	EntryTxID      string  `json:"entry_txid"`
+	Volume         float64 `json:"volume,omitempty"`  // Filled volume of the entry, once known
+	Closing        bool    `json:"closing,omitempty"` // The stop is cancelled and the close pending
+	TakeProfitTxID string  `json:"take_profit_txid,omitempty"`
+	Done           bool    `json:"done,omitempty"`
+}
+
+// addBracket starts watching the bracket of a processed alert
+func (q *AlertQueue) addBracket(a *QueuedAlert) {
+	q.bmu.Lock()
+	q.brackets = append(q.brackets, a)
+	q.bmu.Unlock()
+}
+
+// watchBrackets checks the brackets every bracketPollInterval until ctx is
+// done
+func (q *AlertQueue) watchBrackets(ctx context.Context) {
+	ticker := time.NewTicker(bracketPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			q.checkBrackets(context.WithoutCancel(ctx))
+		}
+	}
+}
+
+// checkBrackets checks every active bracket against one snapshot of the
+// open orders, saving those that changed and dropping those that are done
+func (q *AlertQueue) checkBrackets(ctx context.Context) {
+	q.bmu.Lock()
+	active := append([]*QueuedAlert(nil), q.brackets...)
+	q.bmu.Unlock()
+	if len(active) == 0 {
+		return
+	}
+
+	open, err := q.client.GetOpenOrders(ctx)
+	if err != nil {
+		fmt.Printf("failed to check brackets: %v\n", err)
+		return
+	}
+
+	for _, a := range active {
+		changed, err := q.checkBracket(ctx, a, open)
+		if err != nil {
+			fmt.Printf("Bracket of alert %s: %v\n", a.ID, err)
+		}
+		if !changed {
+			continue
+		}
+
+		if err := saveState(q.path(a.Seq), a); err != nil {
+			fmt.Printf("failed to save alert %s: %v\n", a.ID, err)
+		}
+		if a.Bracket.Done {
+			q.bmu.Lock()
+			for i, b := range q.brackets {
+				if b == a {
+					q.brackets = append(q.brackets[:i], q.brackets[i+1:]...)
+					break
+				}
+			}
+			q.bmu.Unlock()
+		}
+	}
+}
+
+// checkBracket takes the profit once price reaches it, and ends the bracket
+// when the entry closes unfilled or its stop is gone. It reports whether the
+// bracket changed.
+func (q *AlertQueue) checkBracket(ctx context.Context, a *QueuedAlert, open map[string]OrderInfo) (bool, error) {
+	b, alert := a.Bracket, &a.Alert
+	changed := false
+
+	if !b.Closing {
+		if _, ok := open[b.EntryTxID]; ok {
+			return false, nil // Not filled yet
+		}
+
+		if b.Volume == 0 {
+			orders, err := q.client.QueryOrders(ctx, b.EntryTxID)
+			if err != nil {
+				return false, err
+			}
+			entry, ok := orders[b.EntryTxID]
+			if !ok {
+				return false, fmt.Errorf("entry %s not found", b.EntryTxID)
+			}
+			if entry.Status == "pending" || entry.Status == "open" {
+				return false, nil
+			}
+
+			b.Volume, _ = strconv.ParseFloat(entry.VolumeExec, 64)
+			changed = true
+			if b.Volume < minRemainingVolume {
+				fmt.Printf("Entry %s of alert %s closed unfilled\n", b.EntryTxID, a.ID)
+				b.Done = true
+				return true, nil
+			}
+		}
+
+		var stops []string
+		for txid, o := range open {
+			if o.RefID == b.EntryTxID {
+				stops = append(stops, txid)
+			}
+		}
+		if len(stops) == 0 {
+			fmt.Printf("Stop-loss of alert %s is no longer open; dropping the take-profit at %.2f\n", a.ID, alert.TakeProfit)
+			b.Done = true
+			return true, nil
+		}
+
+		ticker, err := q.client.GetTickerPrice(ctx, alert.Pair)
+		if err != nil {
+			return changed, err
+		}
+		if (alert.Action == "buy" && ticker.Bid < alert.TakeProfit) || (alert.Action == "sell" && ticker.Ask > alert.TakeProfit) {
+			return changed, nil
+		}
+
+		for _, txid := range stops {
+			if err := q.client.CancelOrder(ctx, txid); err != nil {
+				return changed, fmt.Errorf("failed to cancel stop-loss %s: %w", txid, err)
+			}
+		}
+		b.Closing = true
+		changed = true
+	}
+
+	order := OrderRequest{
+		Pair:     alert.Pair,
+		Type:     MarketOrder,
+		Side:     oppositeSide(alert.Action),
+		Volume:   strconv.FormatFloat(b.Volume, 'f', 8, 64),
+		Leverage: alert.Leverage,
+		ClOrdID:  a.clOrdID("take-profit"),
+	}
+	if alert.Leverage != "" && alert.Leverage != string(NoLeverage) {
+		order.ReduceOnly = true
+	}
+
+	placed, err := q.place(ctx, order)
+	if err != nil {
+		return changed, fmt.Errorf("cancelled the stop-loss but failed to take profit: %w", err)
+	}
+	if len(placed) > 0 {
+		b.TakeProfitTxID = placed[0].TxID
+	}
+	b.Done = true
+	fmt.Printf("Take-profit of alert %s reached at %.2f: %s\n", a.ID, alert.TakeProfit, b.TakeProfitTxID)
+	return true, nil
+}
@@ -0,0 +1,148 @@
+package kraken
+
+import (
+	"context"
+	"net/url"
+	"testing"
+)
+
+func TestTradingViewAlert_ValidateExits(t *testing.T) {
+	tests := []struct {
+		name    string
+		alert   TradingViewAlert
+		wantErr bool
+	}{
+		{"limit buy", TradingViewAlert{Action: "buy", Price: 100, StopPrice: 90, TakeProfit: 120}, false},
+		{"market sell", TradingViewAlert{Action: "sell", StopPrice: 110, TakeProfit: 90}, false},
+		{"stop above a buy", TradingViewAlert{Action: "buy", Price: 100, StopPrice: 105}, true},
+		{"take-profit below a buy", TradingViewAlert{Action: "buy", Price: 100, TakeProfit: 95}, true},
+		{"exits swapped", TradingViewAlert{Action: "sell", StopPrice: 90, TakeProfit: 110}, true},
+		{"negative", TradingViewAlert{Action: "buy", TakeProfit: -1}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.alert.validateExits(); (err != nil) != tt.wantErr {
+				t.Errorf("validateExits() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	ladder := TradingViewAlert{Action: "ladder", Pair: "XBTUSD", Side: "buy", Volume: 1, LowerBand: 90, UpperBand: 100, StopPrice: 95}
+	if err := ladder.Validate(); err == nil {
+		t.Error("a ladder stop inside the band should be rejected")
+	}
+	ladder.StopPrice, ladder.TakeProfit = 80, 120
+	if err := ladder.Validate(); err == nil {
+		t.Error("takeProfit on a ladder should be rejected")
+	}
+}
+
+func TestAlertQueue_ConditionalClose(t *testing.T) {
+	queue, api := newTestActionQueue(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		alert     TradingViewAlert
+		wantType  string
+		wantPrice string
+	}{
+		{TradingViewAlert{Action: "buy", Pair: "XBTUSD", Volume: 1, OrderType: "market", StopPrice: 900}, "stop-loss", "900.00"},
+		{TradingViewAlert{Action: "sell", Pair: "XBTUSD", Volume: 1, OrderType: "limit", Price: 1000, TakeProfit: 950}, "take-profit", "950.00"},
+	}
+	for i, tt := range tests {
+		a := &QueuedAlert{ID: tt.alert.Action, Alert: tt.alert}
+		if _, err := queue.execute(ctx, a); err != nil {
+			t.Fatalf("execute() error = %v", err)
+		}
+		placed := api.placed[i]
+		if placed.Get("close[ordertype]") != tt.wantType || placed.Get("close[price]") != tt.wantPrice || a.Bracket != nil {
+			t.Errorf("%s: close = %s %s, bracket %v", tt.alert.Action, placed.Get("close[ordertype]"), placed.Get("close[price]"), a.Bracket)
+		}
+	}
+
+	// Every rung of a ladder carries the stop
+	ladder := &QueuedAlert{ID: "ladder", Alert: TradingViewAlert{
+		Action: "ladder", Pair: "XBTUSD", Side: "buy", Volume: 0.3, LowerBand: 900, UpperBand: 1000, Orders: 3, StopPrice: 850,
+	}}
+	if _, err := queue.execute(ctx, ladder); err != nil {
+		t.Fatalf("execute() error = %v", err)
+	}
+	for _, rung := range api.placed[2:] {
+		if rung.Get("close[ordertype]") != "stop-loss" || rung.Get("close[price]") != "850.00" {
+			t.Errorf("rung at %s has close %s %s", rung.Get("price"), rung.Get("close[ordertype]"), rung.Get("close[price]"))
+		}
+	}
+}
+
+func TestAlertQueue_Bracket(t *testing.T) {
+	queue, api := newTestActionQueue(t)
+	ctx := context.Background()
+	api.ticker = 1000
+
+	a, err := queue.Enqueue("a", TradingViewAlert{
+		Action: "buy", Pair: "XBTUSD", Volume: 1, OrderType: "limit", Price: 1000, StopPrice: 950, TakeProfit: 1100,
+	})
+	if err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	queue.process(ctx, queue.lanes[0].pop())
+	if a.Bracket == nil || a.Bracket.EntryTxID != "TX-1" || api.placed[0].Get("close[ordertype]") != "stop-loss" {
+		t.Fatalf("bracket = %+v, close = %v", a.Bracket, api.placed[0])
+	}
+
+	// Nothing happens while the entry is open
+	queue.checkBrackets(ctx)
+	if a.Bracket.Volume != 0 || len(api.placed) != 1 {
+		t.Fatalf("bracket of an open entry = %+v", a.Bracket)
+	}
+
+	// The entry fills and its stop-loss rests on the exchange
+	api.filled["TX-1"] = true
+	api.placed = append(api.placed, url.Values{"pair": {"XBTUSD"}, "type": {"sell"}, "refid": {"TX-1"}})
+	queue.checkBrackets(ctx)
+	if a.Bracket.Volume != 1 || a.Bracket.Done {
+		t.Fatalf("bracket below the take-profit = %+v", a.Bracket)
+	}
+
+	// A restart resumes the bracket
+	restarted, err := NewAlertQueue(queue.client, queue.dir, 1)
+	if err != nil {
+		t.Fatalf("NewAlertQueue() error = %v", err)
+	}
+	if len(restarted.brackets) != 1 || restarted.brackets[0].Bracket.Volume != 1 {
+		t.Fatalf("restarted brackets = %v", restarted.brackets)
+	}
+
+	api.ticker = 1100
+	restarted.checkBrackets(ctx)
+	b := restarted.brackets
+	if len(b) != 0 || len(api.cancelled) != 1 || api.cancelled[0] != "TX-2" {
+		t.Fatalf("take-profit reached: brackets %v, cancelled %v", b, api.cancelled)
+	}
+	exit := api.placed[2]
+	if exit.Get("type") != "sell" || exit.Get("ordertype") != "market" || exit.Get("volume") != "1.00000000" {
+		t.Errorf("closing order = %v", exit)
+	}
+}
+
+func TestAlertQueue_BracketStopped(t *testing.T) {
+	queue, api := newTestActionQueue(t)
+	ctx := context.Background()
+	api.ticker = 1000
+
+	a, err := queue.Enqueue("a", TradingViewAlert{
+		Action: "sell", Pair: "XBTUSD", Volume: 1, OrderType: "market", Leverage: "2", StopPrice: 1050, TakeProfit: 900,
+	})
+	if err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	queue.process(ctx, queue.lanes[0].pop())
+
+	// The stop-loss has already closed the position
+	api.filled["TX-1"] = true
+	queue.checkBrackets(ctx)
+	if !a.Bracket.Done || len(queue.brackets) != 0 || len(api.placed) != 1 {
+		t.Errorf("bracket without a stop = %+v, placed %d", a.Bracket, len(api.placed))
+	}
+}
@@ -0,0 +1,321 @@
+package kraken
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+type ChaseFallback string
+
+const (
+	NoFallback     ChaseFallback = "none"   // Cancel at the deadline
+	MarketFallback ChaseFallback = "market" // Take the rest at market
+	IOCFallback    ChaseFallback = "ioc"    // Take what is available up to the chase cap
+)
+
+// DefaultAmendInterval keeps a chase within Kraken's amend rate limits
+const DefaultAmendInterval = time.Second
+
+// chaseSettleTimeout is how long to wait for the final update of a cancelled
+// chase order, and for the outcome of a fallback order
+const chaseSettleTimeout = 10 * time.Second
+
+// ChaseConfig pegs a post-only limit order to the best bid (buys) or ask
+// (sells) until it fills or the deadline passes
+type ChaseConfig struct {
+	Pair            string
+	Side            string
+	Volume          float64
+	MaxChase        float64 // How far the order may follow the touch from where it started
+	MaxChasePercent bool    // MaxChase is a percentage of the starting price
+	Deadline        time.Duration
+	Fallback        ChaseFallback
+	AmendInterval   time.Duration // Minimum time between amends
+}
+
+// ChaseResult reports how a chase order executed
+type ChaseResult struct {
+	OrderID         string
+	StartPrice      float64
+	LastPrice       float64
+	Amends          int
+	Filled          float64
+	AvgPrice        float64
+	FallbackOrderID string
+	FallbackFilled  float64
+}
+
+func (c *ChaseConfig) Validate() error {
+	if c.Pair == "" {
+		return fmt.Errorf("pair is required")
+	}
+	if c.Side != "buy" && c.Side != "sell" {
+		return fmt.Errorf("invalid side: must be buy or sell")
+	}
+	if c.Volume <= 0 {
+		return fmt.Errorf("volume must be positive")
+	}
+	if c.MaxChase < 0 {
+		return fmt.Errorf("max chase must not be negative")
+	}
+	if c.Deadline <= 0 {
+		return fmt.Errorf("deadline must be positive")
+	}
+	switch c.Fallback {
+	case NoFallback, MarketFallback, IOCFallback:
+	default:
+		return fmt.Errorf("invalid fallback: must be none, market or ioc")
+	}
+	if c.Fallback == IOCFallback && c.MaxChase == 0 {
+		return fmt.Errorf("an ioc fallback needs a max chase to price it")
+	}
+	return nil
+}
+
+// capPrice is the furthest price the order may chase to
+func (c *ChaseConfig) capPrice(start float64) float64 {
+	if c.MaxChase == 0 {
+		if c.Side == "buy" {
+			return math.Inf(1)
+		}
+		return 0
+	}
+
+	dist := c.MaxChase
+	if c.MaxChasePercent {
+		dist = start * c.MaxChase / 100
+	}
+	if c.Side == "buy" {
+		return start + dist
+	}
+	return start - dist
+}
+
+// ExecuteChase works a chase order on the book feed. It needs connected
+// public and private WebSockets.
+func (c *Client) ExecuteChase(ctx context.Context, config ChaseConfig) (*ChaseResult, error) {
+	if config.Fallback == "" {
+		config.Fallback = MarketFallback
+	}
+	if config.AmendInterval <= 0 {
+		config.AmendInterval = DefaultAmendInterval
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid chase order: %w", err)
+	}
+
+	feedCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	tops := make(chan BookTop, 16)
+	if err := c.SubscribeToBook(feedCtx, config.Pair, 10, tops); err != nil {
+		return nil, err
+	}
+	execs := make(chan Execution, 64)
+	if err := c.SubscribeToExecutions(feedCtx, execs); err != nil {
+		return nil, err
+	}
+
+	return c.chase(ctx, config, tops, execs)
+}
+
+// chase pegs the order to the touch from tops, following its fills in execs
+func (c *Client) chase(ctx context.Context, config ChaseConfig, tops <-chan BookTop, execs <-chan Execution) (*ChaseResult, error) {
+	buy := config.Side == "buy"
+	touch := func(t BookTop) float64 {
+		if buy {
+			return t.Bid
+		}
+		return t.Ask
+	}
+
+	var top BookTop
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case top = <-tops:
+	}
+
+	result := &ChaseResult{StartPrice: touch(top)}
+	limit := config.capPrice(result.StartPrice)
+	clamp := func(p float64) float64 {
+		if buy {
+			return math.Min(p, limit)
+		}
+		return math.Max(p, limit)
+	}
+
+	placed, err := c.AddOrderWS(ctx, WSOrderRequest{
+		OrderType:  string(LimitOrder),
+		Side:       config.Side,
+		OrderQty:   config.Volume,
+		Symbol:     config.Pair,
+		LimitPrice: result.StartPrice,
+		PostOnly:   true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to place chase order: %w", err)
+	}
+	result.OrderID = placed.OrderID
+	result.LastPrice = result.StartPrice
+	fmt.Printf("Chasing %s %v %s from %.2f\n", config.Side, config.Volume, config.Pair, result.StartPrice)
+
+	deadline := time.NewTimer(config.Deadline)
+	defer deadline.Stop()
+
+	var lastAmend time.Time
+	cost := 0.0
+	for {
+		select {
+		case <-ctx.Done():
+			if err := c.cancelChase(result); err != nil {
+				fmt.Printf("%v\n", err)
+			}
+			return result, ctx.Err()
+
+		case top = <-tops:
+			target := clamp(touch(top))
+			if target == result.LastPrice || time.Since(lastAmend) < config.AmendInterval {
+				continue
+			}
+			if _, err := c.AmendOrderWS(ctx, WSAmendRequest{
+				OrderID:    result.OrderID,
+				LimitPrice: target,
+				PostOnly:   true,
+			}); err != nil {
+				// The order may have filled in the meantime; executions tell
+				fmt.Printf("failed to amend chase order to %.2f: %v\n", target, err)
+				continue
+			}
+			result.LastPrice = target
+			result.Amends++
+			lastAmend = time.Now()
+
+		case exec := <-execs:
+			if exec.OrderID != result.OrderID {
+				continue
+			}
+			switch applyChaseExec(result, exec, &cost) {
+			case "filled":
+				return result, nil
+			case "canceled", "expired":
+				return result, fmt.Errorf("chase order %s was %s", result.OrderID, exec.OrderStatus)
+			}
+
+		case <-deadline.C:
+			// Only once the chase order is gone and its fills are known is
+			// the rest safe to take elsewhere
+			if err := c.cancelChase(result); err != nil {
+				return result, fmt.Errorf("%w; no fallback sent while it may be resting", err)
+			}
+			if err := settleChase(ctx, result, execs, &cost); err != nil {
+				return result, err
+			}
+
+			remaining := config.Volume - result.Filled
+			if config.Fallback == NoFallback || remaining < minRemainingVolume {
+				return result, nil
+			}
+			return result, c.chaseFallback(ctx, config, result, remaining, limit, execs)
+		}
+	}
+}
+
+// applyChaseExec adds a chase order execution to the result and returns the
+// order's status
+func applyChaseExec(result *ChaseResult, exec Execution, cost *float64) string {
+	if exec.ExecType == "trade" {
+		result.Filled += exec.LastQty
+		*cost += exec.LastQty * exec.LastPrice
+		result.AvgPrice = *cost / result.Filled
+	}
+	// The cumulative quantity also covers trades whose updates were missed
+	if exec.CumQty > result.Filled {
+		result.Filled = exec.CumQty
+		result.AvgPrice = exec.AvgPrice
+	}
+	return exec.OrderStatus
+}
+
+// settleChase waits for the final update of the cancelled chase order, so
+// that fills racing the cancel are counted
+func settleChase(ctx context.Context, result *ChaseResult, execs <-chan Execution, cost *float64) error {
+	timeout := time.NewTimer(chaseSettleTimeout)
+	defer timeout.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timeout.C:
+			return fmt.Errorf("no final update for chase order %s; no fallback sent", result.OrderID)
+		case exec := <-execs:
+			if exec.OrderID != result.OrderID {
+				continue
+			}
+			switch applyChaseExec(result, exec, cost) {
+			case "filled", "canceled", "expired":
+				return nil
+			}
+		}
+	}
+}
+
+// cancelChase cancels the resting chase order, even if ctx is done
+func (c *Client) cancelChase(result *ChaseResult) error {
+	ctx, cancel := context.WithTimeout(context.Background(), REST_TIMEOUT)
+	defer cancel()
+
+	if err := c.CancelOrderWS(ctx, WSCancelRequest{OrderIDs: []string{result.OrderID}}); err != nil {
+		return fmt.Errorf("failed to cancel chase order %s: %w", result.OrderID, err)
+	}
+	return nil
+}
+
+// chaseFallback takes the remaining volume with a market order, or an IOC
+// limit at the chase cap, and waits for its outcome
+func (c *Client) chaseFallback(ctx context.Context, config ChaseConfig, result *ChaseResult, remaining, limit float64, execs <-chan Execution) error {
+	req := WSOrderRequest{
+		OrderType: string(MarketOrder),
+		Side:      config.Side,
+		OrderQty:  remaining,
+		Symbol:    config.Pair,
+	}
+	if config.Fallback == IOCFallback {
+		req.OrderType = string(LimitOrder)
+		req.LimitPrice = limit
+		req.TimeInForce = "ioc"
+	}
+
+	placed, err := c.AddOrderWS(ctx, req)
+	if err != nil {
+		return fmt.Errorf("failed to place %s fallback: %w", config.Fallback, err)
+	}
+	result.FallbackOrderID = placed.OrderID
+	fmt.Printf("Chase deadline reached, sent %s order for %v\n", config.Fallback, remaining)
+
+	timeout := time.NewTimer(chaseSettleTimeout)
+	defer timeout.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timeout.C:
+			return nil
+		case exec := <-execs:
+			if exec.OrderID != placed.OrderID {
+				continue
+			}
+			if exec.ExecType == "trade" {
+				result.FallbackFilled += exec.LastQty
+			}
+			switch exec.OrderStatus {
+			case "filled", "canceled", "expired":
+				return nil
+			}
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package kraken
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestChaseConfig_Validate(t *testing.T) {
+	base := ChaseConfig{Pair: "BTC/USD", Side: "buy", Volume: 1, Deadline: time.Minute, Fallback: MarketFallback}
+
+	tests := []struct {
+		name   string
+		modify func(*ChaseConfig)
+	}{
+		{"no pair", func(c *ChaseConfig) { c.Pair = "" }},
+		{"bad side", func(c *ChaseConfig) { c.Side = "hold" }},
+		{"no volume", func(c *ChaseConfig) { c.Volume = 0 }},
+		{"negative chase", func(c *ChaseConfig) { c.MaxChase = -1 }},
+		{"no deadline", func(c *ChaseConfig) { c.Deadline = 0 }},
+		{"bad fallback", func(c *ChaseConfig) { c.Fallback = "fok" }},
+		{"uncapped ioc", func(c *ChaseConfig) { c.Fallback = IOCFallback }},
+	}
+
+	if err := base.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := base
+			tt.modify(&config)
+			if err := config.Validate(); err == nil {
+				t.Error("Validate() should fail")
+			}
+		})
+	}
+}
+
+func TestChaseConfig_CapPrice(t *testing.T) {
+	tests := []struct {
+		config ChaseConfig
+		want   float64
+	}{
+		{ChaseConfig{Side: "buy", MaxChase: 50}, 1050},
+		{ChaseConfig{Side: "sell", MaxChase: 50}, 950},
+		{ChaseConfig{Side: "buy", MaxChase: 1, MaxChasePercent: true}, 1010},
+		{ChaseConfig{Side: "sell", MaxChase: 1, MaxChasePercent: true}, 990},
+		{ChaseConfig{Side: "buy", MaxChase: 0.05, MaxChasePercent: true}, 1000.5},
+		{ChaseConfig{Side: "sell"}, 0},
+	}
+
+	for _, tt := range tests {
+		if got := tt.config.capPrice(1000); got != tt.want {
+			t.Errorf("capPrice(%+v) = %v, want %v", tt.config, got, tt.want)
+		}
+	}
+
+	// Low-priced pairs keep their cap below a cent
+	low := ChaseConfig{Side: "buy", MaxChase: 0.5, MaxChasePercent: true}
+	if got := low.capPrice(0.5); math.Abs(got-0.5025) > 1e-12 {
+		t.Errorf("capPrice(0.5) = %v, want 0.5025", got)
+	}
+}
+
+func TestChase_FollowsTouchUpToCap(t *testing.T) {
+	client, received, cleanup := newOrderTestClient(t, map[string]interface{}{
+		"add_order":   map[string]interface{}{"order_id": "OCHASE"},
+		"amend_order": map[string]interface{}{"order_id": "OCHASE", "amend_id": "A1"},
+	})
+	defer cleanup()
+
+	tops := make(chan BookTop, 4)
+	execs := make(chan Execution, 4)
+	tops <- BookTop{Bid: 1000, Ask: 1001}
+	tops <- BookTop{Bid: 1020, Ask: 1021}
+	tops <- BookTop{Bid: 1100, Ask: 1101}
+
+	config := ChaseConfig{
+		Pair: "BTC/USD", Side: "buy", Volume: 1, MaxChase: 50,
+		Deadline: time.Minute, Fallback: MarketFallback, AmendInterval: time.Nanosecond,
+	}
+
+	done := make(chan *ChaseResult)
+	go func() {
+		result, err := client.chase(context.Background(), config, tops, execs)
+		if err != nil {
+			t.Errorf("chase() error = %v", err)
+		}
+		done <- result
+	}()
+
+	want := []struct {
+		method string
+		price  float64
+	}{{"add_order", 1000}, {"amend_order", 1020}, {"amend_order", 1050}}
+	for _, w := range want {
+		select {
+		case params := <-received:
+			if params["method"] != w.method || params["limit_price"] != w.price || params["post_only"] != true {
+				t.Errorf("params = %v, want post-only %s at %v", params, w.method, w.price)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s at %v not sent", w.method, w.price)
+		}
+	}
+
+	execs <- Execution{OrderID: "OTHER", ExecType: "trade", LastQty: 5, LastPrice: 1}
+	execs <- Execution{OrderID: "OCHASE", ExecType: "trade", OrderStatus: "partially_filled", LastQty: 0.4, LastPrice: 1050}
+	execs <- Execution{OrderID: "OCHASE", ExecType: "trade", OrderStatus: "filled", LastQty: 0.6, LastPrice: 1040}
+
+	select {
+	case result := <-done:
+		if result.Amends != 2 || result.Filled != 1 || result.AvgPrice != 1044 {
+			t.Errorf("result = %+v, want 2 amends and 1 filled at 1044", result)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("chase did not finish on fill")
+	}
+}
+
+func TestChase_FallsBackAtDeadline(t *testing.T) {
+	client, received, cleanup := newOrderTestClient(t, map[string]interface{}{
+		"add_order":    map[string]interface{}{"order_id": "OCHASE"},
+		"cancel_order": map[string]interface{}{"order_id": "OCHASE"},
+	})
+	defer cleanup()
+
+	tops := make(chan BookTop, 1)
+	execs := make(chan Execution, 4)
+	tops <- BookTop{Bid: 999, Ask: 1000}
+	execs <- Execution{OrderID: "OCHASE", ExecType: "trade", LastQty: 0.25, LastPrice: 1000}
+
+	config := ChaseConfig{
+		Pair: "BTC/USD", Side: "sell", Volume: 1, MaxChase: 1, MaxChasePercent: true,
+		Deadline: 50 * time.Millisecond, Fallback: IOCFallback, AmendInterval: time.Second,
+	}
+
+	done := make(chan *ChaseResult)
+	go func() {
+		result, err := client.chase(context.Background(), config, tops, execs)
+		if err != nil {
+			t.Errorf("chase() error = %v", err)
+		}
+		done <- result
+	}()
+
+	var sent []map[string]interface{}
+	next := func() {
+		select {
+		case params := <-received:
+			sent = append(sent, params)
+		case <-time.After(time.Second):
+			t.Fatalf("only %d calls sent", len(sent))
+		}
+	}
+	next()
+	next()
+	if sent[1]["method"] != "cancel_order" {
+		t.Errorf("second call = %v, want cancel_order", sent[1])
+	}
+
+	// No fallback until the cancel is confirmed, counting a fill that
+	// raced it
+	select {
+	case params := <-received:
+		t.Fatalf("fallback %v sent before the chase order was cancelled", params)
+	case <-time.After(50 * time.Millisecond):
+	}
+	execs <- Execution{OrderID: "OCHASE", ExecType: "trade", OrderStatus: "partially_filled", LastQty: 0.25, LastPrice: 1000, CumQty: 0.5}
+	execs <- Execution{OrderID: "OCHASE", ExecType: "canceled", OrderStatus: "canceled", CumQty: 0.5}
+
+	next()
+	ioc := sent[2]
+	if ioc["method"] != "add_order" || ioc["time_in_force"] != "ioc" || ioc["limit_price"] != 990.0 || ioc["order_qty"] != 0.5 {
+		t.Errorf("fallback = %v, want ioc sell 0.5 at 990", ioc)
+	}
+
+	execs <- Execution{OrderID: "OCHASE", ExecType: "trade", OrderStatus: "filled", LastQty: 0.5, LastPrice: 995}
+	select {
+	case result := <-done:
+		if result.Filled != 0.5 || result.FallbackFilled != 0.5 || result.FallbackOrderID != "OCHASE" {
+			t.Errorf("result = %+v", result)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("chase did not finish after the fallback filled")
+	}
+}
+
+func TestChase_NoFallbackWhenCancelFails(t *testing.T) {
+	client, received, cleanup := newOrderTestClient(t, map[string]interface{}{
+		"add_order":    map[string]interface{}{"order_id": "OCHASE"},
+		"cancel_order": errors.New("EOrder:Unknown order"),
+	})
+	defer cleanup()
+
+	tops := make(chan BookTop, 1)
+	tops <- BookTop{Bid: 999, Ask: 1000}
+	config := ChaseConfig{
+		Pair: "BTC/USD", Side: "buy", Volume: 1, Deadline: 10 * time.Millisecond,
+		Fallback: MarketFallback, AmendInterval: time.Second,
+	}
+
+	if _, err := client.chase(context.Background(), config, tops, make(chan Execution)); err == nil {
+		t.Error("chase() should fail when the chase order could not be cancelled")
+	}
+	for i := 0; i < 2; i++ {
+		<-received
+	}
+	select {
+	case params := <-received:
+		t.Errorf("fallback %v sent while the chase order may be resting", params)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
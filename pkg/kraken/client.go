@@ -9,44 +9,46 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"math"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
-
-	"github.com/gorilla/websocket"
 )
 
 const (
 	APIURL            = "https://api.kraken.com"
 	WSS_URL           = "wss://ws-auth.kraken.com/v2"
+	PUBLIC_WSS_URL    = "wss://ws.kraken.com/v2"
 	API_VERSION       = "0"
 	REST_TIMEOUT      = 10 * time.Second
 	HeartbeatInterval = 10 * time.Second
 	ReconnectDelay    = 5 * time.Second
 )
 
-type ConnectionState int
-
-const (
-	Disconnected ConnectionState = iota
-	Connecting
-	Connected
-)
-
 type Client struct {
 	apiKey     string
 	apiSecret  string
 	httpClient *http.Client
 	apiURL     string
-	ws         *websocket.Conn
-	wsLock     sync.Mutex
-	state      ConnectionState
-	stateLock  sync.RWMutex
-	done       chan struct{}
+
+	public  *wsConn
+	private *wsConn
+
+	reconnectPolicy ReconnectPolicy
+	stateHandlers   []func(WSEndpoint, ConnectionState)
+	stateLock       sync.RWMutex
+
+	wsToken     string
+	wsTokenTime time.Time
+	wsTokenLock sync.Mutex
+
+	deadMan     *DeadMansSwitch
+	deadManLock sync.Mutex
+
+	pairs     map[string]*AssetPair
+	pairsLock sync.Mutex
 }
 
 type TickerInfo struct {
@@ -62,10 +64,34 @@ const (
 	EvenDistribution   VolumeDistribution = "even"
 	NormalDistribution VolumeDistribution = "normal" // More volume in middle
 	CustomDistribution VolumeDistribution = "custom" // User-provided weights
+
+	GaussianDistribution       VolumeDistribution = "gaussian"        // Bell curve with configurable sigma
+	PyramidDistribution        VolumeDistribution = "pyramid"         // Increasing toward the far end
+	InversePyramidDistribution VolumeDistribution = "inverse-pyramid" // Decreasing toward the far end
+	ExponentialDistribution    VolumeDistribution = "exponential"     // Each rung Factor times the previous
+)
+
+// IsValidDistribution reports whether d names a supported volume distribution
+func IsValidDistribution(d string) bool {
+	switch VolumeDistribution(d) {
+	case EvenDistribution, NormalDistribution, CustomDistribution, GaussianDistribution,
+		PyramidDistribution, InversePyramidDistribution, ExponentialDistribution:
+		return true
+	default:
+		return false
+	}
+}
+
+type PriceSpacing string
+
+const (
+	LinearSpacing    PriceSpacing = "linear"    // Constant price step between rungs
+	GeometricSpacing PriceSpacing = "geometric" // Constant percentage step between rungs
+	ExplicitSpacing  PriceSpacing = "explicit"  // User-provided price levels
 )
 
 func NewClient(apiKey, apiSecret string) *Client {
-	return &Client{
+	c := &Client{
 		apiKey:    apiKey,
 		apiSecret: apiSecret,
 		apiURL:    APIURL,
@@ -73,6 +99,53 @@ func NewClient(apiKey, apiSecret string) *Client {
 			Timeout: REST_TIMEOUT,
 		},
 	}
+	c.reconnectPolicy = DefaultReconnectPolicy
+	c.public = newWSConn(c, PublicEndpoint, PUBLIC_WSS_URL)
+	c.private = newWSConn(c, PrivateEndpoint, WSS_URL)
+	return c
+}
+
+// SetWebSocketURLs points the public and private WebSocket connections at
+// different servers, e.g. a local mock in tests. It must be called before
+// connecting.
+func (c *Client) SetWebSocketURLs(publicURL, privateURL string) {
+	c.public.url = publicURL
+	c.private.url = privateURL
+}
+
+// SetReconnectPolicy replaces the backoff used when the WebSocket drops
+func (c *Client) SetReconnectPolicy(policy ReconnectPolicy) {
+	c.reconnectPolicy = policy
+}
+
+// OnStateChange registers fn to be called whenever one of the WebSocket
+// connections changes state. Handlers run synchronously and must not block.
+func (c *Client) OnStateChange(fn func(WSEndpoint, ConnectionState)) {
+	c.stateLock.Lock()
+	defer c.stateLock.Unlock()
+	c.stateHandlers = append(c.stateHandlers, fn)
+}
+
+// State returns the current state of the given WebSocket connection
+func (c *Client) State(endpoint WSEndpoint) ConnectionState {
+	return c.conn(endpoint).getState()
+}
+
+func (c *Client) conn(endpoint WSEndpoint) *wsConn {
+	if endpoint == PublicEndpoint {
+		return c.public
+	}
+	return c.private
+}
+
+func (c *Client) notifyState(endpoint WSEndpoint, state ConnectionState) {
+	c.stateLock.RLock()
+	handlers := append([]func(WSEndpoint, ConnectionState){}, c.stateHandlers...)
+	c.stateLock.RUnlock()
+
+	for _, fn := range handlers {
+		fn(endpoint, state)
+	}
 }
 
 // getSignature creates API authentication signature per Kraken documentation
@@ -99,11 +172,8 @@ func (c *Client) AddOrder(ctx context.Context, req OrderRequest) (*OrderResponse
 		return nil, fmt.Errorf("invalid order: %w", err)
 	}
 
-	endpoint := "/0/private/AddOrder"
-
 	// Create form data
 	data := url.Values{}
-	data.Set("nonce", strconv.FormatInt(time.Now().UnixNano(), 10))
 	data.Set("ordertype", string(req.Type))
 	data.Set("type", req.Side)
 	data.Set("volume", req.Volume)
@@ -115,348 +185,404 @@ func (c *Client) AddOrder(ctx context.Context, req OrderRequest) (*OrderResponse
 	if req.Leverage != "" {
 		data.Set("leverage", req.Leverage)
 	}
+	if req.OrderFlags != "" {
+		data.Set("oflags", req.OrderFlags)
+	}
+	if req.UserRef != 0 {
+		data.Set("userref", strconv.FormatInt(req.UserRef, 10))
+	}
+	if req.ClOrdID != "" {
+		data.Set("cl_ord_id", req.ClOrdID)
+	}
+	if req.ReduceOnly {
+		data.Set("reduce_only", "true")
+	}
+	if req.Close != nil {
+		data.Set("close[ordertype]", string(req.Close.Type))
+		data.Set("close[price]", req.Close.Price)
+	}
 
-	// Create signature
-	signature := c.getSignature(endpoint, data.Get("nonce"), data.Encode())
-
-	// Create request
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.apiURL+endpoint, strings.NewReader(data.Encode()))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+	var result OrderResponse
+	if err := c.privateRequest(ctx, "/0/private/AddOrder", data, &result); err != nil {
+		return nil, err
 	}
 
-	httpReq.Header.Add("API-Key", c.apiKey)
-	httpReq.Header.Add("API-Sign", signature)
-	httpReq.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	return &result, nil
+}
 
-	// Execute request
-	resp, err := c.httpClient.Do(httpReq)
-	if err != nil {
-		return nil, fmt.Errorf("failed to execute request: %w", err)
+// CancelOrder cancels an open order by txid or userref via REST API
+func (c *Client) CancelOrder(ctx context.Context, txid string) error {
+	data := url.Values{}
+	data.Set("txid", txid)
+
+	if err := c.privateRequest(ctx, "/0/private/CancelOrder", data, nil); err != nil {
+		return fmt.Errorf("failed to cancel order %s: %w", txid, err)
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+	return nil
+}
+
+// QueryOrders returns the status and fill of the given orders, keyed by txid
+func (c *Client) QueryOrders(ctx context.Context, txids ...string) (map[string]OrderInfo, error) {
+	data := url.Values{}
+	data.Set("txid", strings.Join(txids, ","))
+
+	result := make(map[string]OrderInfo)
+	if err := c.privateRequest(ctx, "/0/private/QueryOrders", data, &result); err != nil {
+		return nil, fmt.Errorf("failed to query orders: %w", err)
 	}
 
+	return result, nil
+}
+
+// GetOpenOrders returns every open order, keyed by txid
+func (c *Client) GetOpenOrders(ctx context.Context) (map[string]OrderInfo, error) {
 	var result struct {
-		Error  []string      `json:"error"`
-		Result OrderResponse `json:"result"`
+		Open map[string]OrderInfo `json:"open"`
+	}
+	if err := c.privateRequest(ctx, "/0/private/OpenOrders", url.Values{}, &result); err != nil {
+		return nil, fmt.Errorf("failed to get open orders: %w", err)
 	}
 
-	if err := json.Unmarshal(body, &result); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
+	return result.Open, nil
+}
+
+// FindOrder returns the open or closed order placed with a cl_ord_id, or an
+// empty txid when there is none
+func (c *Client) FindOrder(ctx context.Context, clOrdID string) (string, *OrderInfo, error) {
+	data := url.Values{}
+	data.Set("cl_ord_id", clOrdID)
+
+	var open struct {
+		Open map[string]OrderInfo `json:"open"`
+	}
+	if err := c.privateRequest(ctx, "/0/private/OpenOrders", data, &open); err != nil {
+		return "", nil, fmt.Errorf("failed to look up order %s: %w", clOrdID, err)
+	}
+	for txid, info := range open.Open {
+		return txid, &info, nil
 	}
 
-	if len(result.Error) > 0 {
-		return nil, fmt.Errorf("API error: %v", result.Error)
+	var closed struct {
+		Closed map[string]OrderInfo `json:"closed"`
+	}
+	if err := c.privateRequest(ctx, "/0/private/ClosedOrders", data, &closed); err != nil {
+		return "", nil, fmt.Errorf("failed to look up order %s: %w", clOrdID, err)
+	}
+	for txid, info := range closed.Closed {
+		return txid, &info, nil
 	}
 
-	return &result.Result, nil
+	return "", nil, nil
 }
 
-// ConnectWebSocket establishes WebSocket connection
-func (c *Client) ConnectWebSocket(ctx context.Context) error {
-	c.setState(Connecting)
+// CancelAllOrders cancels every open order and returns how many were open
+func (c *Client) CancelAllOrders(ctx context.Context) (int, error) {
+	var result struct {
+		Count int `json:"count"`
+	}
+	if err := c.privateRequest(ctx, "/0/private/CancelAll", url.Values{}, &result); err != nil {
+		return 0, fmt.Errorf("failed to cancel all orders: %w", err)
+	}
 
-	dialer := websocket.Dialer{
-		HandshakeTimeout: 10 * time.Second,
+	return result.Count, nil
+}
+
+// GetBalance returns the balance of every asset, keyed by Kraken's asset name
+func (c *Client) GetBalance(ctx context.Context) (map[string]float64, error) {
+	var result map[string]string
+	if err := c.privateRequest(ctx, "/0/private/Balance", url.Values{}, &result); err != nil {
+		return nil, fmt.Errorf("failed to get balance: %w", err)
 	}
 
-	conn, _, err := dialer.DialContext(ctx, WSS_URL, nil)
-	if err != nil {
-		c.setState(Disconnected)
-		return fmt.Errorf("failed to connect: %w", err)
+	balances := make(map[string]float64, len(result))
+	for asset, amount := range result {
+		v, err := strconv.ParseFloat(amount, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid balance %q for %s: %w", amount, asset, err)
+		}
+		balances[asset] = v
 	}
+	return balances, nil
+}
 
-	c.wsLock.Lock()
-	c.ws = conn
-	c.wsLock.Unlock()
+// GetOpenPositions returns the open margin positions, keyed by position ID
+func (c *Client) GetOpenPositions(ctx context.Context) (map[string]PositionInfo, error) {
+	result := make(map[string]PositionInfo)
+	if err := c.privateRequest(ctx, "/0/private/OpenPositions", url.Values{}, &result); err != nil {
+		return nil, fmt.Errorf("failed to get open positions: %w", err)
+	}
 
-	c.setState(Connected)
-	c.done = make(chan struct{})
+	return result, nil
+}
 
-	// Start heartbeat
-	go c.heartbeat(ctx)
-	// Start reconnection monitor
-	go c.monitorConnection(ctx)
+// GetOHLC returns candles of the given interval in minutes, oldest first
+func (c *Client) GetOHLC(ctx context.Context, pair string, interval int) ([]Candle, error) {
+	params := url.Values{}
+	params.Set("pair", restPair(pair))
+	params.Set("interval", strconv.Itoa(interval))
 
-	return nil
-}
+	var result map[string]json.RawMessage
+	if err := c.publicRequest(ctx, "/0/public/OHLC", params, &result); err != nil {
+		return nil, fmt.Errorf("failed to get OHLC: %w", err)
+	}
 
-func (c *Client) heartbeat(ctx context.Context) {
-	ticker := time.NewTicker(HeartbeatInterval)
-	defer ticker.Stop()
+	for key, raw := range result {
+		if key == "last" {
+			continue
+		}
 
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case <-c.done:
-			return
-		case <-ticker.C:
-			c.wsLock.Lock()
-			err := c.ws.WriteMessage(websocket.PingMessage, nil)
-			c.wsLock.Unlock()
+		var rows [][]interface{}
+		if err := json.Unmarshal(raw, &rows); err != nil {
+			return nil, fmt.Errorf("failed to parse OHLC: %w", err)
+		}
 
+		candles := make([]Candle, 0, len(rows))
+		for _, row := range rows {
+			candle, err := parseCandle(row)
 			if err != nil {
-				fmt.Printf("heartbeat failed: %v\n", err)
-				c.reconnect(ctx)
+				return nil, err
 			}
+			candles = append(candles, candle)
 		}
+		return candles, nil
 	}
+
+	return nil, fmt.Errorf("no OHLC data for %s", pair)
 }
 
-func (c *Client) monitorConnection(ctx context.Context) {
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case <-c.done:
-			return
-		default:
-			c.wsLock.Lock()
-			_, _, err := c.ws.ReadMessage()
-			c.wsLock.Unlock()
+// GetAssetPair returns the trading rules of a pair
+func (c *Client) GetAssetPair(ctx context.Context, pair string) (*AssetPair, error) {
+	params := url.Values{}
+	params.Set("pair", restPair(pair))
 
-			if err != nil {
-				fmt.Printf("connection error: %v\n", err)
-				c.reconnect(ctx)
-			}
-		}
+	var result map[string]AssetPair
+	if err := c.publicRequest(ctx, "/0/public/AssetPairs", params, &result); err != nil {
+		return nil, fmt.Errorf("failed to get asset pair: %w", err)
 	}
-}
 
-func (c *Client) reconnect(ctx context.Context) {
-	if c.getState() == Connecting {
-		return
+	for name, info := range result {
+		info.Name = name
+		return &info, nil
 	}
 
-	c.setState(Connecting)
+	return nil, fmt.Errorf("unknown pair %s", pair)
+}
 
-	// Close existing connection
-	c.Close()
+// assetPair returns the trading rules of a pair, asking Kraken only once per
+// pair for the lifetime of the client
+func (c *Client) assetPair(ctx context.Context, pair string) (*AssetPair, error) {
+	c.pairsLock.Lock()
+	info, ok := c.pairs[pair]
+	c.pairsLock.Unlock()
+	if ok {
+		return info, nil
+	}
 
-	// Attempt to reconnect with backoff
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		default:
-			if err := c.ConnectWebSocket(ctx); err == nil {
-				return
-			}
-			time.Sleep(ReconnectDelay)
-		}
+	info, err := c.GetAssetPair(ctx, pair)
+	if err != nil {
+		return nil, err
+	}
+
+	c.pairsLock.Lock()
+	if c.pairs == nil {
+		c.pairs = make(map[string]*AssetPair)
 	}
+	c.pairs[pair] = info
+	c.pairsLock.Unlock()
+	return info, nil
 }
 
-// AddOrderWS places a new order via WebSocket API
-func (c *Client) AddOrderWS(ctx context.Context, req WSOrderRequest) error {
-	if c.ws == nil {
-		return fmt.Errorf("websocket connection not established")
+// restPair converts a WebSocket symbol such as "BTC/USD" to the REST form
+func restPair(pair string) string {
+	return strings.ReplaceAll(pair, "/", "")
+}
+
+// publicRequest GETs a public REST endpoint and decodes the result field of
+// the response into result
+func (c *Client) publicRequest(ctx context.Context, endpoint string, params url.Values, result interface{}) error {
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", c.apiURL+endpoint+"?"+params.Encode(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
 	}
 
-	message := map[string]interface{}{
-		"method": "add_order",
-		"params": req,
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("failed to execute request: %w", err)
 	}
+	defer resp.Body.Close()
 
-	c.wsLock.Lock()
-	err := c.ws.WriteJSON(message)
-	c.wsLock.Unlock()
+	return decodeResponse(resp.Body, result)
+}
+
+// privateRequest signs and POSTs data to a private REST endpoint and decodes
+// the result field of the response into result
+func (c *Client) privateRequest(ctx context.Context, endpoint string, data url.Values, result interface{}) error {
+	data.Set("nonce", strconv.FormatInt(time.Now().UnixNano(), 10))
 
+	// Create signature
+	signature := c.getSignature(endpoint, data.Get("nonce"), data.Encode())
+
+	// Create request
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.apiURL+endpoint, strings.NewReader(data.Encode()))
 	if err != nil {
-		return fmt.Errorf("failed to send order: %w", err)
+		return fmt.Errorf("failed to create request: %w", err)
 	}
 
-	// Read response
-	_, msgBytes, err := c.ws.ReadMessage()
+	httpReq.Header.Add("API-Key", c.apiKey)
+	httpReq.Header.Add("API-Sign", signature)
+	httpReq.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	// Execute request
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	return decodeResponse(resp.Body, result)
+}
+
+// APIError holds the errors Kraken returned for a request, such as
+// "EOrder:Insufficient funds"
+type APIError struct {
+	Errors []string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API error: %v", e.Errors)
+}
+
+// decodeResponse unwraps Kraken's {"error": [...], "result": ...} envelope
+func decodeResponse(r io.Reader, result interface{}) error {
+	body, err := io.ReadAll(r)
 	if err != nil {
 		return fmt.Errorf("failed to read response: %w", err)
 	}
 
-	var response struct {
-		Error  string `json:"error"`
-		Result struct {
-			OrderID string `json:"order_id"`
-		} `json:"result"`
+	var envelope struct {
+		Error  []string        `json:"error"`
+		Result json.RawMessage `json:"result"`
 	}
 
-	if err := json.Unmarshal(msgBytes, &response); err != nil {
+	if err := json.Unmarshal(body, &envelope); err != nil {
 		return fmt.Errorf("failed to parse response: %w", err)
 	}
 
-	if response.Error != "" {
-		return fmt.Errorf("API error: %s", response.Error)
+	if len(envelope.Error) > 0 {
+		return &APIError{Errors: envelope.Error}
 	}
 
-	return nil
-}
+	if result == nil || len(envelope.Result) == 0 {
+		return nil
+	}
 
-func (c *Client) Close() error {
-	if c.ws != nil {
-		return c.ws.Close()
+	if err := json.Unmarshal(envelope.Result, result); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
 	}
+
 	return nil
 }
 
-// SubscribeToTicker subscribes to real-time price updates
-func (c *Client) SubscribeToTicker(ctx context.Context, pair string, priceChan chan<- float64) error {
-	if c.ws == nil {
-		return fmt.Errorf("websocket connection not established")
+// ConnectWebSocket establishes the public market data connection and, when
+// API credentials are configured, the private trading connection
+func (c *Client) ConnectWebSocket(ctx context.Context) error {
+	if err := c.ConnectPublicWebSocket(ctx); err != nil {
+		return err
 	}
 
-	// Start message handler
-	go func() {
-		for {
-			_, message, err := c.ws.ReadMessage()
-			if err != nil {
-				fmt.Printf("read error: %v\n", err)
-				return
-			}
-
-			var data []interface{}
-			if err := json.Unmarshal(message, &data); err == nil {
-				// Check if it's a ticker update
-				if len(data) > 1 {
-					if tickerData, ok := data[1].(map[string]interface{}); ok {
-						if c, ok := tickerData["c"].([]interface{}); ok && len(c) > 0 {
-							if priceStr, ok := c[0].(string); ok {
-								if price, err := strconv.ParseFloat(priceStr, 64); err == nil {
-									priceChan <- price
-								}
-							}
-						}
-					}
-				}
-			}
-		}
-	}()
-
-	// Subscribe to ticker
-	subscribe := map[string]interface{}{
-		"event": "subscribe",
-		"pair":  []string{strings.ReplaceAll(pair, "/", "")},
-		"subscription": map[string]string{
-			"name": "ticker",
-		},
+	if c.apiKey == "" || c.apiSecret == "" {
+		return nil
 	}
 
-	if err := c.ws.WriteJSON(subscribe); err != nil {
-		return fmt.Errorf("failed to subscribe: %w", err)
+	if err := c.ConnectPrivateWebSocket(ctx); err != nil {
+		c.public.close()
+		return err
 	}
 
 	return nil
 }
 
-func (c *Client) GetTickerPrice(ctx context.Context, pair string) (*TickerInfo, error) {
-	// TODO: Implement actual Kraken API call
-	// This is a mock implementation for now
-	return &TickerInfo{
-		Last:   50000.0, // Mock price
-		Ask:    50001.0,
-		Bid:    49999.0,
-		Volume: 100.0,
-	}, nil
-}
-
-func calculateOrderVolumes(config TrailingEntryConfig) []float64 {
-	volumes := make([]float64, config.NumOrders)
-
-	switch config.Distribution {
-	case NormalDistribution:
-		// Approximate normal distribution weights
-		middle := float64(config.NumOrders-1) / 2
-		sum := 0.0
-
-		for i := 0; i < config.NumOrders; i++ {
-			// Calculate distance from middle (0 to 1)
-			distance := math.Abs(float64(i)-middle) / middle
-			// Convert to a weight (1 at middle, smaller at edges)
-			weight := 1 - (distance * 0.5) // Adjust steepness to match test expectations
-			volumes[i] = weight
-			sum += weight
-		}
-
-		// Normalize to total volume
-		for i := range volumes {
-			volumes[i] = (volumes[i] / sum) * config.TotalVolume
-		}
+// ConnectPublicWebSocket establishes only the market data connection
+func (c *Client) ConnectPublicWebSocket(ctx context.Context) error {
+	return c.public.connect(ctx)
+}
 
-	case CustomDistribution:
-		if len(config.Weights) != config.NumOrders {
-			// Fall back to even distribution if weights are invalid
-			for i := range volumes {
-				volumes[i] = config.TotalVolume / float64(config.NumOrders)
-			}
-			return volumes
-		}
+// ConnectPrivateWebSocket establishes only the authenticated trading connection
+func (c *Client) ConnectPrivateWebSocket(ctx context.Context) error {
+	return c.private.connect(ctx)
+}
 
-		// Normalize custom weights to total volume
-		sum := 0.0
-		for _, w := range config.Weights {
-			sum += w
-		}
-		for i, w := range config.Weights {
-			volumes[i] = (w / sum) * config.TotalVolume
-		}
+// Close disarms the dead man's switch, if enabled, then shuts down both
+// WebSocket connections and disables reconnection
+func (c *Client) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), REST_TIMEOUT)
+	defer cancel()
 
-	default: // EvenDistribution
-		for i := range volumes {
-			volumes[i] = config.TotalVolume / float64(config.NumOrders)
-		}
+	if err := c.DisarmDeadMansSwitch(ctx); err != nil {
+		fmt.Printf("failed to disarm dead man's switch: %v\n", err)
 	}
 
-	return volumes
-}
-
-func (c *Client) ExecuteTrailingEntry(ctx context.Context, config TrailingEntryConfig) error {
-	fmt.Printf("Placing %d %s orders between %.2f and %.2f...\n",
-		config.NumOrders, config.Side,
-		config.LowerBand, config.UpperBand, config.NumOrders, config.Side)
+	errPublic := c.public.close()
+	errPrivate := c.private.close()
 
-	volumes := calculateOrderVolumes(config)
-	priceStep := (config.UpperBand - config.LowerBand) / float64(config.NumOrders-1)
+	if errPublic != nil {
+		return errPublic
+	}
+	return errPrivate
+}
 
-	for i := 0; i < config.NumOrders; i++ {
-		var orderPrice float64
-		if config.Side == "buy" {
-			orderPrice = config.UpperBand - (float64(i) * priceStep)
-		} else {
-			orderPrice = config.LowerBand + (float64(i) * priceStep)
+// SubscribeToTicker subscribes to real-time price updates on the public
+// connection. The subscription survives reconnects and ends when ctx is done.
+// A consumer that is behind only receives the latest price.
+func (c *Client) SubscribeToTicker(ctx context.Context, pair string, priceChan chan<- float64) error {
+	send := latestRelay(ctx, priceChan)
+	return c.public.subscribe(ctx, "ticker", pair, nil, func(_ string, data json.RawMessage) {
+		var ticker struct {
+			Last float64 `json:"last"`
 		}
-
-		req := OrderRequest{
-			Pair:     config.Pair,
-			Type:     LimitOrder,
-			Side:     config.Side,
-			Volume:   strconv.FormatFloat(volumes[i], 'f', 8, 64),
-			Price:    strconv.FormatFloat(orderPrice, 'f', 2, 64),
-			Leverage: config.Leverage,
+		if err := json.Unmarshal(data, &ticker); err != nil || ticker.Last == 0 {
+			return
 		}
 
-		if _, err := c.AddOrder(ctx, req); err != nil {
-			return fmt.Errorf("failed to place order: %w", err)
-		}
+		send(ticker.Last)
+	})
+}
 
-		fmt.Printf("Placed %s order: %v %v at %v\n",
-			config.Side, volumes[i], config.Pair, orderPrice)
+// GetTickerPrice returns the last trade, best bid and ask and 24h volume
+func (c *Client) GetTickerPrice(ctx context.Context, pair string) (*TickerInfo, error) {
+	params := url.Values{}
+	params.Set("pair", restPair(pair))
+
+	var result map[string]struct {
+		Ask    []string `json:"a"`
+		Bid    []string `json:"b"`
+		Last   []string `json:"c"`
+		Volume []string `json:"v"`
+	}
+	if err := c.publicRequest(ctx, "/0/public/Ticker", params, &result); err != nil {
+		return nil, fmt.Errorf("failed to get ticker: %w", err)
 	}
 
-	return nil
-}
+	for _, t := range result {
+		if len(t.Ask) == 0 || len(t.Bid) == 0 || len(t.Last) == 0 || len(t.Volume) < 2 {
+			return nil, fmt.Errorf("incomplete ticker for %s", pair)
+		}
 
-func (c *Client) setState(state ConnectionState) {
-	c.stateLock.Lock()
-	defer c.stateLock.Unlock()
-	c.state = state
-}
+		var info TickerInfo
+		fields := []struct {
+			dst *float64
+			src string
+		}{{&info.Last, t.Last[0]}, {&info.Ask, t.Ask[0]}, {&info.Bid, t.Bid[0]}, {&info.Volume, t.Volume[1]}}
+		for _, f := range fields {
+			v, err := strconv.ParseFloat(f.src, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid ticker value %q: %w", f.src, err)
+			}
+			*f.dst = v
+		}
+		return &info, nil
+	}
 
-func (c *Client) getState() ConnectionState {
-	c.stateLock.RLock()
-	defer c.stateLock.RUnlock()
-	return c.state
+	return nil, fmt.Errorf("no ticker for %s", pair)
 }
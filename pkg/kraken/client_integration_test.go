@@ -105,7 +105,7 @@ func TestIntegration_WebSocketReconnect(t *testing.T) {
 	}
 
 	// Force disconnect
-	if err := client.ws.Close(); err != nil {
+	if err := client.public.ws.Close(); err != nil {
 		t.Logf("Close error (expected): %v", err)
 	}
 
@@ -113,7 +113,7 @@ func TestIntegration_WebSocketReconnect(t *testing.T) {
 	time.Sleep(2 * time.Second)
 
 	// Verify reconnected state
-	if client.getState() != Connected {
+	if client.State(PublicEndpoint) != Connected {
 		t.Error("Expected reconnected state")
 	}
 }
@@ -8,13 +8,16 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/gorilla/websocket"
 )
 
-// Mock WebSocket server
+// Mock WebSocket server speaking the v2 protocol. It acknowledges every
+// method call by req_id and streams ticker updates for subscribed symbols.
 type mockWSServer struct {
 	*httptest.Server
 	URL string
@@ -29,59 +32,80 @@ func newMockWSServer() *httptest.Server {
 		}
 		defer conn.Close()
 
-		// Send initial subscription confirmation
-		subscriptionMsg := map[string]interface{}{
-			"event":  "subscriptionStatus",
-			"status": "subscribed",
-			"pair":   []string{"XBT/USD"},
-			"subscription": map[string]string{
-				"name": "ticker",
-			},
-		}
-		if err := conn.WriteJSON(subscriptionMsg); err != nil {
-			return
+		var writeLock sync.Mutex
+		write := func(v interface{}) error {
+			writeLock.Lock()
+			defer writeLock.Unlock()
+			return conn.WriteJSON(v)
 		}
 
 		// Use a done channel for clean shutdown
 		done := make(chan struct{})
-		defer close(done)
+		symbols := make(chan string, 10)
+
+		// Check for client messages
+		go func() {
+			defer close(done)
+			for {
+				var req struct {
+					Method string `json:"method"`
+					Params struct {
+						Symbol []string `json:"symbol"`
+					} `json:"params"`
+					ReqID int64 `json:"req_id"`
+				}
+				if err := conn.ReadJSON(&req); err != nil {
+					return
+				}
+
+				resp := map[string]interface{}{
+					"method":  req.Method,
+					"success": true,
+					"result":  map[string]interface{}{"order_id": "OABCDE-12345-FGHIJ"},
+				}
+				if req.ReqID != 0 {
+					resp["req_id"] = req.ReqID
+				}
+				if err := write(resp); err != nil {
+					return
+				}
+
+				if req.Method == "subscribe" {
+					for _, s := range req.Params.Symbol {
+						symbols <- s
+					}
+				}
+			}
+		}()
 
 		// Send mock price updates
 		ticker := time.NewTicker(100 * time.Millisecond)
 		defer ticker.Stop()
 
+		var subscribed []string
 		for {
 			select {
+			case s := <-symbols:
+				subscribed = append(subscribed, s)
 			case <-ticker.C:
-				priceMsg := []interface{}{
-					278,
-					map[string]interface{}{
-						"a": []string{"1000.00", "1", "1.000"},
-						"b": []string{"999.00", "1", "1.000"},
-					},
-					"ticker",
-					"XBT/USD",
-				}
-				if err := conn.WriteJSON(priceMsg); err != nil {
-					select {
-					case <-done:
-						return
-					default:
+				for _, s := range subscribed {
+					priceMsg := map[string]interface{}{
+						"channel": "ticker",
+						"type":    "update",
+						"data": []map[string]interface{}{{
+							"symbol": s,
+							"bid":    999.0,
+							"ask":    1000.0,
+							"last":   1000.0,
+						}},
+					}
+					if err := write(priceMsg); err != nil {
 						log.Printf("WebSocket write error: %v", err)
+						return
 					}
-					return
 				}
 			case <-done:
 				return
-			default:
-				// Check for client messages
-				_, _, err := conn.ReadMessage()
-				if err != nil {
-					if websocket.IsUnexpectedCloseError(err) {
-						close(done)
-					}
-					return
-				}
 			}
 		}
 	}))
@@ -146,25 +170,274 @@ func TestClient_WebSocketConnection(t *testing.T) {
 	defer ws.Close()
 
 	client := NewClient("test", "test")
-	var err error
-	client.ws, _, err = websocket.DefaultDialer.Dial(ws.URL, nil)
-	if err != nil {
+	client.SetWebSocketURLs(ws.URL, ws.URL)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := client.ConnectWebSocket(ctx); err != nil {
 		t.Fatalf("Failed to connect to test server: %v", err)
 	}
-	ctx := context.Background()
+	if client.State(PublicEndpoint) != Connected || client.State(PrivateEndpoint) != Connected {
+		t.Errorf("Expected both connections to be connected")
+	}
 
 	// Test subscription
 	priceChan := make(chan float64)
-	if err := client.SubscribeToTicker(ctx, "XBTUSD", priceChan); err != nil {
+	if err := client.SubscribeToTicker(ctx, "XBT/USD", priceChan); err != nil {
 		t.Fatalf("SubscribeToTicker() error = %v", err)
 	}
 
+	select {
+	case price := <-priceChan:
+		if price != 1000.0 {
+			t.Errorf("Expected price 1000.0, got %v", price)
+		}
+	case <-ctx.Done():
+		t.Fatal("Timeout waiting for price update")
+	}
+
 	// Test cleanup
 	if err := client.Close(); err != nil {
 		t.Errorf("Close() error = %v", err)
 	}
 }
 
+func TestClient_ReconnectResubscribes(t *testing.T) {
+	var connections int32
+
+	ws := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		n := atomic.AddInt32(&connections, 1)
+
+		var req struct {
+			Method string `json:"method"`
+			Params struct {
+				Symbol []string `json:"symbol"`
+			} `json:"params"`
+		}
+		if err := conn.ReadJSON(&req); err != nil || req.Method != "subscribe" {
+			return
+		}
+
+		// Drop the first connection right after the subscription
+		if n == 1 {
+			return
+		}
+
+		conn.WriteJSON(map[string]interface{}{
+			"channel": "ticker",
+			"data": []map[string]interface{}{{
+				"symbol": req.Params.Symbol[0],
+				"last":   1234.5,
+			}},
+		})
+		conn.ReadMessage()
+	}))
+	defer ws.Close()
+
+	client := NewClient("", "")
+	client.SetWebSocketURLs(ws.URL, ws.URL)
+	client.SetReconnectPolicy(ReconnectPolicy{
+		InitialDelay: 10 * time.Millisecond,
+		Multiplier:   2,
+		MaxAttempts:  5,
+	})
+
+	states := make(chan ConnectionState, 10)
+	client.OnStateChange(func(endpoint WSEndpoint, s ConnectionState) {
+		if endpoint == PublicEndpoint {
+			states <- s
+		}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	defer client.Close()
+
+	if err := client.ConnectWebSocket(ctx); err != nil {
+		t.Fatalf("ConnectWebSocket() error = %v", err)
+	}
+
+	priceChan := make(chan float64, 1)
+	if err := client.SubscribeToTicker(ctx, "XBT/USD", priceChan); err != nil {
+		t.Fatalf("SubscribeToTicker() error = %v", err)
+	}
+
+	select {
+	case price := <-priceChan:
+		if price != 1234.5 {
+			t.Errorf("Expected price 1234.5, got %v", price)
+		}
+	case <-ctx.Done():
+		t.Fatal("Timeout waiting for price after reconnect")
+	}
+
+	if got := atomic.LoadInt32(&connections); got != 2 {
+		t.Errorf("Expected 2 connections, got %d", got)
+	}
+
+	want := []ConnectionState{Connecting, Connected, Reconnecting, Connected}
+	for i, w := range want {
+		if s := <-states; s != w {
+			t.Errorf("state[%d] = %v, want %v", i, s, w)
+		}
+	}
+}
+
+func TestClient_SharedSubscription(t *testing.T) {
+	var mu sync.Mutex
+	var methods []string
+
+	ws := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		go func() {
+			for {
+				var req struct {
+					Method string `json:"method"`
+				}
+				if err := conn.ReadJSON(&req); err != nil {
+					return
+				}
+				mu.Lock()
+				methods = append(methods, req.Method)
+				mu.Unlock()
+			}
+		}()
+
+		for i := 1; ; i++ {
+			time.Sleep(10 * time.Millisecond)
+			err := conn.WriteJSON(map[string]interface{}{
+				"channel": "ticker",
+				"data":    []map[string]interface{}{{"symbol": "XBT/USD", "last": float64(i)}},
+			})
+			if err != nil {
+				return
+			}
+		}
+	}))
+	defer ws.Close()
+
+	client := NewClient("", "")
+	client.SetWebSocketURLs(ws.URL, ws.URL)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	defer client.Close()
+
+	if err := client.ConnectPublicWebSocket(ctx); err != nil {
+		t.Fatalf("ConnectPublicWebSocket() error = %v", err)
+	}
+
+	firstCtx, stopFirst := context.WithCancel(ctx)
+	first, second := make(chan float64, 1), make(chan float64, 1)
+	if err := client.SubscribeToTicker(firstCtx, "XBT/USD", first); err != nil {
+		t.Fatalf("SubscribeToTicker() error = %v", err)
+	}
+	if err := client.SubscribeToTicker(ctx, "XBT/USD", second); err != nil {
+		t.Fatalf("SubscribeToTicker() error = %v", err)
+	}
+
+	for _, ch := range []chan float64{first, second} {
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			t.Fatal("Timeout waiting for both subscribers to get prices")
+		}
+	}
+
+	// The second subscriber keeps its feed when the first one leaves
+	stopFirst()
+	time.Sleep(50 * time.Millisecond)
+	<-second
+	select {
+	case <-second:
+	case <-ctx.Done():
+		t.Fatal("second subscriber lost its feed")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	subscribes := 0
+	for _, m := range methods {
+		switch m {
+		case "subscribe":
+			subscribes++
+		case "unsubscribe":
+			t.Error("channel unsubscribed while a subscriber remains")
+		}
+	}
+	if subscribes != 1 {
+		t.Errorf("subscribed %d times, want once for both subscribers", subscribes)
+	}
+}
+
+func TestLatestRelay(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	out := make(chan float64)
+	send := latestRelay(ctx, out)
+
+	// Nobody is reading, yet sending never blocks
+	for _, p := range []float64{1, 2, 3} {
+		send(p)
+	}
+
+	// The relay may already hold the first value; the latest one follows
+	deadline := time.After(time.Second)
+	for {
+		select {
+		case p := <-out:
+			if p == 3 {
+				return
+			}
+		case <-deadline:
+			t.Fatal("Timeout waiting for the latest value")
+		}
+	}
+}
+
+func TestBufferedRelay(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	out := make(chan int)
+	send := bufferedRelay(ctx, out, 3)
+
+	// One value may be taken out of the buffer by the relay, so five sends
+	// overflow a buffer of three
+	dropped := 0
+	for i := 1; i <= 5; i++ {
+		if !send(i) {
+			dropped++
+		}
+	}
+	if dropped == 0 {
+		t.Fatal("Expected values beyond the limit to be dropped")
+	}
+
+	for want := 1; want <= 5-dropped; want++ {
+		select {
+		case got := <-out:
+			if got != want {
+				t.Errorf("got %d, want %d", got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timeout waiting for value %d", want)
+		}
+	}
+}
+
 func TestClient_ParseTickerMessage(t *testing.T) {
 	// Sample ticker message from Kraken WebSocket
 	message := `[
@@ -239,6 +512,54 @@ func TestCalculateOrderVolumes(t *testing.T) {
 			},
 			want: []float64{0.25, 0.5, 0.25},
 		},
+		{
+			name: "pyramid distribution",
+			config: TrailingEntryConfig{
+				TotalVolume:  1.0,
+				NumOrders:    4,
+				Distribution: PyramidDistribution,
+			},
+			want: []float64{0.1, 0.2, 0.3, 0.4},
+		},
+		{
+			name: "inverse pyramid distribution",
+			config: TrailingEntryConfig{
+				TotalVolume:  1.0,
+				NumOrders:    4,
+				Distribution: InversePyramidDistribution,
+			},
+			want: []float64{0.4, 0.3, 0.2, 0.1},
+		},
+		{
+			name: "exponential distribution",
+			config: TrailingEntryConfig{
+				TotalVolume:  7.0,
+				NumOrders:    3,
+				Distribution: ExponentialDistribution,
+				Factor:       2,
+			},
+			want: []float64{1, 2, 4},
+		},
+		{
+			name: "gaussian distribution",
+			config: TrailingEntryConfig{
+				TotalVolume:  1.0,
+				NumOrders:    3,
+				Distribution: GaussianDistribution,
+				Sigma:        1,
+			},
+			// exp(-0.5) = 0.6065 at the edges, 1 in the middle
+			want: []float64{0.274, 0.452, 0.274},
+		},
+		{
+			name: "normal distribution with a single order",
+			config: TrailingEntryConfig{
+				TotalVolume:  1.0,
+				NumOrders:    1,
+				Distribution: NormalDistribution,
+			},
+			want: []float64{1.0},
+		},
 		{
 			name: "invalid custom weights falls back to even",
 			config: TrailingEntryConfig{
@@ -277,3 +598,62 @@ func TestCalculateOrderVolumes(t *testing.T) {
 		})
 	}
 }
+
+func TestReconnectPolicy_Delay(t *testing.T) {
+	policy := ReconnectPolicy{
+		InitialDelay: time.Second,
+		MaxDelay:     10 * time.Second,
+		Multiplier:   2,
+	}
+
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{attempt: 1, want: time.Second},
+		{attempt: 2, want: 2 * time.Second},
+		{attempt: 3, want: 4 * time.Second},
+		{attempt: 5, want: 10 * time.Second}, // Capped at MaxDelay
+	}
+
+	for _, tt := range tests {
+		if got := policy.delay(tt.attempt); got != tt.want {
+			t.Errorf("delay(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		got := policy.delay(2)
+		if got < time.Second || got > 3*time.Second {
+			t.Fatalf("delay(2) with jitter = %v, want within [1s, 3s]", got)
+		}
+	}
+}
+
+func TestClient_OnStateChange(t *testing.T) {
+	client := NewClient("test", "test")
+
+	var states []ConnectionState
+	client.OnStateChange(func(endpoint WSEndpoint, s ConnectionState) {
+		if endpoint != PrivateEndpoint {
+			t.Errorf("endpoint = %v, want %v", endpoint, PrivateEndpoint)
+		}
+		states = append(states, s)
+	})
+
+	client.private.setState(Connecting)
+	client.private.setState(Connected)
+	client.private.setState(Connected) // No change, no notification
+	client.private.setState(Reconnecting)
+
+	want := []ConnectionState{Connecting, Connected, Reconnecting}
+	if len(states) != len(want) {
+		t.Fatalf("got states %v, want %v", states, want)
+	}
+	for i := range want {
+		if states[i] != want[i] {
+			t.Errorf("state[%d] = %v, want %v", i, states[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package kraken
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultDCACatchUp is how late a missed DCA period may still be bought,
+// e.g. after a restart
+const DefaultDCACatchUp = time.Hour
+
+// dcaRetryDelay is how long Run waits before retrying a period whose buy
+// failed before the order was sent
+const dcaRetryDelay = time.Minute
+
+type DCAConfig struct {
+	Pair        string
+	Schedule    string        // Cron expression, see ParseSchedule
+	Notional    float64       // Quote currency spent per period
+	LimitOffset float64       // Percent below the best bid for a limit buy; 0 buys at market
+	MaxPrice    float64       // Skip periods while the last price is above this; 0 never skips
+	CatchUp     time.Duration // How late a missed period is still bought
+	StatePath   string        // File the executions are recorded in
+}
+
+// DCAExecution records what happened in one scheduled period
+type DCAExecution struct {
+	Period  time.Time `json:"period"`
+	Time    time.Time `json:"time"`
+	Price   float64   `json:"price,omitempty"`
+	Volume  float64   `json:"volume,omitempty"`
+	TxID    string    `json:"txid,omitempty"`
+	Skipped string    `json:"skipped,omitempty"` // Why nothing was bought
+	Error   string    `json:"error,omitempty"`
+}
+
+// DCAState is the persisted history of a DCA plan
+type DCAState struct {
+	Pair       string         `json:"pair"`
+	Executions []DCAExecution `json:"executions"`
+}
+
+// DCA buys a fixed notional of a pair on a schedule. Every period is
+// recorded before its order is sent, so a restart never buys the same period
+// twice.
+type DCA struct {
+	client   *Client
+	config   DCAConfig
+	schedule *Schedule
+	state    DCAState
+	mu       sync.Mutex
+}
+
+func (c *DCAConfig) Validate() error {
+	if c.Pair == "" {
+		return fmt.Errorf("pair is required")
+	}
+	if c.Notional <= 0 {
+		return fmt.Errorf("notional must be positive")
+	}
+	if c.LimitOffset < 0 || c.LimitOffset >= 100 {
+		return fmt.Errorf("limit offset must be between 0 and 100 percent")
+	}
+	if c.MaxPrice < 0 {
+		return fmt.Errorf("max price must not be negative")
+	}
+	return nil
+}
+
+// NewDCA creates a DCA plan, resuming the history saved at StatePath
+func NewDCA(client *Client, config DCAConfig) (*DCA, error) {
+	if config.CatchUp <= 0 {
+		config.CatchUp = DefaultDCACatchUp
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid DCA plan: %w", err)
+	}
+
+	schedule, err := ParseSchedule(config.Schedule)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &DCA{
+		client:   client,
+		config:   config,
+		schedule: schedule,
+		state:    DCAState{Pair: config.Pair},
+	}
+
+	if config.StatePath != "" {
+		var saved DCAState
+		found, err := loadState(config.StatePath, &saved)
+		if err != nil {
+			return nil, err
+		}
+		if found && saved.Pair == config.Pair {
+			d.state = saved
+		}
+	}
+
+	return d, nil
+}
+
+// LoadDCAState reads the history of a DCA plan without validating a config
+func LoadDCAState(path string) (DCAState, error) {
+	var state DCAState
+	if _, err := loadState(path, &state); err != nil {
+		return DCAState{}, err
+	}
+	return state, nil
+}
+
+// State returns a copy of the recorded executions
+func (d *DCA) State() DCAState {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	state := d.state
+	state.Executions = append([]DCAExecution(nil), d.state.Executions...)
+	return state
+}
+
+// NextPeriod returns the next period to buy: a missed period still within
+// CatchUp, or otherwise the next scheduled time
+func (d *DCA) NextPeriod(now time.Time) time.Time {
+	period := d.schedule.Next(now.Add(-d.config.CatchUp))
+	for !period.IsZero() && !period.After(now) && d.done(period) {
+		period = d.schedule.Next(period)
+	}
+	if !period.IsZero() && !period.After(now) {
+		return period
+	}
+	return d.schedule.Next(now)
+}
+
+// done reports whether a period has been recorded
+func (d *DCA) done(period time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, e := range d.state.Executions {
+		if e.Period.Equal(period) {
+			return true
+		}
+	}
+	return false
+}
+
+// Run buys on schedule until ctx is done
+func (d *DCA) Run(ctx context.Context) error {
+	var retryAt time.Time
+	for {
+		period := d.NextPeriod(time.Now())
+		if period.IsZero() {
+			return fmt.Errorf("schedule %q never fires", d.schedule)
+		}
+
+		wait := time.Until(period)
+		if w := time.Until(retryAt); w > wait {
+			wait = w
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+
+		exec, err := d.Execute(ctx, period)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case exec.Skipped != "":
+			fmt.Printf("DCA %s: skipped %s: %s\n", d.config.Pair, period.Format(time.RFC3339), exec.Skipped)
+		case exec.Error != "":
+			fmt.Printf("DCA %s: buy for %s failed: %s\n", d.config.Pair, period.Format(time.RFC3339), exec.Error)
+			if !d.done(period) {
+				// Nothing was sent; the period is retried while within CatchUp
+				retryAt = time.Now().Add(dcaRetryDelay)
+			}
+		default:
+			fmt.Printf("DCA %s: bought %.8f at %.2f (%s)\n", d.config.Pair, exec.Volume, exec.Price, exec.TxID)
+		}
+	}
+}
+
+// Execute buys for one period unless it has already been recorded. Order
+// failures are recorded rather than returned; the error is only for state
+// that could not be saved. A failure before the order is sent leaves the
+// period unrecorded, so it can be retried.
+func (d *DCA) Execute(ctx context.Context, period time.Time) (*DCAExecution, error) {
+	if d.done(period) {
+		return &DCAExecution{Period: period, Skipped: "already executed"}, nil
+	}
+
+	exec := DCAExecution{Period: period, Time: time.Now()}
+
+	ticker, err := d.client.GetTickerPrice(ctx, d.config.Pair)
+	if err != nil {
+		exec.Error = err.Error()
+		return &exec, nil
+	}
+
+	if d.config.MaxPrice > 0 && ticker.Last > d.config.MaxPrice {
+		exec.Skipped = fmt.Sprintf("price %.2f is above %.2f", ticker.Last, d.config.MaxPrice)
+		return &exec, d.record(exec)
+	}
+
+	req := OrderRequest{Pair: d.config.Pair, Type: MarketOrder, Side: "buy"}
+	exec.Price = ticker.Ask
+	if d.config.LimitOffset > 0 {
+		info, err := d.client.assetPair(ctx, d.config.Pair)
+		if err != nil {
+			exec.Error = err.Error()
+			return &exec, nil
+		}
+		exec.Price = info.RoundPrice(ticker.Bid * (1 - d.config.LimitOffset/100))
+		req.Type = LimitOrder
+		req.Price = info.FormatPrice(exec.Price)
+	}
+	exec.Volume = d.config.Notional / exec.Price
+	req.Volume = strconv.FormatFloat(exec.Volume, 'f', 8, 64)
+
+	// Claim the period before sending, so that a crash in between misses
+	// one buy instead of repeating it
+	if err := d.record(exec); err != nil {
+		return nil, err
+	}
+
+	resp, err := d.client.AddOrder(ctx, req)
+	if err != nil {
+		exec.Error = err.Error()
+	} else if len(resp.TransactionIds) > 0 {
+		exec.TxID = resp.TransactionIds[0]
+	}
+
+	return &exec, d.record(exec)
+}
+
+// record adds or replaces the execution for its period and saves the state
+func (d *DCA) record(exec DCAExecution) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	replaced := false
+	for i, e := range d.state.Executions {
+		if e.Period.Equal(exec.Period) {
+			d.state.Executions[i] = exec
+			replaced = true
+		}
+	}
+	if !replaced {
+		d.state.Executions = append(d.state.Executions, exec)
+	}
+
+	if d.config.StatePath == "" {
+		return nil
+	}
+	return saveState(d.config.StatePath, d.state)
+}
@@ -0,0 +1,194 @@
+package kraken
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newMockDCAServer serves a fixed ticker and records AddOrder calls
+func newMockDCAServer(t *testing.T) (*httptest.Server, func() []url.Values) {
+	var mu sync.Mutex
+	var orders []url.Values
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/0/public/Ticker":
+			w.Write([]byte(`{"error":[],"result":{"XXBTZUSD":{"a":["50010.0","1","1.000"],
+				"b":["50000.0","2","2.000"],"c":["50005.0","0.1"],"v":["10.5","120.25"]}}}`))
+		case "/0/public/AssetPairs":
+			w.Write([]byte(mockAssetPair))
+		case "/0/private/AddOrder":
+			r.ParseForm()
+			mu.Lock()
+			orders = append(orders, r.Form)
+			n := len(orders)
+			mu.Unlock()
+			fmt.Fprintf(w, `{"error":[],"result":{"descr":{"order":"buy"},"txid":["TX-%d"]}}`, n)
+		default:
+			t.Errorf("unexpected request to %s", r.URL.Path)
+		}
+	}))
+
+	return server, func() []url.Values {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]url.Values(nil), orders...)
+	}
+}
+
+func TestClient_GetTickerPrice(t *testing.T) {
+	server, _ := newMockDCAServer(t)
+	defer server.Close()
+
+	client := NewTestClient(t, &TestConfig{DemoAPIURL: server.URL})
+	ticker, err := client.GetTickerPrice(context.Background(), "XBT/USD")
+	if err != nil {
+		t.Fatalf("GetTickerPrice() error = %v", err)
+	}
+
+	want := TickerInfo{Last: 50005, Ask: 50010, Bid: 50000, Volume: 120.25}
+	if *ticker != want {
+		t.Errorf("GetTickerPrice() = %+v, want %+v", *ticker, want)
+	}
+}
+
+func TestDCA_Execute(t *testing.T) {
+	server, orders := newMockDCAServer(t)
+	defer server.Close()
+
+	client := NewTestClient(t, &TestConfig{DemoAPIURL: server.URL})
+	config := DCAConfig{
+		Pair:        "XBT/USD",
+		Schedule:    "0 9 * * 1",
+		Notional:    100,
+		LimitOffset: 1,
+		StatePath:   filepath.Join(t.TempDir(), "dca.json"),
+	}
+
+	dca, err := NewDCA(client, config)
+	if err != nil {
+		t.Fatalf("NewDCA() error = %v", err)
+	}
+
+	period := time.Date(2024, 5, 20, 9, 0, 0, 0, time.UTC)
+	exec, err := dca.Execute(context.Background(), period)
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if exec.TxID != "TX-1" || exec.Price != 49500 {
+		t.Errorf("execution = %+v", exec)
+	}
+
+	placed := orders()
+	if len(placed) != 1 || placed[0].Get("ordertype") != "limit" || placed[0].Get("price") != "49500.00" ||
+		placed[0].Get("volume") != "0.00202020" {
+		t.Fatalf("orders = %v", placed)
+	}
+
+	// A restarted plan does not buy the same period again
+	resumed, err := NewDCA(client, config)
+	if err != nil {
+		t.Fatalf("NewDCA() error = %v", err)
+	}
+	exec, err = resumed.Execute(context.Background(), period)
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if exec.Skipped == "" || len(orders()) != 1 {
+		t.Errorf("period bought twice: %+v", exec)
+	}
+	if got := resumed.State().Executions; len(got) != 1 || got[0].TxID != "TX-1" {
+		t.Errorf("executions = %+v", got)
+	}
+}
+
+func TestDCA_SkipsAboveMaxPrice(t *testing.T) {
+	server, orders := newMockDCAServer(t)
+	defer server.Close()
+
+	client := NewTestClient(t, &TestConfig{DemoAPIURL: server.URL})
+	dca, err := NewDCA(client, DCAConfig{Pair: "XBT/USD", Schedule: "@daily", Notional: 100, MaxPrice: 45000})
+	if err != nil {
+		t.Fatalf("NewDCA() error = %v", err)
+	}
+
+	exec, err := dca.Execute(context.Background(), time.Date(2024, 5, 20, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if exec.Skipped == "" || len(orders()) != 0 {
+		t.Errorf("execution = %+v, want a skip without orders", exec)
+	}
+	if len(dca.State().Executions) != 1 {
+		t.Error("skipped period should be recorded")
+	}
+}
+
+func TestDCA_TickerFailureNotRecorded(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/0/public/Ticker" {
+			t.Errorf("unexpected request to %s", r.URL.Path)
+		}
+		w.Write([]byte(`{"error":["EService:Unavailable"]}`))
+	}))
+	defer server.Close()
+
+	client := NewTestClient(t, &TestConfig{DemoAPIURL: server.URL})
+	dca, err := NewDCA(client, DCAConfig{Pair: "XBT/USD", Schedule: "@daily", Notional: 100})
+	if err != nil {
+		t.Fatalf("NewDCA() error = %v", err)
+	}
+
+	period := time.Date(2024, 5, 20, 0, 0, 0, 0, time.UTC)
+	exec, err := dca.Execute(context.Background(), period)
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if exec.Error == "" {
+		t.Errorf("execution = %+v, want the ticker error", exec)
+	}
+
+	// Nothing was sent, so the period is still open for a retry
+	if got := dca.State().Executions; len(got) != 0 {
+		t.Errorf("executions = %+v, want none", got)
+	}
+	if dca.done(period) {
+		t.Error("period should not count as executed")
+	}
+}
+
+func TestDCA_NextPeriod(t *testing.T) {
+	dca, err := NewDCA(nil, DCAConfig{Pair: "XBT/USD", Schedule: "0 * * * *", Notional: 100, CatchUp: 30 * time.Minute})
+	if err != nil {
+		t.Fatalf("NewDCA() error = %v", err)
+	}
+
+	now := time.Date(2024, 5, 20, 9, 20, 0, 0, time.UTC)
+	missed := time.Date(2024, 5, 20, 9, 0, 0, 0, time.UTC)
+	next := time.Date(2024, 5, 20, 10, 0, 0, 0, time.UTC)
+
+	if got := dca.NextPeriod(now); !got.Equal(missed) {
+		t.Errorf("NextPeriod() = %v, want the missed %v", got, missed)
+	}
+
+	// Too late to catch up
+	if got := dca.NextPeriod(missed.Add(45 * time.Minute)); !got.Equal(next) {
+		t.Errorf("NextPeriod() = %v, want %v", got, next)
+	}
+
+	dca.record(DCAExecution{Period: missed})
+	if got := dca.NextPeriod(now); !got.Equal(next) {
+		t.Errorf("NextPeriod() = %v, want %v once the missed period is done", got, next)
+	}
+
+	if _, err := NewDCA(nil, DCAConfig{Pair: "XBT/USD", Schedule: "bad", Notional: 100}); err == nil {
+		t.Error("NewDCA() should reject an invalid schedule")
+	}
+}
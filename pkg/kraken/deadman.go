@@ -0,0 +1,171 @@
+package kraken
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// DeadMansSwitch makes Kraken cancel all open orders if the client stops
+// refreshing the countdown, e.g. because the process died
+type DeadMansSwitch struct {
+	Timeout      time.Duration // Countdown re-armed on every heartbeat
+	UseWebSocket bool          // Arm over the private WebSocket instead of REST
+}
+
+// DeadMansSwitchStatus reports when the exchange will cancel all orders. A
+// zero TriggerTime means the switch is disarmed.
+type DeadMansSwitchStatus struct {
+	CurrentTime time.Time
+	TriggerTime time.Time
+}
+
+func (s *DeadMansSwitchStatus) UnmarshalJSON(b []byte) error {
+	var raw struct {
+		CurrentTime string `json:"currentTime"`
+		TriggerTime string `json:"triggerTime"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+
+	var err error
+	if s.CurrentTime, err = time.Parse(time.RFC3339, raw.CurrentTime); err != nil {
+		return fmt.Errorf("invalid currentTime: %w", err)
+	}
+
+	// Kraken reports "0" once the switch has been disarmed
+	if raw.TriggerTime != "" && raw.TriggerTime != "0" {
+		if s.TriggerTime, err = time.Parse(time.RFC3339, raw.TriggerTime); err != nil {
+			return fmt.Errorf("invalid triggerTime: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Validate checks that the countdown outlives the gap between heartbeats
+func (d DeadMansSwitch) Validate() error {
+	if d.Timeout <= HeartbeatInterval {
+		return fmt.Errorf("dead man's switch timeout must be longer than the %v heartbeat interval", HeartbeatInterval)
+	}
+	if d.Timeout > 24*time.Hour {
+		return fmt.Errorf("dead man's switch timeout must not exceed 24h")
+	}
+	return nil
+}
+
+// CancelAllOrdersAfter arms the exchange-side countdown via REST. A zero
+// timeout disarms it.
+func (c *Client) CancelAllOrdersAfter(ctx context.Context, timeout time.Duration) (*DeadMansSwitchStatus, error) {
+	data := url.Values{}
+	data.Set("timeout", strconv.Itoa(int(timeout.Seconds())))
+
+	var result DeadMansSwitchStatus
+	if err := c.privateRequest(ctx, "/0/private/CancelAllOrdersAfter", data, &result); err != nil {
+		return nil, fmt.Errorf("failed to set dead man's switch: %w", err)
+	}
+
+	return &result, nil
+}
+
+// CancelAllOrdersAfterWS arms the exchange-side countdown via WebSocket. A
+// zero timeout disarms it.
+func (c *Client) CancelAllOrdersAfterWS(ctx context.Context, timeout time.Duration) (*DeadMansSwitchStatus, error) {
+	params := struct {
+		Timeout int    `json:"timeout"`
+		Token   string `json:"token"`
+	}{
+		Timeout: int(timeout.Seconds()),
+	}
+
+	var result DeadMansSwitchStatus
+	if err := c.privateWS(ctx, "cancel_all_orders_after", &params.Token, &params, &result); err != nil {
+		return nil, fmt.Errorf("failed to set dead man's switch: %w", err)
+	}
+
+	return &result, nil
+}
+
+// EnableDeadMansSwitch arms the switch now and re-arms it on every heartbeat
+// of the private WebSocket connection until it is disarmed
+func (c *Client) EnableDeadMansSwitch(ctx context.Context, cfg DeadMansSwitch) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	c.deadManLock.Lock()
+	defer c.deadManLock.Unlock()
+
+	if err := c.setDeadMansSwitch(ctx, cfg, cfg.Timeout); err != nil {
+		return err
+	}
+	c.deadMan = &cfg
+	return nil
+}
+
+// DisarmDeadMansSwitch stops re-arming the switch and cancels the countdown
+// so that resting orders survive a graceful shutdown. It waits for a refresh
+// in flight so that the countdown cannot be re-armed after it returns.
+func (c *Client) DisarmDeadMansSwitch(ctx context.Context) error {
+	c.deadManLock.Lock()
+	defer c.deadManLock.Unlock()
+
+	cfg := c.deadMan
+	c.deadMan = nil
+	if cfg == nil {
+		return nil
+	}
+
+	return c.setDeadMansSwitch(ctx, *cfg, 0)
+}
+
+// armDeadMansSwitch refreshes the countdown if the switch is enabled
+func (c *Client) armDeadMansSwitch(ctx context.Context) error {
+	c.deadManLock.Lock()
+	defer c.deadManLock.Unlock()
+
+	if c.deadMan == nil {
+		return nil
+	}
+
+	return c.setDeadMansSwitch(ctx, *c.deadMan, c.deadMan.Timeout)
+}
+
+// setDeadMansSwitch sends the countdown over the transport cfg selects. The
+// caller holds deadManLock.
+func (c *Client) setDeadMansSwitch(ctx context.Context, cfg DeadMansSwitch, timeout time.Duration) error {
+	var err error
+	if cfg.UseWebSocket {
+		_, err = c.CancelAllOrdersAfterWS(ctx, timeout)
+	} else {
+		_, err = c.CancelAllOrdersAfter(ctx, timeout)
+	}
+	return err
+}
+
+// refreshDeadMansSwitch is called from the private connection's heartbeat
+func (c *Client) refreshDeadMansSwitch(ctx context.Context) {
+	if err := c.armDeadMansSwitch(ctx); err != nil {
+		fmt.Printf("failed to refresh dead man's switch: %v\n", err)
+	}
+}
+
+// refreshDeadMansSwitchLoop refreshes the countdown once per signal on
+// refresh until stop is closed. Signals arriving while a refresh is running
+// are coalesced.
+func (c *Client) refreshDeadMansSwitchLoop(ctx context.Context, refresh <-chan struct{}, stop <-chan struct{}) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-stop:
+			return
+		case <-refresh:
+			c.refreshDeadMansSwitch(ctx)
+		}
+	}
+}
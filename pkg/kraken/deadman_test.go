@@ -0,0 +1,154 @@
+package kraken
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDeadMansSwitch_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		wantErr bool
+	}{
+		{name: "valid", timeout: time.Minute, wantErr: false},
+		{name: "shorter than heartbeat", timeout: HeartbeatInterval, wantErr: true},
+		{name: "longer than a day", timeout: 25 * time.Hour, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := DeadMansSwitch{Timeout: tt.timeout}.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestClient_DeadMansSwitch(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		timeouts []string
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/0/private/CancelAllOrdersAfter" {
+			t.Errorf("Expected to request '/0/private/CancelAllOrdersAfter', got: %s", r.URL.Path)
+		}
+		r.ParseForm()
+
+		mu.Lock()
+		timeouts = append(timeouts, r.Form.Get("timeout"))
+		mu.Unlock()
+
+		trigger := `"2024-01-01T00:01:00Z"`
+		if r.Form.Get("timeout") == "0" {
+			trigger = `"0"`
+		}
+		w.Write([]byte(`{"error":[],"result":{"currentTime":"2024-01-01T00:00:00Z","triggerTime":` + trigger + `}}`))
+	}))
+	defer server.Close()
+
+	client := NewTestClient(t, &TestConfig{DemoAPIKey: "test", DemoAPISecret: "test", DemoAPIURL: server.URL})
+	ctx := context.Background()
+
+	if err := client.EnableDeadMansSwitch(ctx, DeadMansSwitch{Timeout: time.Minute}); err != nil {
+		t.Fatalf("EnableDeadMansSwitch() error = %v", err)
+	}
+
+	// Simulate a heartbeat of the private connection
+	client.refreshDeadMansSwitch(ctx)
+
+	// Graceful shutdown disarms the switch
+	if err := client.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	// Once disarmed, heartbeats no longer re-arm it
+	client.refreshDeadMansSwitch(ctx)
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{"60", "60", "0"}
+	if len(timeouts) != len(want) {
+		t.Fatalf("timeouts = %v, want %v", timeouts, want)
+	}
+	for i := range want {
+		if timeouts[i] != want[i] {
+			t.Errorf("timeout[%d] = %v, want %v", i, timeouts[i], want[i])
+		}
+	}
+}
+
+func TestClient_DisarmWaitsForRefresh(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		timeouts []string
+	)
+	refreshing := make(chan struct{})
+	release := make(chan struct{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+
+		mu.Lock()
+		timeouts = append(timeouts, r.Form.Get("timeout"))
+		n := len(timeouts)
+		mu.Unlock()
+
+		// Hold the heartbeat refresh until disarm has been requested
+		if n == 2 {
+			close(refreshing)
+			<-release
+		}
+		w.Write([]byte(`{"error":[],"result":{"currentTime":"2024-01-01T00:00:00Z","triggerTime":"0"}}`))
+	}))
+	defer server.Close()
+
+	client := NewTestClient(t, &TestConfig{DemoAPIKey: "test", DemoAPISecret: "test", DemoAPIURL: server.URL})
+	ctx := context.Background()
+
+	if err := client.EnableDeadMansSwitch(ctx, DeadMansSwitch{Timeout: time.Minute}); err != nil {
+		t.Fatalf("EnableDeadMansSwitch() error = %v", err)
+	}
+
+	go client.refreshDeadMansSwitch(ctx)
+	<-refreshing
+
+	disarmed := make(chan error, 1)
+	go func() { disarmed <- client.DisarmDeadMansSwitch(ctx) }()
+
+	select {
+	case <-disarmed:
+		t.Fatal("DisarmDeadMansSwitch() returned while a refresh was in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	if err := <-disarmed; err != nil {
+		t.Fatalf("DisarmDeadMansSwitch() error = %v", err)
+	}
+
+	// The disarm is the last request the exchange sees
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{"60", "60", "0"}
+	if len(timeouts) != len(want) || timeouts[2] != "0" {
+		t.Errorf("timeouts = %v, want %v", timeouts, want)
+	}
+}
+
+func TestDeadMansSwitchStatus_Unmarshal(t *testing.T) {
+	var status DeadMansSwitchStatus
+	if err := status.UnmarshalJSON([]byte(`{"currentTime":"2024-01-01T00:00:00Z","triggerTime":"0"}`)); err != nil {
+		t.Fatalf("UnmarshalJSON() error = %v", err)
+	}
+	if !status.TriggerTime.IsZero() {
+		t.Errorf("TriggerTime = %v, want zero for a disarmed switch", status.TriggerTime)
+	}
+}
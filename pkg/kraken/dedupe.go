@@ -0,0 +1,159 @@
+package kraken
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultDedupeWindow is how long an alert ID is remembered
+const DefaultDedupeWindow = 24 * time.Hour
+
+// AlertRecord is the remembered outcome of an alert
+type AlertRecord struct {
+	ID         string    `json:"id"`
+	ReceivedAt time.Time `json:"received_at"`
+	Done       bool      `json:"done"`
+	Status     int       `json:"status,omitempty"`
+	Body       string    `json:"body,omitempty"`
+}
+
+// AlertID identifies an alert: its explicit id, or otherwise a hash of the
+// payload, which includes the bar time when the alert sends one
+func AlertID(alert *TradingViewAlert) string {
+	if alert.ID != "" {
+		return alert.ID
+	}
+
+	payload := *alert
+	payload.Passphrase = ""
+	data, _ := json.Marshal(payload)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:16])
+}
+
+// alertClOrdID derives a UUID from key for an order's cl_ord_id, so that the
+// order can be looked up before it is tried again
+func alertClOrdID(id string) string {
+	return strategyClOrdID("", id)
+}
+
+// strategyClOrdID is alertClOrdID with the first six bytes taken from the
+// strategy, so that the open orders of a strategy's alerts can be told apart
+// by prefix (see strategyTag). Kraken does not accept a userref alongside a
+// cl_ord_id, so the strategy cannot be tagged there.
+func strategyClOrdID(strategy, id string) string {
+	b := sha256.Sum256([]byte(id))
+	if strategy != "" {
+		tag := sha256.Sum256([]byte(strategy))
+		copy(b[:6], tag[:6])
+	}
+	b[6] = (b[6] & 0x0f) | 0x50 // Name-based version
+	b[8] = (b[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// strategyTag is the prefix of the cl_ord_ids of a strategy's orders
+func strategyTag(strategy string) string {
+	return strategyClOrdID(strategy, "")[:13]
+}
+
+// AlertDeduper remembers recent alert IDs and their results, persisted to a
+// JSON file so that repeats are recognised across restarts
+type AlertDeduper struct {
+	path    string
+	window  time.Duration
+	records map[string]AlertRecord
+	mu      sync.Mutex
+}
+
+// NewAlertDeduper loads the alerts seen within window from path. An empty
+// path keeps them in memory only.
+func NewAlertDeduper(path string, window time.Duration) (*AlertDeduper, error) {
+	if window <= 0 {
+		window = DefaultDedupeWindow
+	}
+
+	d := &AlertDeduper{
+		path:    path,
+		window:  window,
+		records: make(map[string]AlertRecord),
+	}
+
+	if path != "" {
+		var records []AlertRecord
+		if _, err := loadState(path, &records); err != nil {
+			return nil, err
+		}
+		for _, r := range records {
+			d.records[r.ID] = r
+		}
+	}
+
+	return d, nil
+}
+
+// Begin claims an alert ID. For an ID seen within the window it returns the
+// earlier record and false instead.
+func (d *AlertDeduper) Begin(id string, now time.Time) (AlertRecord, bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for key, r := range d.records {
+		if now.Sub(r.ReceivedAt) > d.window {
+			delete(d.records, key)
+		}
+	}
+
+	if r, ok := d.records[id]; ok {
+		return r, false, nil
+	}
+
+	d.records[id] = AlertRecord{ID: id, ReceivedAt: now}
+	return AlertRecord{}, true, d.save()
+}
+
+// Finish records the response to a claimed alert. Failures are recorded
+// too: an order whose response was lost may still have reached the
+// exchange, and only Release makes the ID available to a retry.
+func (d *AlertDeduper) Finish(id string, status int, body string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	r, ok := d.records[id]
+	if !ok {
+		return nil
+	}
+
+	r.Done, r.Status, r.Body = true, status, body
+	d.records[id] = r
+	return d.save()
+}
+
+// Release forgets a claimed alert that failed before any of its orders was
+// sent, so that a retry can try again
+func (d *AlertDeduper) Release(id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.records[id]; !ok {
+		return nil
+	}
+	delete(d.records, id)
+	return d.save()
+}
+
+func (d *AlertDeduper) save() error {
+	if d.path == "" {
+		return nil
+	}
+
+	records := make([]AlertRecord, 0, len(d.records))
+	for _, r := range d.records {
+		records = append(records, r)
+	}
+	return saveState(d.path, records)
+}
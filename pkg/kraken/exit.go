@@ -0,0 +1,241 @@
+package kraken
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// exitOrder is one resting take-profit order of an exit ladder
+type exitOrder struct {
+	OrderID string
+	Price   float64
+	Volume  float64
+	Filled  float64
+}
+
+// ExitLadder follows the fills of an entry ladder and places take-profit
+// orders for each of them. It tracks the position built by the entry so that
+// resting exits are cancelled once the position is closed elsewhere.
+type ExitLadder struct {
+	client   *Client
+	pair     string
+	side     string // Side of the entry
+	userRef  int64  // Tag of the entry rungs
+	margin   bool   // The entry is leveraged; exits reduce the margin position
+	targets  []float64
+	shares   []float64
+	position float64
+	exits    []*exitOrder
+	mu       sync.Mutex
+}
+
+// validateExitTargets checks the exit ladder part of an entry config
+func validateExitTargets(config TrailingEntryConfig) error {
+	for _, t := range config.ExitTargets {
+		if t <= 0 {
+			return fmt.Errorf("exit targets must be positive percentages")
+		}
+	}
+	if len(config.ExitWeights) > 0 && len(config.ExitWeights) != len(config.ExitTargets) {
+		return fmt.Errorf("got %d exit weights for %d exit targets", len(config.ExitWeights), len(config.ExitTargets))
+	}
+	for _, w := range config.ExitWeights {
+		if w <= 0 {
+			return fmt.Errorf("exit weights must be positive")
+		}
+	}
+	return nil
+}
+
+// NewExitLadder creates the exit ladder for an entry config with ExitTargets
+// and a UserRef identifying its rungs
+func NewExitLadder(client *Client, config TrailingEntryConfig) (*ExitLadder, error) {
+	if len(config.ExitTargets) == 0 {
+		return nil, fmt.Errorf("no exit targets")
+	}
+	if config.UserRef == 0 {
+		return nil, fmt.Errorf("exit ladder needs the entry's userref")
+	}
+	if err := validateExitTargets(config); err != nil {
+		return nil, err
+	}
+
+	weights := config.ExitWeights
+	if len(weights) == 0 {
+		weights = make([]float64, len(config.ExitTargets))
+		for i := range weights {
+			weights[i] = 1
+		}
+	}
+
+	total := 0.0
+	for _, w := range weights {
+		total += w
+	}
+	shares := make([]float64, len(weights))
+	for i, w := range weights {
+		shares[i] = w / total
+	}
+
+	return &ExitLadder{
+		client:  client,
+		pair:    config.Pair,
+		side:    config.Side,
+		userRef: config.UserRef,
+		margin:  config.Leverage != "" && Leverage(config.Leverage) != NoLeverage,
+		targets: config.ExitTargets,
+		shares:  shares,
+	}, nil
+}
+
+// Position is the entry volume not yet closed
+func (e *ExitLadder) Position() float64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.position
+}
+
+// Run handles executions until ctx is done or execs is closed
+func (e *ExitLadder) Run(ctx context.Context, execs <-chan Execution) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case exec, ok := <-execs:
+			if !ok {
+				return nil
+			}
+			if err := e.handle(ctx, exec); err != nil {
+				fmt.Printf("exit ladder for %s: %v\n", e.pair, err)
+			}
+		}
+	}
+}
+
+// handle applies one execution: entry fills open exits, exit fills and
+// other trades against the position shrink it. Orders are sent without
+// holding the lock.
+func (e *ExitLadder) handle(ctx context.Context, exec Execution) error {
+	if exec.ExecType != "trade" || exec.LastQty <= 0 {
+		return nil
+	}
+
+	e.mu.Lock()
+	if exec.OrderUserref == e.userRef && exec.Side == e.side {
+		e.position += exec.LastQty
+		e.mu.Unlock()
+		return e.placeExits(ctx, exec.LastQty, exec.LastPrice)
+	}
+
+	if exec.Symbol != e.pair || exec.Side == e.side {
+		e.mu.Unlock()
+		return nil
+	}
+
+	for _, exit := range e.exits {
+		if exit.OrderID == exec.OrderID {
+			exit.Filled += exec.LastQty
+			e.position -= exec.LastQty
+			e.mu.Unlock()
+			return nil
+		}
+	}
+
+	// The position was reduced by an order that is not ours
+	e.position -= exec.LastQty
+	closed := e.position < minRemainingVolume
+	e.mu.Unlock()
+
+	if closed {
+		fmt.Printf("Position in %s closed elsewhere, cancelling take-profit orders\n", e.pair)
+		return e.cancelExits(ctx)
+	}
+	return nil
+}
+
+// placeExits splits a fill over the targets
+func (e *ExitLadder) placeExits(ctx context.Context, qty, price float64) error {
+	exitSide := "sell"
+	if e.side == "sell" {
+		exitSide = "buy"
+	}
+
+	info, err := e.client.assetPair(ctx, e.pair)
+	if err != nil {
+		return fmt.Errorf("failed to place take-profit orders: %w", err)
+	}
+
+	var errs []error
+	for i, target := range e.targets {
+		volume := qty * e.shares[i]
+		if volume < minRemainingVolume {
+			continue
+		}
+
+		exitPrice := price * (1 + target/100)
+		if e.side == "sell" {
+			exitPrice = price * (1 - target/100)
+		}
+		exitPrice = info.RoundPrice(exitPrice)
+
+		result, err := e.client.AddOrderWS(ctx, WSOrderRequest{
+			OrderType:  string(LimitOrder),
+			Side:       exitSide,
+			OrderQty:   volume,
+			Symbol:     e.pair,
+			LimitPrice: exitPrice,
+			Margin:     e.margin,
+			ReduceOnly: e.margin,
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to place take-profit at %.2f: %w", exitPrice, err))
+			continue
+		}
+
+		e.mu.Lock()
+		e.exits = append(e.exits, &exitOrder{OrderID: result.OrderID, Price: exitPrice, Volume: volume})
+		e.mu.Unlock()
+		fmt.Printf("Placed take-profit %s order: %v %v at %v\n", exitSide, volume, e.pair, exitPrice)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%d of %d take-profit orders failed, first: %w", len(errs), len(e.targets), errs[0])
+	}
+	return nil
+}
+
+// cancelExits cancels every take-profit order that has not fully filled
+func (e *ExitLadder) cancelExits(ctx context.Context) error {
+	e.mu.Lock()
+	var ids []string
+	for _, exit := range e.exits {
+		if exit.Volume-exit.Filled >= minRemainingVolume {
+			ids = append(ids, exit.OrderID)
+		}
+	}
+	e.mu.Unlock()
+	if len(ids) == 0 {
+		return nil
+	}
+
+	if err := e.client.CancelOrderWS(ctx, WSCancelRequest{OrderIDs: ids}); err != nil {
+		return fmt.Errorf("failed to cancel take-profit orders: %w", err)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	cancelled := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		cancelled[id] = true
+	}
+	var kept []*exitOrder
+	for _, exit := range e.exits {
+		if !cancelled[exit.OrderID] {
+			kept = append(kept, exit)
+		}
+	}
+	e.exits = kept
+	e.position = 0
+	return nil
+}
@@ -0,0 +1,148 @@
+package kraken
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestNewExitLadder_Validation(t *testing.T) {
+	base := TrailingEntryConfig{Pair: "BTC/USD", Side: "buy", UserRef: 7, ExitTargets: []float64{1, 2}}
+
+	tests := []struct {
+		name   string
+		modify func(*TrailingEntryConfig)
+	}{
+		{"no targets", func(c *TrailingEntryConfig) { c.ExitTargets = nil }},
+		{"no userref", func(c *TrailingEntryConfig) { c.UserRef = 0 }},
+		{"negative target", func(c *TrailingEntryConfig) { c.ExitTargets = []float64{1, -2} }},
+		{"weights mismatch", func(c *TrailingEntryConfig) { c.ExitWeights = []float64{1} }},
+		{"zero weight", func(c *TrailingEntryConfig) { c.ExitWeights = []float64{1, 0} }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := base
+			tt.modify(&config)
+			if _, err := NewExitLadder(nil, config); err == nil {
+				t.Error("NewExitLadder() should fail")
+			}
+		})
+	}
+}
+
+func TestExitLadder_PlacesProportionalExits(t *testing.T) {
+	client, received, cleanup := newOrderTestClient(t, map[string]interface{}{
+		"add_order": map[string]interface{}{"order_id": "OTP-1"},
+	})
+	defer cleanup()
+
+	exits, err := NewExitLadder(client, TrailingEntryConfig{
+		Pair:        "BTC/USD",
+		Side:        "sell",
+		UserRef:     7,
+		ExitTargets: []float64{1, 2},
+		ExitWeights: []float64{1, 3},
+	})
+	if err != nil {
+		t.Fatalf("NewExitLadder() error = %v", err)
+	}
+
+	ctx := context.Background()
+
+	// Trades of other orders and non-trade updates are ignored
+	exits.handle(ctx, Execution{ExecType: "new", OrderUserref: 7, Side: "sell", LastQty: 2})
+	exits.handle(ctx, Execution{ExecType: "trade", OrderUserref: 8, Symbol: "ETH/USD", Side: "sell", LastQty: 2})
+
+	if err := exits.handle(ctx, Execution{
+		ExecType: "trade", OrderUserref: 7, Symbol: "BTC/USD", Side: "sell", LastQty: 2, LastPrice: 1000,
+	}); err != nil {
+		t.Fatalf("handle() error = %v", err)
+	}
+
+	want := []struct{ qty, price float64 }{{0.5, 990}, {1.5, 980}}
+	for _, w := range want {
+		select {
+		case params := <-received:
+			if params["method"] != "add_order" || params["side"] != "buy" ||
+				params["order_qty"] != w.qty || params["limit_price"] != w.price {
+				t.Errorf("exit order = %v, want buy %v at %v", params, w.qty, w.price)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("take-profit order not placed")
+		}
+	}
+	if exits.Position() != 2 {
+		t.Errorf("Position() = %v, want 2", exits.Position())
+	}
+}
+
+func TestExitLadder_LeveragedExitsReduceOnly(t *testing.T) {
+	client, received, cleanup := newOrderTestClient(t, map[string]interface{}{
+		"add_order": map[string]interface{}{"order_id": "OTP-1"},
+	})
+	defer cleanup()
+
+	exits, err := NewExitLadder(client, TrailingEntryConfig{
+		Pair:        "BTC/USD",
+		Side:        "sell",
+		Leverage:    "2",
+		UserRef:     7,
+		ExitTargets: []float64{1},
+	})
+	if err != nil {
+		t.Fatalf("NewExitLadder() error = %v", err)
+	}
+
+	exits.handle(context.Background(), Execution{ExecType: "trade", OrderUserref: 7, Symbol: "BTC/USD", Side: "sell", LastQty: 1, LastPrice: 1000})
+	if params := <-received; params["side"] != "buy" || params["margin"] != true || params["reduce_only"] != true {
+		t.Errorf("exit of a short = %v, want a reduce-only margin buy", params)
+	}
+}
+
+func TestExitLadder_CancelsWhenClosedElsewhere(t *testing.T) {
+	client, received, cleanup := newOrderTestClient(t, map[string]interface{}{
+		"add_order": map[string]interface{}{"order_id": "OTP-1"},
+	})
+	defer cleanup()
+
+	exits, err := NewExitLadder(client, TrailingEntryConfig{
+		Pair:        "BTC/USD",
+		Side:        "buy",
+		UserRef:     7,
+		ExitTargets: []float64{5},
+	})
+	if err != nil {
+		t.Fatalf("NewExitLadder() error = %v", err)
+	}
+
+	ctx := context.Background()
+	exits.handle(ctx, Execution{ExecType: "trade", OrderUserref: 7, Symbol: "BTC/USD", Side: "buy", LastQty: 1, LastPrice: 100})
+	if params := <-received; params["limit_price"] != 105.0 {
+		t.Fatalf("exit order = %v, want a sell at 105", params)
+	}
+
+	// A partial manual close leaves the take-profit resting
+	exits.handle(ctx, Execution{ExecType: "trade", OrderID: "OMANUAL", Symbol: "BTC/USD", Side: "sell", LastQty: 0.4})
+	select {
+	case params := <-received:
+		t.Fatalf("unexpected call %v", params)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := exits.handle(ctx, Execution{ExecType: "trade", OrderID: "OMANUAL", Symbol: "BTC/USD", Side: "sell", LastQty: 0.6}); err != nil {
+		t.Fatalf("handle() error = %v", err)
+	}
+	select {
+	case params := <-received:
+		ids, _ := params["order_id"].([]interface{})
+		if params["method"] != "cancel_order" || len(ids) != 1 || ids[0] != "OTP-1" {
+			t.Errorf("cancel = %v, want cancel_order of OTP-1", params)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("take-profit orders not cancelled")
+	}
+	if exits.Position() != 0 {
+		t.Errorf("Position() = %v, want 0", exits.Position())
+	}
+}
@@ -0,0 +1,525 @@
+package kraken
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type GridStatus string
+
+const (
+	GridRunning GridStatus = "running"
+	GridStopped GridStatus = "stopped"
+)
+
+// DefaultGridPollInterval is how often a running grid polls its orders
+const DefaultGridPollInterval = 30 * time.Second
+
+// errGridLocked means another process is following the grid
+var errGridLocked = errors.New("grid is locked")
+
+type GridConfig struct {
+	Pair       string       `json:"pair"`
+	LowerPrice float64      `json:"lower_price"`
+	UpperPrice float64      `json:"upper_price"`
+	Levels     int          `json:"levels"`  // Grid lines, including both ends
+	Volume     float64      `json:"volume"`  // Base volume of every order
+	Spacing    PriceSpacing `json:"spacing"` // LinearSpacing or GeometricSpacing
+	Leverage   string       `json:"leverage,omitempty"`
+}
+
+// GridOrder is one resting order of a grid
+type GridOrder struct {
+	Level   int     `json:"level"`
+	Side    string  `json:"side"`
+	Price   float64 `json:"price"`
+	Volume  float64 `json:"volume"`
+	TxID    string  `json:"txid"`
+	Counter float64 `json:"counter,omitempty"` // Price of the fill this order reverses, 0 for initial orders
+	Closes  bool    `json:"closes,omitempty"`  // Its fill completes a round trip with the fill it reverses
+}
+
+// Grid is the persisted state of a grid bot
+type Grid struct {
+	ID         string      `json:"id"`
+	UserRef    int64       `json:"userref"`
+	Config     GridConfig  `json:"config"`
+	Prices     []float64   `json:"prices"` // Grid lines, lowest first
+	Orders     []GridOrder `json:"orders"`
+	Pending    []GridOrder `json:"pending,omitempty"` // Counter orders that failed to place, retried on refresh
+	Status     GridStatus  `json:"status"`
+	Fills      int         `json:"fills"`
+	RoundTrips int         `json:"round_trips"`
+	Profit     float64     `json:"profit"` // Gross grid profit of completed round trips
+	Fees       float64     `json:"fees"`
+	CreatedAt  time.Time   `json:"created_at"`
+	UpdatedAt  time.Time   `json:"updated_at"`
+}
+
+// NetProfit is the grid profit after fees
+func (g *Grid) NetProfit() float64 {
+	return g.Profit - g.Fees
+}
+
+func (c *GridConfig) Validate() error {
+	if c.Pair == "" {
+		return fmt.Errorf("pair is required")
+	}
+	if c.LowerPrice <= 0 || c.UpperPrice <= c.LowerPrice {
+		return fmt.Errorf("upper price must be above a positive lower price")
+	}
+	if c.Levels < 3 {
+		return fmt.Errorf("a grid needs at least 3 levels")
+	}
+	if c.Volume <= 0 {
+		return fmt.Errorf("volume must be positive")
+	}
+	switch c.Spacing {
+	case LinearSpacing, GeometricSpacing:
+	default:
+		return fmt.Errorf("invalid grid spacing: %s", c.Spacing)
+	}
+	return nil
+}
+
+// gridPrices lays out the grid lines with the ladder price machinery, rounded
+// to the pair's price precision
+func gridPrices(config GridConfig, info *AssetPair) []float64 {
+	prices := calculateOrderPrices(TrailingEntryConfig{
+		Side:      "sell", // Lowest price first
+		LowerBand: config.LowerPrice,
+		UpperBand: config.UpperPrice,
+		NumOrders: config.Levels,
+		Spacing:   config.Spacing,
+	})
+	for i, p := range prices {
+		prices[i] = info.RoundPrice(p)
+	}
+	return prices
+}
+
+// GridManager starts, follows and stops grids, persisting each as a JSON
+// file named after its ID
+type GridManager struct {
+	client       *Client
+	dir          string
+	PollInterval time.Duration
+	mu           sync.Mutex
+}
+
+// NewGridManager keeps grid state in dir
+func NewGridManager(client *Client, dir string) *GridManager {
+	return &GridManager{
+		client:       client,
+		dir:          dir,
+		PollInterval: DefaultGridPollInterval,
+	}
+}
+
+// Start places the initial grid around the current price: buys on the lines
+// below it and sells on the lines above it, leaving the line nearest to the
+// price empty. The sells need the base asset, or margin, to be available.
+func (m *GridManager) Start(ctx context.Context, config GridConfig) (*Grid, error) {
+	if config.Spacing == "" {
+		config.Spacing = LinearSpacing
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid grid: %w", err)
+	}
+
+	info, err := m.client.assetPair(ctx, config.Pair)
+	if err != nil {
+		return nil, err
+	}
+
+	ticker, err := m.client.GetTickerPrice(ctx, config.Pair)
+	if err != nil {
+		return nil, err
+	}
+	price := ticker.Last
+	if price < config.LowerPrice || price > config.UpperPrice {
+		return nil, fmt.Errorf("price %.2f is outside the grid %.2f-%.2f", price, config.LowerPrice, config.UpperPrice)
+	}
+
+	userRef := newUserRef()
+	now := time.Now()
+	grid := &Grid{
+		ID:        strconv.FormatInt(userRef, 10),
+		UserRef:   userRef,
+		Config:    config,
+		Prices:    gridPrices(config, info),
+		Status:    GridRunning,
+		CreatedAt: now,
+	}
+
+	for i := 1; i < len(grid.Prices); i++ {
+		if grid.Prices[i] <= grid.Prices[i-1] {
+			return nil, fmt.Errorf("grid step is finer than the %d decimals of %s prices", info.PairDecimals, config.Pair)
+		}
+	}
+
+	empty := 0
+	for i, p := range grid.Prices {
+		if math.Abs(p-price) < math.Abs(grid.Prices[empty]-price) {
+			empty = i
+		}
+	}
+
+	fmt.Printf("Starting grid %s on %s with %d levels between %.2f and %.2f...\n",
+		grid.ID, config.Pair, len(grid.Prices), config.LowerPrice, config.UpperPrice)
+
+	for level := range grid.Prices {
+		side := "buy"
+		switch {
+		case level == empty:
+			continue
+		case level > empty:
+			side = "sell"
+		}
+
+		order := GridOrder{Level: level, Side: side, Price: grid.Prices[level], Volume: config.Volume}
+		if err := m.place(ctx, grid, order); err != nil {
+			// Do not leave half a grid behind
+			if cancelErr := m.cancelAll(context.WithoutCancel(ctx), grid); cancelErr != nil {
+				fmt.Printf("failed to cancel grid orders: %v\n", cancelErr)
+			}
+			return nil, err
+		}
+	}
+
+	return grid, m.Save(grid)
+}
+
+// place adds an order on a grid line
+func (m *GridManager) place(ctx context.Context, grid *Grid, order GridOrder) error {
+	info, err := m.client.assetPair(ctx, grid.Config.Pair)
+	if err != nil {
+		return fmt.Errorf("failed to place grid %s at %.2f: %w", order.Side, order.Price, err)
+	}
+
+	resp, err := m.client.AddOrder(ctx, OrderRequest{
+		Pair:     grid.Config.Pair,
+		Type:     LimitOrder,
+		Side:     order.Side,
+		Volume:   strconv.FormatFloat(order.Volume, 'f', 8, 64),
+		Price:    info.FormatPrice(order.Price),
+		Leverage: grid.Config.Leverage,
+		UserRef:  grid.UserRef,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to place grid %s at %.2f: %w", order.Side, order.Price, err)
+	}
+	if len(resp.TransactionIds) > 0 {
+		order.TxID = resp.TransactionIds[0]
+	}
+
+	grid.Orders = append(grid.Orders, order)
+	return nil
+}
+
+// Refresh polls the grid's orders and replaces every filled buy with a sell
+// one line up and every filled sell with a buy one line down
+func (m *GridManager) Refresh(ctx context.Context, grid *Grid) error {
+	return m.update(ctx, grid, true)
+}
+
+// update accounts for the grid's filled orders. With replace set it queues
+// their counter orders and places every pending one; otherwise they are not
+// placed.
+func (m *GridManager) update(ctx context.Context, grid *Grid, replace bool) error {
+	if grid.Status != GridRunning || len(grid.Orders)+len(grid.Pending) == 0 {
+		return nil
+	}
+
+	var filled []GridOrder
+	if len(grid.Orders) > 0 {
+		txids := make([]string, len(grid.Orders))
+		for i, o := range grid.Orders {
+			txids[i] = o.TxID
+		}
+
+		infos, err := m.client.QueryOrders(ctx, txids...)
+		if err != nil {
+			return err
+		}
+
+		var open []GridOrder
+		for _, o := range grid.Orders {
+			info, ok := infos[o.TxID]
+			switch {
+			case !ok || info.Status == "open" || info.Status == "pending":
+				open = append(open, o)
+			case info.Status == "closed":
+				fee, _ := strconv.ParseFloat(info.Fee, 64)
+				grid.Fees += fee
+				filled = append(filled, o)
+			default:
+				fmt.Printf("Grid %s order %s at %.2f was %s and is not replaced\n", grid.ID, o.TxID, o.Price, info.Status)
+			}
+		}
+		grid.Orders = open
+	}
+
+	for _, o := range filled {
+		grid.Fills++
+		if o.Closes {
+			grid.RoundTrips++
+			grid.Profit += math.Abs(o.Price-o.Counter) * o.Volume
+		}
+
+		level, side := o.Level+1, "sell"
+		if o.Side == "sell" {
+			level, side = o.Level-1, "buy"
+		}
+		fmt.Printf("Grid %s %s filled at %.2f\n", grid.ID, o.Side, o.Price)
+
+		if !replace || level < 0 || level >= len(grid.Prices) {
+			continue
+		}
+		grid.Pending = append(grid.Pending, GridOrder{
+			Level:   level,
+			Side:    side,
+			Price:   grid.Prices[level],
+			Volume:  o.Volume,
+			Counter: o.Price,
+			Closes:  !o.Closes,
+		})
+	}
+
+	var errs []error
+	if replace {
+		var failed []GridOrder
+		for _, o := range grid.Pending {
+			if err := m.place(ctx, grid, o); err != nil {
+				errs = append(errs, err)
+				failed = append(failed, o)
+			}
+		}
+		grid.Pending = failed
+	}
+
+	if err := m.Save(grid); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%d counter orders left pending, first: %w", len(errs), errs[0])
+	}
+	return nil
+}
+
+// Run follows the grid's fills until ctx is done or the grid is stopped.
+// It holds the grid's lock, so that only one process places its orders.
+func (m *GridManager) Run(ctx context.Context, grid *Grid) error {
+	unlock, err := m.lock(grid.ID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	poll := time.NewTicker(m.PollInterval)
+	defer poll.Stop()
+
+	for {
+		if m.stopRequested(grid.ID) {
+			return m.stop(context.WithoutCancel(ctx), grid)
+		}
+
+		if err := m.Refresh(ctx, grid); err != nil {
+			fmt.Printf("failed to refresh grid %s: %v\n", grid.ID, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-poll.C:
+		}
+	}
+}
+
+// Stop cancels every open order of a grid and marks it stopped. A grid that
+// Run follows in another process is asked to stop and waited for instead, so
+// that no counter order is placed after the cancel.
+func (m *GridManager) Stop(ctx context.Context, grid *Grid) error {
+	unlock, err := m.lock(grid.ID)
+	if errors.Is(err, errGridLocked) {
+		return m.requestStop(ctx, grid)
+	}
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return m.stop(ctx, grid)
+}
+
+// stop cancels the grid's orders and records the fills that came before the
+// cancel, without placing counter orders. The caller holds the lock.
+func (m *GridManager) stop(ctx context.Context, grid *Grid) error {
+	if err := m.cancelAll(ctx, grid); err != nil {
+		return err
+	}
+	if err := m.update(ctx, grid, false); err != nil {
+		fmt.Printf("failed to record the last fills of grid %s: %v\n", grid.ID, err)
+	}
+
+	grid.Status = GridStopped
+	grid.Orders = nil
+	grid.Pending = nil
+	if err := m.Save(grid); err != nil {
+		return err
+	}
+	os.Remove(m.stopPath(grid.ID))
+	return nil
+}
+
+// requestStop asks the process following the grid to stop it and waits until
+// it has released the lock
+func (m *GridManager) requestStop(ctx context.Context, grid *Grid) error {
+	if err := os.WriteFile(m.stopPath(grid.ID), nil, 0o600); err != nil {
+		return fmt.Errorf("failed to request stop of grid %s: %w", grid.ID, err)
+	}
+	fmt.Printf("Grid %s is followed by another process, waiting for it to stop...\n", grid.ID)
+
+	timeout := time.NewTimer(2*m.PollInterval + REST_TIMEOUT)
+	defer timeout.Stop()
+	wait := time.NewTicker(100 * time.Millisecond)
+	defer wait.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timeout.C:
+			return fmt.Errorf("grid %s did not stop; if no process follows it, remove %s and stop it again",
+				grid.ID, m.lockPath(grid.ID))
+		case <-wait.C:
+		}
+
+		if _, err := os.Stat(m.lockPath(grid.ID)); !os.IsNotExist(err) {
+			continue
+		}
+		saved, err := m.Load(grid.ID)
+		if err != nil {
+			return err
+		}
+		*grid = *saved
+		if grid.Status != GridStopped {
+			return fmt.Errorf("grid %s was released without stopping; stop it again", grid.ID)
+		}
+		return nil
+	}
+}
+
+// lock marks the grid as followed by this process. It fails with
+// errGridLocked while another process holds the lock.
+func (m *GridManager) lock(id string) (func(), error) {
+	path := m.lockPath(id)
+	if err := os.MkdirAll(m.dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create grid directory: %w", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if os.IsExist(err) {
+		return nil, fmt.Errorf("%w: %s exists", errGridLocked, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock grid %s: %w", id, err)
+	}
+	fmt.Fprintf(f, "%d\n", os.Getpid())
+	f.Close()
+
+	return func() { os.Remove(path) }, nil
+}
+
+// stopRequested reports whether Stop has asked the process following the
+// grid to stop it
+func (m *GridManager) stopRequested(id string) bool {
+	_, err := os.Stat(m.stopPath(id))
+	return err == nil
+}
+
+// cancelAll cancels the grid's orders by its userref
+func (m *GridManager) cancelAll(ctx context.Context, grid *Grid) error {
+	if len(grid.Orders) == 0 {
+		return nil
+	}
+	if err := m.client.CancelOrder(ctx, strconv.FormatInt(grid.UserRef, 10)); err != nil {
+		return fmt.Errorf("failed to cancel grid %s: %w", grid.ID, err)
+	}
+	return nil
+}
+
+func (m *GridManager) path(id string) string {
+	return filepath.Join(m.dir, id+".json")
+}
+
+func (m *GridManager) lockPath(id string) string {
+	return filepath.Join(m.dir, id+".lock")
+}
+
+func (m *GridManager) stopPath(id string) string {
+	return filepath.Join(m.dir, id+".stop")
+}
+
+// Save persists the grid
+func (m *GridManager) Save(grid *Grid) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	grid.UpdatedAt = time.Now()
+	return saveState(m.path(grid.ID), grid)
+}
+
+// Load reads a saved grid by ID
+func (m *GridManager) Load(id string) (*Grid, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var grid Grid
+	found, err := loadState(m.path(id), &grid)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("grid %s not found", id)
+	}
+
+	return &grid, nil
+}
+
+// List returns every saved grid, newest first
+func (m *GridManager) List() ([]*Grid, error) {
+	entries, err := os.ReadDir(m.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list grids: %w", err)
+	}
+
+	var grids []*Grid
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		grid, err := m.Load(strings.TrimSuffix(e.Name(), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		grids = append(grids, grid)
+	}
+
+	sort.Slice(grids, func(i, j int) bool {
+		return grids[i].CreatedAt.After(grids[j].CreatedAt)
+	})
+	return grids, nil
+}
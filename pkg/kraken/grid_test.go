@@ -0,0 +1,282 @@
+package kraken
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestGridConfig_Validate(t *testing.T) {
+	valid := GridConfig{Pair: "XBT/USD", LowerPrice: 90, UpperPrice: 110, Levels: 5, Volume: 1, Spacing: LinearSpacing}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*GridConfig)
+	}{
+		{"inverted band", func(c *GridConfig) { c.LowerPrice, c.UpperPrice = 110, 90 }},
+		{"too few levels", func(c *GridConfig) { c.Levels = 2 }},
+		{"no volume", func(c *GridConfig) { c.Volume = 0 }},
+		{"explicit spacing", func(c *GridConfig) { c.Spacing = ExplicitSpacing }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := valid
+			tt.modify(&config)
+			if err := config.Validate(); err == nil {
+				t.Error("Validate() should fail")
+			}
+		})
+	}
+}
+
+func TestGridManager_StartAndRefresh(t *testing.T) {
+	api := newMockTradingAPI()
+	defer api.Close()
+	api.ticker = 101
+
+	client := NewTestClient(t, &TestConfig{DemoAPIURL: api.URL})
+	m := NewGridManager(client, t.TempDir())
+
+	grid, err := m.Start(context.Background(), GridConfig{
+		Pair: "XBT/USD", LowerPrice: 90, UpperPrice: 110, Levels: 5, Volume: 1,
+	})
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	// Lines at 90, 95, 100, 105 and 110; the one at 100 stays empty
+	want := []struct {
+		side  string
+		price string
+	}{{"buy", "90.00"}, {"buy", "95.00"}, {"sell", "105.00"}, {"sell", "110.00"}}
+	if len(api.placed) != len(want) {
+		t.Fatalf("placed %d orders, want %d", len(api.placed), len(want))
+	}
+	for i, w := range want {
+		if api.placed[i].Get("type") != w.side || api.placed[i].Get("price") != w.price {
+			t.Errorf("order %d = %s at %s, want %s at %s", i,
+				api.placed[i].Get("type"), api.placed[i].Get("price"), w.side, w.price)
+		}
+	}
+
+	// The buy at 95 fills and is replaced by a sell at 100
+	api.filled["TX-2"] = true
+	if err := m.Refresh(context.Background(), grid); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if len(api.placed) != 5 || api.placed[4].Get("type") != "sell" || api.placed[4].Get("price") != "100.00" {
+		t.Fatalf("counter order = %v", api.placed[4])
+	}
+	if grid.Fills != 1 || grid.RoundTrips != 0 || len(grid.Orders) != 4 {
+		t.Errorf("grid after buy fill = %+v", grid)
+	}
+
+	// That sell fills too, completing a round trip worth one grid step
+	api.filled["TX-5"] = true
+	if err := m.Refresh(context.Background(), grid); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if api.placed[5].Get("type") != "buy" || api.placed[5].Get("price") != "95.00" {
+		t.Errorf("counter order = %v", api.placed[5])
+	}
+	if grid.RoundTrips != 1 || grid.Profit != 5 {
+		t.Errorf("round trips = %d, profit = %v, want 1 and 5", grid.RoundTrips, grid.Profit)
+	}
+
+	saved, err := m.Load(grid.ID)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if saved.Profit != 5 || len(saved.Orders) != 4 {
+		t.Errorf("saved grid = %+v", saved)
+	}
+
+	// Buying back at 95 reopens the trade rather than completing another
+	api.filled["TX-6"] = true
+	if err := m.Refresh(context.Background(), grid); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if grid.RoundTrips != 1 || grid.Profit != 5 {
+		t.Errorf("after buy back: round trips = %d, profit = %v, want 1 and 5", grid.RoundTrips, grid.Profit)
+	}
+	if api.placed[6].Get("type") != "sell" || api.placed[6].Get("price") != "100.00" {
+		t.Errorf("counter order = %v", api.placed[6])
+	}
+
+	// Selling at 100 again completes the second round trip
+	api.filled["TX-7"] = true
+	if err := m.Refresh(context.Background(), grid); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if grid.RoundTrips != 2 || grid.Profit != 10 {
+		t.Errorf("after second sell: round trips = %d, profit = %v, want 2 and 10", grid.RoundTrips, grid.Profit)
+	}
+
+	if err := m.Stop(context.Background(), grid); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	if len(api.cancelled) != 1 || api.cancelled[0] != grid.ID || grid.Status != GridStopped {
+		t.Errorf("cancelled = %v, status = %s", api.cancelled, grid.Status)
+	}
+}
+
+func TestGridManager_RetriesFailedCounterOrders(t *testing.T) {
+	api := newMockTradingAPI()
+	defer api.Close()
+	api.ticker = 101
+
+	client := NewTestClient(t, &TestConfig{DemoAPIURL: api.URL})
+	m := NewGridManager(client, t.TempDir())
+
+	grid, err := m.Start(context.Background(), GridConfig{
+		Pair: "XBT/USD", LowerPrice: 90, UpperPrice: 110, Levels: 5, Volume: 1,
+	})
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	// The counter order of the buy at 95 fails to place
+	api.filled["TX-2"] = true
+	api.reject[5] = true
+	if err := m.Refresh(context.Background(), grid); err == nil {
+		t.Fatal("Refresh() should report the failed counter order")
+	}
+	if len(grid.Pending) != 1 || len(grid.Orders) != 3 {
+		t.Fatalf("grid after failure: pending %v, orders %v", grid.Pending, grid.Orders)
+	}
+
+	// The next refresh places it
+	if err := m.Refresh(context.Background(), grid); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if len(grid.Pending) != 0 || len(grid.Orders) != 4 || api.placed[4].Get("price") != "100.00" {
+		t.Errorf("grid after retry: pending %v, orders %v", grid.Pending, grid.Orders)
+	}
+	if grid.Fills != 1 {
+		t.Errorf("fills = %d, want the fill counted once", grid.Fills)
+	}
+}
+
+func TestGridManager_StopPlacesNoOrders(t *testing.T) {
+	api := newMockTradingAPI()
+	defer api.Close()
+	api.ticker = 101
+
+	client := NewTestClient(t, &TestConfig{DemoAPIURL: api.URL})
+	m := NewGridManager(client, t.TempDir())
+
+	grid, err := m.Start(context.Background(), GridConfig{
+		Pair: "XBT/USD", LowerPrice: 90, UpperPrice: 110, Levels: 5, Volume: 1,
+	})
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	// A fill since the last poll is recorded, but not replaced
+	api.filled["TX-2"] = true
+	if err := m.Stop(context.Background(), grid); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	if len(api.placed) != 4 {
+		t.Errorf("Stop() placed %d orders", len(api.placed)-4)
+	}
+	if grid.Fills != 1 || grid.Status != GridStopped || len(grid.Orders) != 0 {
+		t.Errorf("stopped grid = %+v", grid)
+	}
+}
+
+func TestGridManager_StopRunningGrid(t *testing.T) {
+	api := newMockTradingAPI()
+	defer api.Close()
+	api.ticker = 101
+
+	client := NewTestClient(t, &TestConfig{DemoAPIURL: api.URL})
+	dir := t.TempDir()
+	runner := NewGridManager(client, dir)
+	runner.PollInterval = 10 * time.Millisecond
+
+	grid, err := runner.Start(context.Background(), GridConfig{
+		Pair: "XBT/USD", LowerPrice: 90, UpperPrice: 110, Levels: 5, Volume: 1,
+	})
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	runc := make(chan error, 1)
+	go func() {
+		runc <- runner.Run(ctx, grid)
+	}()
+
+	// A second Run on the same grid is refused
+	other := NewGridManager(client, dir)
+	other.PollInterval = 10 * time.Millisecond
+	for {
+		if _, err := os.Stat(runner.lockPath(grid.ID)); err == nil {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	loaded, err := other.Load(grid.ID)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if err := other.Run(ctx, loaded); !errors.Is(err, errGridLocked) {
+		t.Fatalf("second Run() error = %v, want errGridLocked", err)
+	}
+
+	// Stop from another process leaves the cancel to the running one
+	if err := other.Stop(ctx, loaded); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	if err := <-runc; err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if loaded.Status != GridStopped {
+		t.Errorf("status = %s, want stopped", loaded.Status)
+	}
+	if len(api.cancelled) != 1 || api.cancelled[0] != grid.ID {
+		t.Errorf("cancelled = %v", api.cancelled)
+	}
+	if _, err := os.Stat(runner.stopPath(grid.ID)); !os.IsNotExist(err) {
+		t.Error("stop request should be removed")
+	}
+}
+
+func TestGridManager_StartOutsideRange(t *testing.T) {
+	api := newMockTradingAPI()
+	defer api.Close()
+	api.ticker = 120
+
+	client := NewTestClient(t, &TestConfig{DemoAPIURL: api.URL})
+	m := NewGridManager(client, t.TempDir())
+
+	_, err := m.Start(context.Background(), GridConfig{Pair: "XBT/USD", LowerPrice: 90, UpperPrice: 110, Levels: 5, Volume: 1})
+	if err == nil || len(api.placed) != 0 {
+		t.Errorf("Start() = %v with %d orders, want an error and no orders", err, len(api.placed))
+	}
+}
+
+func TestGridManager_StartRollsBack(t *testing.T) {
+	api := newMockTradingAPI()
+	defer api.Close()
+	api.ticker = 100
+	api.reject[3] = true
+
+	client := NewTestClient(t, &TestConfig{DemoAPIURL: api.URL})
+	m := NewGridManager(client, t.TempDir())
+
+	if _, err := m.Start(context.Background(), GridConfig{Pair: "XBT/USD", LowerPrice: 90, UpperPrice: 110, Levels: 5, Volume: 1}); err == nil {
+		t.Fatal("Start() should fail")
+	}
+	if len(api.cancelled) != 1 {
+		t.Errorf("cancelled = %v, want the placed orders cancelled by userref", api.cancelled)
+	}
+}
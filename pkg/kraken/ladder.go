@@ -0,0 +1,390 @@
+package kraken
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type LadderStatus string
+
+const (
+	LadderActive    LadderStatus = "active"    // Rungs resting on the book
+	LadderFilled    LadderStatus = "filled"    // Every rung filled
+	LadderExpired   LadderStatus = "expired"   // Unfilled rungs cancelled after the timeout
+	LadderCancelled LadderStatus = "cancelled" // Unfilled rungs cancelled, e.g. price left the band
+	LadderClosed    LadderStatus = "closed"    // Every rung closed some other way
+)
+
+// DefaultLadderPollInterval is how often a monitored ladder polls its orders
+const DefaultLadderPollInterval = 30 * time.Second
+
+// LadderRung is the tracked state of one order of a managed ladder
+type LadderRung struct {
+	Price    float64 `json:"price"`
+	Volume   float64 `json:"volume"`
+	TxID     string  `json:"txid"`
+	Status   string  `json:"status"`
+	Filled   float64 `json:"filled"`
+	AvgPrice float64 `json:"avg_price,omitempty"`
+}
+
+// Ladder is a placed ladder whose rungs share a userref
+type Ladder struct {
+	ID                string       `json:"id"`
+	UserRef           int64        `json:"userref"`
+	Pair              string       `json:"pair"`
+	Side              string       `json:"side"`
+	UpperBand         float64      `json:"upper_band"`
+	LowerBand         float64      `json:"lower_band"`
+	Status            LadderStatus `json:"status"`
+	CreatedAt         time.Time    `json:"created_at"`
+	ExpiresAt         time.Time    `json:"expires_at,omitempty"`
+	CancelOutsideBand bool         `json:"cancel_outside_band,omitempty"`
+	EnteredBand       bool         `json:"entered_band,omitempty"`
+	Rungs             []LadderRung `json:"rungs"`
+	UpdatedAt         time.Time    `json:"updated_at"`
+}
+
+// LadderOptions controls how a managed ladder is wound down
+type LadderOptions struct {
+	Timeout           time.Duration // Cancel unfilled rungs this long after placement
+	CancelOutsideBand bool          // Cancel unfilled rungs once price leaves the band it entered
+}
+
+// TotalVolume is the combined volume of all rungs
+func (l *Ladder) TotalVolume() float64 {
+	total := 0.0
+	for _, r := range l.Rungs {
+		total += r.Volume
+	}
+	return total
+}
+
+// FilledVolume is the combined executed volume of all rungs
+func (l *Ladder) FilledVolume() float64 {
+	filled := 0.0
+	for _, r := range l.Rungs {
+		filled += r.Filled
+	}
+	return filled
+}
+
+// FilledPercent is the share of the ladder's volume that has executed
+func (l *Ladder) FilledPercent() float64 {
+	total := l.TotalVolume()
+	if total == 0 {
+		return 0
+	}
+	return l.FilledVolume() / total * 100
+}
+
+// AverageEntry is the volume-weighted average fill price, or 0 if nothing
+// has filled yet
+func (l *Ladder) AverageEntry() float64 {
+	cost, filled := 0.0, 0.0
+	for _, r := range l.Rungs {
+		cost += r.Filled * r.AvgPrice
+		filled += r.Filled
+	}
+	if filled == 0 {
+		return 0
+	}
+	return cost / filled
+}
+
+// Done reports whether no rung of the ladder is still open
+func (l *Ladder) Done() bool {
+	return l.Status != LadderActive
+}
+
+// LadderManager places ladders, persists them by ID and follows them until
+// every rung is filled or cancelled
+type LadderManager struct {
+	client       *Client
+	dir          string
+	PollInterval time.Duration
+	mu           sync.Mutex
+}
+
+// NewLadderManager keeps ladder state as one JSON file per ladder in dir
+func NewLadderManager(client *Client, dir string) *LadderManager {
+	return &LadderManager{
+		client:       client,
+		dir:          dir,
+		PollInterval: DefaultLadderPollInterval,
+	}
+}
+
+// newUserRef picks a positive 32-bit tag, the range Kraken accepts
+func newUserRef() int64 {
+	return int64(rand.Int31n(math.MaxInt32)) + 1
+}
+
+// Place places a ladder with every rung tagged by a fresh userref and saves
+// it. Rungs that failed to place are not tracked; the returned error says
+// which. Trailing mode is not supported, since it re-centres rungs itself.
+func (m *LadderManager) Place(ctx context.Context, config TrailingEntryConfig, opts LadderOptions) (*Ladder, error) {
+	if config.TrailDistance > 0 {
+		return nil, fmt.Errorf("managed ladders cannot use trailing mode")
+	}
+
+	config.UserRef = newUserRef()
+	result, placeErr := m.client.PlaceLadder(ctx, config)
+	if result == nil || len(result.Placed()) == 0 {
+		return nil, placeErr
+	}
+
+	now := time.Now()
+	ladder := &Ladder{
+		ID:                strconv.FormatInt(config.UserRef, 10),
+		UserRef:           config.UserRef,
+		Pair:              config.Pair,
+		Side:              config.Side,
+		UpperBand:         config.UpperBand,
+		LowerBand:         config.LowerBand,
+		Status:            LadderActive,
+		CreatedAt:         now,
+		CancelOutsideBand: opts.CancelOutsideBand,
+		UpdatedAt:         now,
+	}
+	if opts.Timeout > 0 {
+		ladder.ExpiresAt = now.Add(opts.Timeout)
+	}
+
+	for _, rung := range result.Placed() {
+		ladder.Rungs = append(ladder.Rungs, LadderRung{
+			Price:  rung.Price,
+			Volume: rung.Volume,
+			TxID:   rung.TxID,
+			Status: "open",
+		})
+	}
+
+	if err := m.Save(ladder); err != nil {
+		return ladder, err
+	}
+
+	return ladder, placeErr
+}
+
+func (m *LadderManager) path(id string) string {
+	return filepath.Join(m.dir, id+".json")
+}
+
+// Save persists the ladder
+func (m *LadderManager) Save(ladder *Ladder) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ladder.UpdatedAt = time.Now()
+	return saveState(m.path(ladder.ID), ladder)
+}
+
+// Load reads a saved ladder by ID
+func (m *LadderManager) Load(id string) (*Ladder, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var ladder Ladder
+	found, err := loadState(m.path(id), &ladder)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("ladder %s not found", id)
+	}
+
+	return &ladder, nil
+}
+
+// List returns every saved ladder, newest first
+func (m *LadderManager) List() ([]*Ladder, error) {
+	entries, err := os.ReadDir(m.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ladders: %w", err)
+	}
+
+	var ladders []*Ladder
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		ladder, err := m.Load(strings.TrimSuffix(e.Name(), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		ladders = append(ladders, ladder)
+	}
+
+	sort.Slice(ladders, func(i, j int) bool {
+		return ladders[i].CreatedAt.After(ladders[j].CreatedAt)
+	})
+	return ladders, nil
+}
+
+// Refresh polls the ladder's orders, updates fills and status and saves it
+func (m *LadderManager) Refresh(ctx context.Context, ladder *Ladder) error {
+	txids := make([]string, 0, len(ladder.Rungs))
+	for _, r := range ladder.Rungs {
+		if r.TxID != "" {
+			txids = append(txids, r.TxID)
+		}
+	}
+	if len(txids) == 0 {
+		return nil
+	}
+
+	orders, err := m.client.QueryOrders(ctx, txids...)
+	if err != nil {
+		return err
+	}
+
+	open := 0
+	for i := range ladder.Rungs {
+		rung := &ladder.Rungs[i]
+		info, ok := orders[rung.TxID]
+		if !ok {
+			continue
+		}
+
+		rung.Status = info.Status
+		rung.Filled, _ = strconv.ParseFloat(info.VolumeExec, 64)
+		rung.AvgPrice, _ = strconv.ParseFloat(info.AvgPrice, 64)
+
+		// A fill means price reached the band, even if nobody was watching
+		if rung.Filled > 0 {
+			ladder.EnteredBand = true
+		}
+
+		if info.Status == "open" || info.Status == "pending" {
+			open++
+		}
+	}
+
+	if open == 0 && ladder.Status == LadderActive {
+		ladder.Status = LadderClosed
+		if ladder.TotalVolume()-ladder.FilledVolume() < minRemainingVolume {
+			ladder.Status = LadderFilled
+		}
+	}
+
+	return m.Save(ladder)
+}
+
+// Cancel cancels every unfilled rung by the ladder's userref and records why
+func (m *LadderManager) Cancel(ctx context.Context, ladder *Ladder, status LadderStatus) error {
+	if err := m.client.CancelOrder(ctx, strconv.FormatInt(ladder.UserRef, 10)); err != nil {
+		return err
+	}
+
+	ladder.Status = status
+	return m.Refresh(ctx, ladder)
+}
+
+// Enforce applies the expiry and band of a ladder that may have gone
+// unwatched, e.g. because the process that placed it stopped. price is the
+// current price of the pair, or 0 to skip the band check.
+func (m *LadderManager) Enforce(ctx context.Context, ladder *Ladder, price float64) error {
+	if err := m.Refresh(ctx, ladder); err != nil {
+		return err
+	}
+	if ladder.Done() {
+		return nil
+	}
+
+	if !ladder.ExpiresAt.IsZero() && !time.Now().Before(ladder.ExpiresAt) {
+		fmt.Printf("Ladder %s expired, cancelling unfilled orders\n", ladder.ID)
+		return m.Cancel(ctx, ladder, LadderExpired)
+	}
+	if price > 0 {
+		return m.checkBand(ctx, ladder, price)
+	}
+	return nil
+}
+
+// checkBand records when price enters the ladder's band and, with
+// CancelOutsideBand, cancels the unfilled rungs once it has left it again
+func (m *LadderManager) checkBand(ctx context.Context, ladder *Ladder, price float64) error {
+	inBand := price >= ladder.LowerBand && price <= ladder.UpperBand
+	if inBand && !ladder.EnteredBand {
+		ladder.EnteredBand = true
+		if err := m.Save(ladder); err != nil {
+			return err
+		}
+	}
+	if !inBand && ladder.EnteredBand && ladder.CancelOutsideBand {
+		fmt.Printf("Price %.2f left the band of ladder %s, cancelling unfilled orders\n", price, ladder.ID)
+		return m.Cancel(ctx, ladder, LadderCancelled)
+	}
+	return nil
+}
+
+// Monitor follows a ladder until it is done or ctx is done. It polls the
+// ladder's orders every PollInterval, and immediately on executions when the
+// private WebSocket is connected. prices, which may be nil, is only needed
+// for CancelOutsideBand. A ladder past its expiry, e.g. one resumed after a
+// restart, is cancelled straight away.
+func (m *LadderManager) Monitor(ctx context.Context, ladder *Ladder, prices <-chan float64) error {
+	var execs chan Execution
+	if m.client.State(PrivateEndpoint) == Connected {
+		execs = make(chan Execution, 16)
+		if err := m.client.SubscribeToExecutions(ctx, execs); err != nil {
+			return err
+		}
+	}
+
+	poll := time.NewTicker(m.PollInterval)
+	defer poll.Stop()
+
+	var expire <-chan time.Time
+	if !ladder.ExpiresAt.IsZero() {
+		timer := time.NewTimer(time.Until(ladder.ExpiresAt))
+		defer timer.Stop()
+		expire = timer.C
+	}
+
+	for !ladder.Done() {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case <-expire:
+			fmt.Printf("Ladder %s expired, cancelling unfilled orders\n", ladder.ID)
+			if err := m.Cancel(ctx, ladder, LadderExpired); err != nil {
+				return err
+			}
+
+		case price := <-prices:
+			if err := m.checkBand(ctx, ladder, price); err != nil {
+				return err
+			}
+
+		case exec := <-execs:
+			if exec.OrderUserref != ladder.UserRef {
+				continue
+			}
+			if err := m.Refresh(ctx, ladder); err != nil {
+				fmt.Printf("failed to refresh ladder %s: %v\n", ladder.ID, err)
+			}
+
+		case <-poll.C:
+			if err := m.Refresh(ctx, ladder); err != nil {
+				fmt.Printf("failed to refresh ladder %s: %v\n", ladder.ID, err)
+			}
+		}
+	}
+
+	return nil
+}
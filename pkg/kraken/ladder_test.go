@@ -0,0 +1,222 @@
+package kraken
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func newTestLadderManager(t *testing.T) (*LadderManager, *mockTradingAPI) {
+	api := newMockTradingAPI()
+	t.Cleanup(api.Close)
+
+	client := NewTestClient(t, &TestConfig{DemoAPIURL: api.URL})
+	return NewLadderManager(client, t.TempDir()), api
+}
+
+func testLadderConfig() TrailingEntryConfig {
+	return TrailingEntryConfig{
+		Pair:        "XBT/USD",
+		Side:        "buy",
+		UpperBand:   100,
+		LowerBand:   70,
+		TotalVolume: 4,
+		NumOrders:   4,
+	}
+}
+
+func TestLadderManager_PlaceAndRefresh(t *testing.T) {
+	m, api := newTestLadderManager(t)
+
+	ladder, err := m.Place(context.Background(), testLadderConfig(), LadderOptions{})
+	if err != nil {
+		t.Fatalf("Place() error = %v", err)
+	}
+
+	ref := strconv.FormatInt(ladder.UserRef, 10)
+	if ladder.ID != ref || len(ladder.Rungs) != 4 {
+		t.Fatalf("ladder = %+v", ladder)
+	}
+	for i, order := range api.placed {
+		if order.Get("userref") != ref {
+			t.Errorf("order %d userref = %q, want %q", i, order.Get("userref"), ref)
+		}
+	}
+
+	api.filled["TX-1"] = true
+	api.filled["TX-2"] = true
+	if err := m.Refresh(context.Background(), ladder); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if ladder.Status != LadderActive {
+		t.Errorf("status = %s, want active", ladder.Status)
+	}
+	if got := ladder.FilledPercent(); got != 50 {
+		t.Errorf("FilledPercent() = %v, want 50", got)
+	}
+	if got := ladder.AverageEntry(); got != 95 {
+		t.Errorf("AverageEntry() = %v, want 95", got)
+	}
+
+	saved, err := m.Load(ladder.ID)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if saved.FilledVolume() != 2 || saved.Rungs[0].Status != "closed" {
+		t.Errorf("saved ladder = %+v", saved)
+	}
+
+	api.filled["TX-3"] = true
+	api.filled["TX-4"] = true
+	if err := m.Refresh(context.Background(), ladder); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if ladder.Status != LadderFilled {
+		t.Errorf("status = %s, want filled", ladder.Status)
+	}
+}
+
+func TestLadderManager_RejectsTrailingMode(t *testing.T) {
+	m, _ := newTestLadderManager(t)
+
+	config := testLadderConfig()
+	config.TrailDistance = 50
+	if _, err := m.Place(context.Background(), config, LadderOptions{}); err == nil {
+		t.Error("Place() should reject trailing mode")
+	}
+}
+
+func TestLadderManager_MonitorExpires(t *testing.T) {
+	m, api := newTestLadderManager(t)
+	m.PollInterval = time.Hour
+
+	ladder, err := m.Place(context.Background(), testLadderConfig(), LadderOptions{Timeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Place() error = %v", err)
+	}
+	api.filled["TX-1"] = true
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := m.Monitor(ctx, ladder, nil); err != nil {
+		t.Fatalf("Monitor() error = %v", err)
+	}
+
+	if ladder.Status != LadderExpired {
+		t.Fatalf("status = %s, want expired", ladder.Status)
+	}
+	if len(api.cancelled) != 1 || api.cancelled[0] != ladder.ID {
+		t.Errorf("cancelled = %v, want the ladder's userref", api.cancelled)
+	}
+	if got := ladder.FilledPercent(); got != 25 {
+		t.Errorf("FilledPercent() = %v, want 25", got)
+	}
+	if ladder.Rungs[1].Status != "canceled" {
+		t.Errorf("unfilled rung status = %s, want canceled", ladder.Rungs[1].Status)
+	}
+}
+
+func TestLadderManager_MonitorCancelsOutsideBand(t *testing.T) {
+	m, api := newTestLadderManager(t)
+	m.PollInterval = time.Hour
+
+	ladder, err := m.Place(context.Background(), testLadderConfig(), LadderOptions{CancelOutsideBand: true})
+	if err != nil {
+		t.Fatalf("Place() error = %v", err)
+	}
+
+	// Leaving a band that was never entered does not cancel
+	prices := make(chan float64, 3)
+	prices <- 110
+	prices <- 90
+	prices <- 65
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := m.Monitor(ctx, ladder, prices); err != nil {
+		t.Fatalf("Monitor() error = %v", err)
+	}
+
+	if ladder.Status != LadderCancelled || !ladder.EnteredBand {
+		t.Errorf("ladder = %s entered=%v, want cancelled after entering the band", ladder.Status, ladder.EnteredBand)
+	}
+	if len(api.cancelled) != 1 {
+		t.Errorf("cancelled = %v, want one cancel by userref", api.cancelled)
+	}
+}
+
+func TestLadderManager_EnforceUnwatched(t *testing.T) {
+	t.Run("expired", func(t *testing.T) {
+		m, api := newTestLadderManager(t)
+		ladder, err := m.Place(context.Background(), testLadderConfig(), LadderOptions{Timeout: time.Hour})
+		if err != nil {
+			t.Fatalf("Place() error = %v", err)
+		}
+
+		if err := m.Enforce(context.Background(), ladder, 0); err != nil || ladder.Status != LadderActive {
+			t.Fatalf("Enforce() before expiry = %v, status %s", err, ladder.Status)
+		}
+
+		ladder.ExpiresAt = time.Now().Add(-time.Minute)
+		if err := m.Enforce(context.Background(), ladder, 0); err != nil {
+			t.Fatalf("Enforce() error = %v", err)
+		}
+		if ladder.Status != LadderExpired || len(api.cancelled) != 1 {
+			t.Errorf("ladder = %s, cancelled %v; want expired by userref", ladder.Status, api.cancelled)
+		}
+
+		saved, err := m.Load(ladder.ID)
+		if err != nil || saved.Status != LadderExpired {
+			t.Errorf("saved ladder = %+v, %v", saved, err)
+		}
+	})
+
+	t.Run("left the band", func(t *testing.T) {
+		m, api := newTestLadderManager(t)
+		ladder, err := m.Place(context.Background(), testLadderConfig(), LadderOptions{CancelOutsideBand: true})
+		if err != nil {
+			t.Fatalf("Place() error = %v", err)
+		}
+
+		// Price left a band that was never entered
+		if err := m.Enforce(context.Background(), ladder, 60); err != nil || ladder.Status != LadderActive {
+			t.Fatalf("Enforce() = %v, status %s, want the ladder kept", err, ladder.Status)
+		}
+
+		// A fill while nobody watched shows that price entered the band
+		api.filled["TX-1"] = true
+		if err := m.Enforce(context.Background(), ladder, 120); err != nil {
+			t.Fatalf("Enforce() error = %v", err)
+		}
+		if ladder.Status != LadderCancelled || len(api.cancelled) != 1 {
+			t.Errorf("ladder = %s, cancelled %v; want cancelled", ladder.Status, api.cancelled)
+		}
+	})
+}
+
+func TestLadderManager_List(t *testing.T) {
+	m, _ := newTestLadderManager(t)
+
+	ladders, err := m.List()
+	if err != nil || len(ladders) != 0 {
+		t.Fatalf("List() = %v, %v on an empty directory", ladders, err)
+	}
+
+	first, err := m.Place(context.Background(), testLadderConfig(), LadderOptions{})
+	if err != nil {
+		t.Fatalf("Place() error = %v", err)
+	}
+	second, err := m.Place(context.Background(), testLadderConfig(), LadderOptions{})
+	if err != nil {
+		t.Fatalf("Place() error = %v", err)
+	}
+
+	ladders, err = m.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(ladders) != 2 || ladders[0].ID != second.ID || ladders[1].ID != first.ID {
+		t.Errorf("List() should return the newest ladder first")
+	}
+}
@@ -0,0 +1,230 @@
+package kraken
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// alertFields maps the lower-cased JSON names of the alert fields to their
+// JSON name and kind, so that mappings from case-folding config files work
+var alertFields = func() map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField)
+	t := reflect.TypeOf(TradingViewAlert{})
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		f.Name = name
+		fields[strings.ToLower(name)] = f
+	}
+	return fields
+}()
+
+var placeholder = regexp.MustCompile(`\{(\w+)\}`)
+
+// AlertMapping turns a custom payload into an alert. JSON payloads are read
+// by dotted paths, plain-text payloads by a pattern such as
+// "{action} {volume} {pair}", in which every placeholder matches one word.
+// Fields the payload does not set take their default.
+type AlertMapping struct {
+	fields   map[string]string // Alert JSON name to payload path
+	text     *regexp.Regexp
+	names    []string // Alert JSON names of the text placeholders, in order
+	defaults map[string]interface{}
+}
+
+// NewAlertMapping compiles a mapping. Keys of fields and defaults, and the
+// placeholders of text, are alert JSON field names in any case.
+func NewAlertMapping(fields map[string]string, text string, defaults map[string]interface{}) (*AlertMapping, error) {
+	m := &AlertMapping{
+		fields:   make(map[string]string),
+		defaults: make(map[string]interface{}),
+	}
+
+	for name, path := range fields {
+		f, ok := alertFields[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown alert field %q", name)
+		}
+		m.fields[f.Name] = path
+	}
+	for name, v := range defaults {
+		f, ok := alertFields[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown alert field %q", name)
+		}
+		m.defaults[f.Name] = v
+	}
+
+	if text != "" {
+		var pattern strings.Builder
+		pattern.WriteString(`(?i)^\s*`)
+		last := 0
+		for _, loc := range placeholder.FindAllStringSubmatchIndex(text, -1) {
+			pattern.WriteString(literalPattern(text[last:loc[0]]))
+			pattern.WriteString(`(\S+)`)
+			last = loc[1]
+
+			name := text[loc[2]:loc[3]]
+			f, ok := alertFields[strings.ToLower(name)]
+			if !ok {
+				return nil, fmt.Errorf("unknown alert field %q in text pattern", name)
+			}
+			m.names = append(m.names, f.Name)
+		}
+		if len(m.names) == 0 {
+			return nil, fmt.Errorf("text pattern %q has no {field} placeholders", text)
+		}
+		pattern.WriteString(literalPattern(text[last:]))
+		pattern.WriteString(`\s*$`)
+
+		re, err := regexp.Compile(pattern.String())
+		if err != nil {
+			return nil, fmt.Errorf("invalid text pattern %q: %w", text, err)
+		}
+		m.text = re
+	}
+
+	return m, nil
+}
+
+// literalPattern matches s literally, with any run of whitespace in it
+// matching any other
+func literalPattern(s string) string {
+	words := strings.Fields(s)
+	if len(words) == 0 {
+		if s == "" {
+			return ""
+		}
+		return `\s+`
+	}
+
+	for i, w := range words {
+		words[i] = regexp.QuoteMeta(w)
+	}
+	p := strings.Join(words, `\s+`)
+	if strings.TrimLeft(s, " \t\r\n") != s {
+		p = `\s+` + p
+	}
+	if strings.TrimRight(s, " \t\r\n") != s {
+		p += `\s+`
+	}
+	return p
+}
+
+// Decode reads an alert from a JSON or plain-text payload
+func (m *AlertMapping) Decode(body []byte) (TradingViewAlert, error) {
+	values := make(map[string]interface{})
+
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		var payload map[string]interface{}
+		if err := json.Unmarshal(trimmed, &payload); err != nil {
+			return TradingViewAlert{}, fmt.Errorf("invalid JSON: %w", err)
+		}
+
+		// Fields already named as in the alert need no mapping. Objects are
+		// skipped, as {"strategy": {"order": ...}} is only there to be mapped.
+		for key, v := range payload {
+			f, ok := alertFields[strings.ToLower(key)]
+			if _, isObject := v.(map[string]interface{}); ok && !isObject {
+				values[f.Name] = v
+			}
+		}
+		for name, path := range m.fields {
+			if v, ok := lookupPath(payload, path); ok {
+				values[name] = v
+			}
+		}
+	} else {
+		if m.text == nil {
+			return TradingViewAlert{}, fmt.Errorf("plain-text alerts need a text pattern")
+		}
+		match := m.text.FindStringSubmatch(string(trimmed))
+		if match == nil {
+			return TradingViewAlert{}, fmt.Errorf("alert does not match the text pattern")
+		}
+		for i, name := range m.names {
+			values[name] = match[i+1]
+		}
+	}
+
+	for name, v := range m.defaults {
+		if _, ok := values[name]; !ok {
+			values[name] = v
+		}
+	}
+
+	for name, v := range values {
+		coerced, err := coerceField(alertFields[strings.ToLower(name)].Type.Kind(), v)
+		if err != nil {
+			return TradingViewAlert{}, fmt.Errorf("invalid %s: %w", name, err)
+		}
+		values[name] = coerced
+	}
+
+	data, err := json.Marshal(values)
+	if err != nil {
+		return TradingViewAlert{}, err
+	}
+	var alert TradingViewAlert
+	if err := json.Unmarshal(data, &alert); err != nil {
+		return TradingViewAlert{}, err
+	}
+	return alert, nil
+}
+
+// lookupPath follows a dotted path such as "strategy.order.action" through
+// nested objects
+func lookupPath(payload map[string]interface{}, path string) (interface{}, bool) {
+	var v interface{} = payload
+	for _, key := range strings.Split(path, ".") {
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if v, ok = obj[key]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// coerceField converts a payload value to what an alert field of kind holds,
+// since templates often render numbers as strings and the other way round
+func coerceField(kind reflect.Kind, v interface{}) (interface{}, error) {
+	switch kind {
+	case reflect.Float64, reflect.Int:
+		var f float64
+		switch t := v.(type) {
+		case float64:
+			f = t
+		case string:
+			var err error
+			if f, err = strconv.ParseFloat(strings.ReplaceAll(strings.TrimSpace(t), ",", ""), 64); err != nil {
+				return nil, fmt.Errorf("%q is not a number", t)
+			}
+		default:
+			return nil, fmt.Errorf("%v is not a number", v)
+		}
+		if kind == reflect.Int {
+			return int(f), nil
+		}
+		return f, nil
+
+	case reflect.String:
+		switch t := v.(type) {
+		case string:
+			return t, nil
+		case float64:
+			return strconv.FormatFloat(t, 'f', -1, 64), nil
+		default:
+			return nil, fmt.Errorf("%v is not a string", v)
+		}
+	}
+	return v, nil
+}
@@ -0,0 +1,121 @@
+package kraken
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAlertMapping_Decode(t *testing.T) {
+	tradingView, err := NewAlertMapping(
+		map[string]string{"action": "strategy.order.action", "pair": "ticker", "volume": "strategy.order.contracts"},
+		"",
+		map[string]interface{}{"ordertype": "market", "strategy": "trend"},
+	)
+	if err != nil {
+		t.Fatalf("NewAlertMapping() error = %v", err)
+	}
+
+	text, err := NewAlertMapping(nil, "{action} {volume} {pair} @ {price} key={passphrase}", map[string]interface{}{"orderType": "limit"})
+	if err != nil {
+		t.Fatalf("NewAlertMapping() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		mapping *AlertMapping
+		body    string
+		want    TradingViewAlert
+		wantErr bool
+	}{
+		{
+			name:    "json paths",
+			mapping: tradingView,
+			body:    `{"ticker":"XBTUSD","strategy":{"order":{"action":"buy","contracts":"0.25"}}}`,
+			want:    TradingViewAlert{Action: "buy", Pair: "XBTUSD", Volume: 0.25, OrderType: "market", Strategy: "trend"},
+		},
+		{
+			name:    "alert fields override defaults",
+			mapping: tradingView,
+			body:    `{"ticker":"XBTUSD","orderType":"limit","price":"42,000.5","strategy":{"order":{"action":"sell","contracts":1}}}`,
+			want:    TradingViewAlert{Action: "sell", Pair: "XBTUSD", Volume: 1, OrderType: "limit", Price: 42000.5, Strategy: "trend"},
+		},
+		{
+			name:    "unparseable number",
+			mapping: tradingView,
+			body:    `{"ticker":"XBTUSD","strategy":{"order":{"action":"buy","contracts":"NaN?"}}}`,
+			wantErr: true,
+		},
+		{
+			name:    "plain text",
+			mapping: text,
+			body:    "  sell  0.5 XBTUSD @ 43000\tkey=hunter2\n",
+			want:    TradingViewAlert{Action: "sell", Pair: "XBTUSD", Volume: 0.5, Price: 43000, OrderType: "limit", Passphrase: "hunter2"},
+		},
+		{
+			name:    "text not matching the pattern",
+			mapping: text,
+			body:    "sell 0.5 XBTUSD",
+			wantErr: true,
+		},
+		{
+			name:    "text without a pattern",
+			mapping: tradingView,
+			body:    "buy 1 XBTUSD",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.mapping.Decode([]byte(tt.body))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Decode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Decode() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewAlertMapping_Invalid(t *testing.T) {
+	if _, err := NewAlertMapping(map[string]string{"contracts": "x"}, "", nil); err == nil {
+		t.Error("unknown field should be rejected")
+	}
+	if _, err := NewAlertMapping(nil, "{action} {qty}", nil); err == nil {
+		t.Error("unknown placeholder should be rejected")
+	}
+	if _, err := NewAlertMapping(nil, "buy now", nil); err == nil {
+		t.Error("pattern without placeholders should be rejected")
+	}
+}
+
+func TestWebhookHandler_Mapping(t *testing.T) {
+	mapping, err := NewAlertMapping(nil, "{action} {volume} {pair} {passphrase}", map[string]interface{}{"orderType": "market"})
+	if err != nil {
+		t.Fatalf("NewAlertMapping() error = %v", err)
+	}
+	queue, err := NewAlertQueue(nil, t.TempDir(), 1)
+	if err != nil {
+		t.Fatalf("NewAlertQueue() error = %v", err)
+	}
+	handler := WebhookHandler(queue, WebhookConfig{Auth: WebhookAuth{Passphrase: "hunter2"}, Mapping: mapping})
+
+	for body, want := range map[string]int{
+		"buy 0.1 XBTUSD hunter2": http.StatusAccepted,
+		"buy 0.1 XBTUSD wrong":   http.StatusUnauthorized,
+		"buy 0.1":                http.StatusBadRequest,
+	} {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodPost, "/webhook/text", strings.NewReader(body)))
+		if rec.Code != want {
+			t.Errorf("%q: status = %d, want %d (%s)", body, rec.Code, want, rec.Body)
+		}
+	}
+	if queue.Len() != 1 {
+		t.Errorf("queued %d alerts, want 1", queue.Len())
+	}
+}
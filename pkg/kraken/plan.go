@@ -0,0 +1,108 @@
+package kraken
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// DefaultMakerFee is Kraken's base-tier maker fee in percent, used when the
+// pair's fee schedule is unknown
+const DefaultMakerFee = 0.25
+
+// PlanRung is one order of a planned ladder
+type PlanRung struct {
+	Price            float64
+	Volume           float64
+	Notional         float64
+	CumulativeVolume float64 // Volume filled once price reaches this rung
+	BelowMin         bool    // Volume under the pair's ordermin, so Kraken would reject it
+}
+
+// LadderPlan is what a ladder would place, worked out without placing it
+type LadderPlan struct {
+	Pair          string
+	Side          string
+	Rungs         []PlanRung
+	TotalVolume   float64
+	TotalNotional float64
+	AverageEntry  float64 // Volume-weighted price if every rung fills
+	MakerFee      float64 // Percent
+	EstimatedFees float64 // Quote currency, if every rung fills as maker
+	OrderMin      float64
+	Warnings      []string
+}
+
+// PlanTrailingEntry works out the orders a trailing entry would place, using
+// only the public API for the pair's order minimum and fee schedule
+func (c *Client) PlanTrailingEntry(ctx context.Context, config TrailingEntryConfig) (*LadderPlan, error) {
+	info, err := c.GetAssetPair(ctx, config.Pair)
+	if err != nil {
+		return nil, err
+	}
+
+	return planLadder(config, info)
+}
+
+// planLadder lays out the ladder's rungs and totals. info may be nil, in
+// which case prices are not rounded, no minimums are checked and the default
+// maker fee is assumed.
+func planLadder(config TrailingEntryConfig, info *AssetPair) (*LadderPlan, error) {
+	if err := config.validateLadder(); err != nil {
+		return nil, err
+	}
+
+	prices := calculateOrderPrices(config)
+	if len(prices) == 0 {
+		return nil, fmt.Errorf("no price levels between %.2f and %.2f", config.LowerBand, config.UpperBand)
+	}
+	if info != nil {
+		for i, p := range prices {
+			prices[i] = info.RoundPrice(p)
+		}
+	}
+	config.NumOrders = len(prices)
+	volumes := calculateOrderVolumes(config)
+
+	plan := &LadderPlan{
+		Pair:     config.Pair,
+		Side:     config.Side,
+		Rungs:    make([]PlanRung, len(prices)),
+		MakerFee: DefaultMakerFee,
+	}
+	if info != nil {
+		plan.MakerFee = info.MakerFee()
+		plan.OrderMin, _ = strconv.ParseFloat(info.OrderMin, 64)
+	}
+
+	for i, price := range prices {
+		rung := PlanRung{
+			Price:    price,
+			Volume:   volumes[i],
+			Notional: price * volumes[i],
+			BelowMin: volumes[i] < plan.OrderMin,
+		}
+
+		plan.TotalVolume += rung.Volume
+		plan.TotalNotional += rung.Notional
+		rung.CumulativeVolume = plan.TotalVolume
+		plan.Rungs[i] = rung
+
+		if rung.BelowMin {
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf(
+				"order %d volume %.8f is below the %s minimum of %s", i+1, rung.Volume, config.Pair, info.OrderMin))
+		}
+	}
+
+	if plan.TotalVolume > 0 {
+		plan.AverageEntry = plan.TotalNotional / plan.TotalVolume
+	}
+	plan.EstimatedFees = plan.TotalNotional * plan.MakerFee / 100
+
+	if config.TrailDistance > 0 {
+		plan.Warnings = append(plan.Warnings,
+			"trailing mode places the ladder between the reversal and the extreme, so actual prices will differ")
+	}
+
+	return plan, nil
+}
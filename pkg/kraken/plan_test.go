@@ -0,0 +1,109 @@
+package kraken
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPlanLadder(t *testing.T) {
+	config := TrailingEntryConfig{
+		Pair:         "XBT/USD",
+		Side:         "buy",
+		UpperBand:    100,
+		LowerBand:    70,
+		TotalVolume:  4,
+		NumOrders:    4,
+		Distribution: CustomDistribution,
+		Weights:      []float64{1, 1, 1, 5},
+	}
+	info := &AssetPair{OrderMin: "0.6", FeesMaker: [][]float64{{0, 0.16}, {50000, 0.14}}}
+
+	plan, err := planLadder(config, info)
+	if err != nil {
+		t.Fatalf("planLadder() error = %v", err)
+	}
+
+	if len(plan.Rungs) != 4 {
+		t.Fatalf("got %d rungs, want 4", len(plan.Rungs))
+	}
+	// 0.5 at 100, 90 and 80, then 2.5 at 70
+	if plan.Rungs[1].Notional != 45 || plan.Rungs[2].CumulativeVolume != 1.5 {
+		t.Errorf("rungs = %+v", plan.Rungs)
+	}
+	if plan.TotalVolume != 4 || plan.TotalNotional != 310 {
+		t.Errorf("totals = %v volume, %v notional", plan.TotalVolume, plan.TotalNotional)
+	}
+	if plan.AverageEntry != 77.5 {
+		t.Errorf("AverageEntry = %v, want 77.5", plan.AverageEntry)
+	}
+	if plan.MakerFee != 0.16 || math.Abs(plan.EstimatedFees-0.496) > 1e-9 {
+		t.Errorf("fees = %v at %v%%", plan.EstimatedFees, plan.MakerFee)
+	}
+
+	if len(plan.Warnings) != 3 || plan.Rungs[3].BelowMin {
+		t.Errorf("warnings = %v, want one per rung below ordermin", plan.Warnings)
+	}
+}
+
+func TestPlanLadder_Defaults(t *testing.T) {
+	config := TrailingEntryConfig{
+		Pair:          "XBT/USD",
+		Side:          "sell",
+		UpperBand:     100,
+		LowerBand:     80,
+		TotalVolume:   3,
+		NumOrders:     3,
+		TrailDistance: 5,
+	}
+
+	plan, err := planLadder(config, nil)
+	if err != nil {
+		t.Fatalf("planLadder() error = %v", err)
+	}
+
+	if plan.MakerFee != DefaultMakerFee {
+		t.Errorf("MakerFee = %v, want the default %v", plan.MakerFee, DefaultMakerFee)
+	}
+	if len(plan.Warnings) != 1 || !strings.Contains(plan.Warnings[0], "trailing") {
+		t.Errorf("warnings = %v, want only the trailing mode note", plan.Warnings)
+	}
+
+	config.Spacing = ExplicitSpacing
+	config.Prices = []float64{120, 60}
+	if _, err := planLadder(config, nil); err == nil {
+		t.Error("planLadder() should fail without price levels")
+	}
+}
+
+func TestClient_PlanTrailingEntry(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/0/public/AssetPairs" || r.URL.Query().Get("pair") != "XBTUSD" {
+			t.Errorf("unexpected request %s?%s", r.URL.Path, r.URL.RawQuery)
+		}
+		w.Write([]byte(`{"error":[],"result":{"XXBTZUSD":{"altname":"XBTUSD","wsname":"XBT/USD",
+			"pair_decimals":1,"lot_decimals":8,"ordermin":"0.0001","costmin":"0.5",
+			"fees_maker":[[0,0.25],[50000,0.24]]}}}`))
+	}))
+	defer server.Close()
+
+	client := NewTestClient(t, &TestConfig{DemoAPIURL: server.URL})
+	plan, err := client.PlanTrailingEntry(context.Background(), TrailingEntryConfig{
+		Pair:        "XBT/USD",
+		Side:        "buy",
+		UpperBand:   50000,
+		LowerBand:   45000,
+		TotalVolume: 0.01,
+		NumOrders:   5,
+	})
+	if err != nil {
+		t.Fatalf("PlanTrailingEntry() error = %v", err)
+	}
+
+	if plan.OrderMin != 0.0001 || plan.MakerFee != 0.25 || len(plan.Warnings) != 0 {
+		t.Errorf("plan = %+v", plan)
+	}
+}
@@ -0,0 +1,129 @@
+package kraken
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// Position is the net exposure in a pair: the open margin positions, or the
+// spot balance of the base asset when there are none
+type Position struct {
+	Pair     string
+	Volume   float64 // Positive for long, negative for short
+	Margin   bool
+	Leverage string // Leverage of the margin positions, for orders closing them
+}
+
+// Side returns the side of the position, or "" when it is flat
+func (p *Position) Side() string {
+	switch {
+	case p.Volume >= minRemainingVolume:
+		return "buy"
+	case p.Volume <= -minRemainingVolume:
+		return "sell"
+	}
+	return ""
+}
+
+// ClosingOrder returns the market order that closes the position
+func (p *Position) ClosingOrder() OrderRequest {
+	req := OrderRequest{
+		Pair:   p.Pair,
+		Type:   MarketOrder,
+		Side:   oppositeSide(p.Side()),
+		Volume: strconv.FormatFloat(math.Abs(p.Volume), 'f', 8, 64),
+	}
+	if p.Margin {
+		req.Leverage = p.Leverage
+		req.ReduceOnly = true
+	}
+	return req
+}
+
+func oppositeSide(side string) string {
+	if side == "buy" {
+		return "sell"
+	}
+	return "buy"
+}
+
+// positionVolume returns the signed open volume and leverage of a margin position
+func positionVolume(p PositionInfo) (float64, string) {
+	vol, _ := strconv.ParseFloat(p.Volume, 64)
+	closed, _ := strconv.ParseFloat(p.VolClosed, 64)
+	cost, _ := strconv.ParseFloat(p.Cost, 64)
+	margin, _ := strconv.ParseFloat(p.Margin, 64)
+
+	open := vol - closed
+	if p.Type == "sell" {
+		open = -open
+	}
+
+	leverage := "2"
+	if margin > 0 {
+		leverage = strconv.Itoa(int(math.Max(2, math.Round(cost/margin))))
+	}
+	return open, leverage
+}
+
+// GetPosition returns the current position in a pair. Without open margin
+// positions the whole spot balance of the base asset counts as the position.
+func (c *Client) GetPosition(ctx context.Context, pair string) (*Position, error) {
+	info, err := c.GetAssetPair(ctx, pair)
+	if err != nil {
+		return nil, err
+	}
+
+	positions, err := c.GetOpenPositions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pos := &Position{Pair: pair}
+	for _, p := range positions {
+		if p.Pair != info.Name && p.Pair != info.Altname {
+			continue
+		}
+		vol, leverage := positionVolume(p)
+		pos.Volume += vol
+		pos.Margin = true
+		pos.Leverage = leverage
+	}
+	if pos.Margin {
+		return pos, nil
+	}
+
+	balances, err := c.GetBalance(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pos.Volume = balances[info.Base]
+	return pos, nil
+}
+
+// OpenMarginPositions returns the net margin position of every pair
+func (c *Client) OpenMarginPositions(ctx context.Context) ([]*Position, error) {
+	positions, err := c.GetOpenPositions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	byPair := make(map[string]*Position)
+	var result []*Position
+	for _, p := range positions {
+		pos, ok := byPair[p.Pair]
+		if !ok {
+			pos = &Position{Pair: p.Pair, Margin: true}
+			byPair[p.Pair] = pos
+			result = append(result, pos)
+		}
+		vol, leverage := positionVolume(p)
+		pos.Volume += vol
+		pos.Leverage = leverage
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Pair < result[j].Pair })
+	return result, nil
+}
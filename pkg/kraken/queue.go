@@ -0,0 +1,386 @@
+package kraken
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type AlertStatus string
+
+const (
+	AlertQueued AlertStatus = "queued"
+	AlertDone   AlertStatus = "done"
+	AlertFailed AlertStatus = "failed"
+
+	AlertRejected AlertStatus = "rejected" // Never queued; only in responses
+)
+
+// DefaultAlertWorkers is how many alerts are processed at once
+const DefaultAlertWorkers = 4
+
+// DefaultMaxAlertAge is how old a queued alert may be when it is processed;
+// older ones, e.g. left queued by a crash, are failed instead of trading at
+// a price the signal was never about
+const DefaultMaxAlertAge = 5 * time.Minute
+
+// alertRetention is how long processed alerts are kept on disk
+const alertRetention = 7 * 24 * time.Hour
+
+// OrderResult is an order an alert placed or cancelled
+type OrderResult struct {
+	TxID        string `json:"txid"`
+	Description string `json:"description,omitempty"`
+	Cancelled   bool   `json:"cancelled,omitempty"`
+}
+
+// QueuedAlert is an alert waiting in, or processed by, the queue
+type QueuedAlert struct {
+	Seq         int64            `json:"seq"`
+	ID          string           `json:"id"`
+	Alert       TradingViewAlert `json:"alert"`
+	ReceivedAt  time.Time        `json:"received_at"`
+	Status      AlertStatus      `json:"status"`
+	Orders      []OrderResult    `json:"orders,omitempty"`
+	Error       string           `json:"error,omitempty"`
+	Code        ErrorCode        `json:"code,omitempty"`
+	ProcessedAt time.Time        `json:"processed_at,omitempty"`
+	Bracket     *Bracket         `json:"bracket,omitempty"`
+	Reverse     *ReverseLeg      `json:"reverse,omitempty"`
+
+	err  error
+	done chan struct{} // Closed once processed
+}
+
+// ReverseLeg is the opening leg of a reverse whose position has been closed.
+// It is saved before the leg is placed, as a retry finds no position left.
+type ReverseLeg struct {
+	Closed []OrderResult `json:"closed"`
+	Side   string        `json:"side"`
+	Volume string        `json:"volume"`
+}
+
+// clOrdID returns the cl_ord_id of an order the alert places, leg telling
+// its orders apart. It is derived from this queue entry rather than the
+// alert ID, so that only a retry of the entry finds the orders it placed,
+// and is tagged with the alert's strategy.
+func (a *QueuedAlert) clOrdID(leg string) string {
+	return strategyClOrdID(a.Alert.Strategy, fmt.Sprintf("%s/%d/%d/%s", a.ID, a.Seq, a.ReceivedAt.UnixNano(), leg))
+}
+
+// response returns what the sender is told about a processed alert
+func (a *QueuedAlert) response() (int, WebhookResponse) {
+	resp := WebhookResponse{AlertID: a.ID, Status: a.Status, Orders: a.Orders}
+	if a.err == nil {
+		return http.StatusOK, resp
+	}
+
+	failure, status := classifyError(a.err)
+	resp.Error = &failure
+	return status, resp
+}
+
+// retryable reports whether the alert failed before any of its orders could
+// reach the exchange
+func (a *QueuedAlert) retryable() bool {
+	return a.err != nil && len(a.Orders) == 0 && retryable(a.err)
+}
+
+// alertLane holds the queued alerts of the pairs one worker processes
+type alertLane struct {
+	items  []*QueuedAlert
+	notify chan struct{}
+	mu     sync.Mutex
+}
+
+func (l *alertLane) push(a *QueuedAlert) {
+	l.mu.Lock()
+	l.items = append(l.items, a)
+	l.mu.Unlock()
+
+	select {
+	case l.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (l *alertLane) pop() *QueuedAlert {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.items) == 0 {
+		return nil
+	}
+	a := l.items[0]
+	l.items = l.items[1:]
+	return a
+}
+
+// AlertQueue persists alerts to disk before they are processed, so that none
+// is lost on a restart. Each pair is always processed by the same worker,
+// keeping its alerts in the order they arrived.
+type AlertQueue struct {
+	client   *Client
+	dir      string
+	lanes    []*alertLane
+	seq      int64
+	mu       sync.Mutex
+	brackets []*QueuedAlert // Processed alerts whose take-profit is watched
+	bmu      sync.Mutex
+	dedupe   *AlertDeduper
+	maxAge   time.Duration
+	spotAll  bool // close and reverse may sell the whole spot balance
+}
+
+// NewAlertQueue keeps queued alerts as JSON files in dir
+func NewAlertQueue(client *Client, dir string, workers int) (*AlertQueue, error) {
+	if workers <= 0 {
+		workers = DefaultAlertWorkers
+	}
+
+	q := &AlertQueue{client: client, dir: dir, maxAge: DefaultMaxAlertAge}
+	for i := 0; i < workers; i++ {
+		q.lanes = append(q.lanes, &alertLane{notify: make(chan struct{}, 1)})
+	}
+
+	pending, err := q.load()
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range pending {
+		q.lane(a.Alert.Pair).push(a)
+	}
+	if len(pending) > 0 {
+		fmt.Printf("Resuming %d queued alerts\n", len(pending))
+	}
+
+	return q, nil
+}
+
+// SetDeduper records the result of every processed alert in d, so that
+// repeats of the alert are answered with it
+func (q *AlertQueue) SetDeduper(d *AlertDeduper) {
+	q.dedupe = d
+}
+
+// SetMaxAlertAge sets how old an alert may be when it is processed; 0
+// processes alerts however old they are
+func (q *AlertQueue) SetMaxAlertAge(age time.Duration) {
+	q.maxAge = age
+}
+
+// SetCloseSpotBalance lets close and reverse alerts without a volume treat
+// the whole spot balance of the base asset as the position. Without it such
+// alerts need a volume on spot.
+func (q *AlertQueue) SetCloseSpotBalance(enabled bool) {
+	q.spotAll = enabled
+}
+
+// load reads the saved alerts, returning those still queued in order and
+// removing processed ones past their retention
+func (q *AlertQueue) load() ([]*QueuedAlert, error) {
+	entries, err := os.ReadDir(q.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read alert queue: %w", err)
+	}
+
+	var pending []*QueuedAlert
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+
+		var a QueuedAlert
+		if _, err := loadState(filepath.Join(q.dir, e.Name()), &a); err != nil {
+			return nil, err
+		}
+		if a.Seq > q.seq {
+			q.seq = a.Seq
+		}
+
+		switch {
+		case a.Status == AlertQueued:
+			a.done = make(chan struct{})
+			pending = append(pending, &a)
+		case a.Bracket != nil && !a.Bracket.Done:
+			q.brackets = append(q.brackets, &a)
+		case time.Since(a.ProcessedAt) > alertRetention:
+			os.Remove(filepath.Join(q.dir, e.Name()))
+		}
+	}
+
+	sort.Slice(pending, func(i, j int) bool { return pending[i].Seq < pending[j].Seq })
+	return pending, nil
+}
+
+// lane returns the lane a pair's alerts are processed in
+func (q *AlertQueue) lane(pair string) *alertLane {
+	h := fnv.New32a()
+	h.Write([]byte(pair))
+	return q.lanes[h.Sum32()%uint32(len(q.lanes))]
+}
+
+func (q *AlertQueue) path(seq int64) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%012d.json", seq))
+}
+
+// Enqueue saves an alert and queues it for processing. Alerts are saved one
+// at a time so that a pair's lane receives them in sequence.
+func (q *AlertQueue) Enqueue(id string, alert TradingViewAlert) (*QueuedAlert, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.seq++
+	a := &QueuedAlert{
+		Seq:        q.seq,
+		ID:         id,
+		Alert:      alert,
+		ReceivedAt: time.Now(),
+		Status:     AlertQueued,
+		done:       make(chan struct{}),
+	}
+
+	// Never keep the passphrase on disk
+	a.Alert.Passphrase = ""
+	if err := saveState(q.path(a.Seq), a); err != nil {
+		return nil, fmt.Errorf("failed to queue alert %s: %w", id, err)
+	}
+
+	q.lane(alert.Pair).push(a)
+	return a, nil
+}
+
+// Len returns how many alerts are waiting
+func (q *AlertQueue) Len() int {
+	n := 0
+	for _, l := range q.lanes {
+		l.mu.Lock()
+		n += len(l.items)
+		l.mu.Unlock()
+	}
+	return n
+}
+
+// Run processes queued alerts and watches their brackets until ctx is done.
+// An alert already being processed is finished first; the rest stay queued
+// on disk for the next run.
+func (q *AlertQueue) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		q.watchBrackets(ctx)
+	}()
+	for _, l := range q.lanes {
+		wg.Add(1)
+		go func(l *alertLane) {
+			defer wg.Done()
+			q.work(ctx, l)
+		}(l)
+	}
+	wg.Wait()
+}
+
+// Drain waits until no alert is waiting, or until ctx is done. Run still
+// has to be stopped to finish the alerts being processed.
+func (q *AlertQueue) Drain(ctx context.Context) error {
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+	for q.Len() > 0 {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%d alerts left queued: %w", q.Len(), ctx.Err())
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+func (q *AlertQueue) work(ctx context.Context, l *alertLane) {
+	for {
+		for ctx.Err() == nil {
+			a := l.pop()
+			if a == nil {
+				break
+			}
+			q.process(context.WithoutCancel(ctx), a)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-l.notify:
+		}
+	}
+}
+
+// process carries out the alert and saves the outcome
+func (q *AlertQueue) process(ctx context.Context, a *QueuedAlert) {
+	defer close(a.done)
+
+	var orders []OrderResult
+	var err error
+	if age := time.Since(a.ReceivedAt); q.maxAge > 0 && age > q.maxAge {
+		err = reject(InvalidAlert, "alert is stale: received %s ago", age.Round(time.Second))
+	} else {
+		orders, err = q.execute(ctx, a)
+	}
+
+	a.ProcessedAt = time.Now()
+	a.Orders = orders
+	a.err = err
+	if err != nil {
+		failure, _ := classifyError(err)
+		a.Status = AlertFailed
+		a.Error = err.Error()
+		a.Code = failure.Code
+		fmt.Printf("Alert %s (%s %s) failed: %v\n", a.ID, a.Alert.Action, a.Alert.Pair, err)
+	} else {
+		a.Status = AlertDone
+		var txids []string
+		for _, o := range orders {
+			txids = append(txids, o.TxID)
+		}
+		fmt.Printf("Alert %s (%s %s) done: %s\n", a.ID, a.Alert.Action, a.Alert.Pair, strings.Join(txids, ", "))
+	}
+
+	if err := saveState(q.path(a.Seq), a); err != nil {
+		fmt.Printf("failed to save alert %s: %v\n", a.ID, err)
+	}
+	if a.Bracket != nil {
+		q.addBracket(a)
+	}
+	q.record(a)
+}
+
+// record remembers the response to a processed alert for its repeats, or
+// frees its ID when it can safely be retried
+func (q *AlertQueue) record(a *QueuedAlert) {
+	if q.dedupe == nil {
+		return
+	}
+
+	var err error
+	if a.retryable() {
+		err = q.dedupe.Release(a.ID)
+	} else {
+		status, resp := a.response()
+		data, _ := json.Marshal(resp)
+		err = q.dedupe.Finish(a.ID, status, string(data))
+	}
+	if err != nil {
+		fmt.Printf("failed to record result of alert %s: %v\n", a.ID, err)
+	}
+}
@@ -0,0 +1,132 @@
+package kraken
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestAlertQueue_SurvivesRestart(t *testing.T) {
+	api := newMockTradingAPI()
+	defer api.Close()
+	client := NewTestClient(t, &TestConfig{DemoAPIURL: api.URL})
+	dir := t.TempDir()
+
+	queue, err := NewAlertQueue(client, dir, 2)
+	if err != nil {
+		t.Fatalf("NewAlertQueue() error = %v", err)
+	}
+	for i, volume := range []float64{1, 2, 3} {
+		alert := TradingViewAlert{Action: "buy", Pair: "XBTUSD", Volume: volume, OrderType: "market", Passphrase: "secret"}
+		if _, err := queue.Enqueue(string(rune('a'+i)), alert); err != nil {
+			t.Fatalf("Enqueue() error = %v", err)
+		}
+	}
+
+	// Nothing was processed before the "crash"
+	restarted, err := NewAlertQueue(client, dir, 2)
+	if err != nil {
+		t.Fatalf("NewAlertQueue() error = %v", err)
+	}
+	if restarted.Len() != 3 {
+		t.Fatalf("Len() = %d after restart, want 3", restarted.Len())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		restarted.Run(ctx)
+		close(done)
+	}()
+	waitForOrders(t, api, 3)
+	cancel()
+	<-done
+
+	for i, want := range []string{"1.00000000", "2.00000000", "3.00000000"} {
+		if got := api.placed[i].Get("volume"); got != want {
+			t.Errorf("order %d volume = %s, want %s", i, got, want)
+		}
+	}
+
+	var saved QueuedAlert
+	if _, err := loadState(restarted.path(1), &saved); err != nil {
+		t.Fatalf("loadState() error = %v", err)
+	}
+	if saved.Status != AlertDone || len(saved.Orders) != 1 || saved.Alert.Passphrase != "" {
+		t.Errorf("saved alert = %+v, want done with a txid and no passphrase", saved)
+	}
+
+	// Processed alerts are not replayed by the next run
+	again, err := NewAlertQueue(client, dir, 2)
+	if err != nil {
+		t.Fatalf("NewAlertQueue() error = %v", err)
+	}
+	if again.Len() != 0 {
+		t.Errorf("Len() = %d, want processed alerts not requeued", again.Len())
+	}
+	if a, err := again.Enqueue("d", TradingViewAlert{Pair: "XBTUSD"}); err != nil || a.Seq != 4 {
+		t.Errorf("Enqueue() seq = %v, err = %v, want sequence continued at 4", a, err)
+	}
+}
+
+func TestAlertQueue_RecordsFailures(t *testing.T) {
+	api := newMockTradingAPI()
+	defer api.Close()
+	api.reject[1] = true
+	client := NewTestClient(t, &TestConfig{DemoAPIURL: api.URL})
+
+	queue, err := NewAlertQueue(client, t.TempDir(), 1)
+	if err != nil {
+		t.Fatalf("NewAlertQueue() error = %v", err)
+	}
+	a, err := queue.Enqueue("a", TradingViewAlert{Action: "buy", Pair: "XBTUSD", Volume: 1, OrderType: "market"})
+	if err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+
+	queue.process(context.Background(), queue.lanes[0].pop())
+
+	var saved QueuedAlert
+	if _, err := loadState(queue.path(a.Seq), &saved); err != nil {
+		t.Fatalf("loadState() error = %v", err)
+	}
+	if saved.Status != AlertFailed || saved.Error == "" || saved.Code != RiskRejected {
+		t.Errorf("saved alert = %+v, want failed with an error", saved)
+	}
+	if _, err := os.Stat(queue.path(a.Seq)); err != nil {
+		t.Errorf("failed alert should stay on disk: %v", err)
+	}
+}
+
+func TestAlertQueue_FailsStaleAlerts(t *testing.T) {
+	api := newMockTradingAPI()
+	defer api.Close()
+	client := NewTestClient(t, &TestConfig{DemoAPIURL: api.URL})
+	dir := t.TempDir()
+
+	queue, err := NewAlertQueue(client, dir, 1)
+	if err != nil {
+		t.Fatalf("NewAlertQueue() error = %v", err)
+	}
+	a, err := queue.Enqueue("a", TradingViewAlert{Action: "buy", Pair: "XBTUSD", Volume: 1, OrderType: "market"})
+	if err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+
+	// Left queued by a crash an hour ago
+	a.ReceivedAt = time.Now().Add(-time.Hour)
+	if err := saveState(queue.path(a.Seq), a); err != nil {
+		t.Fatal(err)
+	}
+	restarted, err := NewAlertQueue(client, dir, 1)
+	if err != nil {
+		t.Fatalf("NewAlertQueue() error = %v", err)
+	}
+	stale := restarted.lanes[0].pop()
+	restarted.process(context.Background(), stale)
+
+	if stale.Status != AlertFailed || stale.Code != InvalidAlert || len(api.placed) != 0 {
+		t.Errorf("stale alert = %+v, placed %d, want failed without orders", stale, len(api.placed))
+	}
+}
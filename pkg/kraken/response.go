@@ -0,0 +1,139 @@
+package kraken
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ErrorCode classifies why an alert failed, for the senders of alerts
+type ErrorCode string
+
+const (
+	AuthFailed     ErrorCode = "auth_failed"     // Source, signature or passphrase rejected
+	InvalidAlert   ErrorCode = "invalid_alert"   // Malformed alert or order parameters
+	RiskRejected   ErrorCode = "risk_rejected"   // Size, funds, margin or position checks failed
+	ExchangeError  ErrorCode = "exchange_error"  // Kraken failed or could not be reached
+	DuplicateAlert ErrorCode = "duplicate_alert" // A repeat of an alert still being processed
+	InternalError  ErrorCode = "internal_error"
+)
+
+// Status returns the HTTP status a failure with the code is answered with
+func (c ErrorCode) Status() int {
+	switch c {
+	case AuthFailed:
+		return http.StatusUnauthorized
+	case InvalidAlert:
+		return http.StatusBadRequest
+	case RiskRejected:
+		return http.StatusUnprocessableEntity
+	case ExchangeError:
+		return http.StatusBadGateway
+	case DuplicateAlert:
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// WebhookResponse is the JSON body of every webhook response
+type WebhookResponse struct {
+	AlertID string         `json:"alert_id,omitempty"`
+	Status  AlertStatus    `json:"status"`
+	Orders  []OrderResult  `json:"orders,omitempty"`
+	Error   *ResponseError `json:"error,omitempty"`
+}
+
+// ResponseError tells the sender why an alert failed without passing on the
+// exchange's own error text
+type ResponseError struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+}
+
+// rejection is an alert refused by the bot's own checks, whose message is
+// safe to return
+type rejection struct {
+	code ErrorCode
+	msg  string
+}
+
+func (e *rejection) Error() string {
+	return e.msg
+}
+
+func reject(code ErrorCode, format string, args ...interface{}) error {
+	return &rejection{code: code, msg: fmt.Sprintf(format, args...)}
+}
+
+// krakenErrors classifies Kraken errors by prefix. Temporary failures are
+// answered with 503; rate limits and lockouts refuse a request before it is
+// processed, so they also free the alert ID for a retry.
+var krakenErrors = []struct {
+	prefix  string
+	code    ErrorCode
+	status  int
+	message string
+	retry   bool
+}{
+	{"EOrder:Insufficient funds", RiskRejected, http.StatusUnprocessableEntity, "insufficient funds", false},
+	{"EOrder:Insufficient margin", RiskRejected, http.StatusUnprocessableEntity, "insufficient margin", false},
+	{"EOrder:Margin allowance exceeded", RiskRejected, http.StatusUnprocessableEntity, "margin allowance exceeded", false},
+	{"EOrder:Margin level too low", RiskRejected, http.StatusUnprocessableEntity, "margin level too low", false},
+	{"EOrder:Order minimum not met", RiskRejected, http.StatusUnprocessableEntity, "order below the exchange minimum", false},
+	{"EOrder:Orders limit exceeded", RiskRejected, http.StatusUnprocessableEntity, "too many open orders", false},
+	{"EOrder:Positions limit exceeded", RiskRejected, http.StatusUnprocessableEntity, "too many open positions", false},
+	{"EQuery:Unknown asset pair", InvalidAlert, http.StatusBadRequest, "unknown pair", false},
+	{"EOrder:Invalid price", InvalidAlert, http.StatusBadRequest, "invalid price", false},
+	{"EGeneral:Invalid arguments", InvalidAlert, http.StatusBadRequest, "invalid order parameters", false},
+	{"EAPI:Rate limit exceeded", ExchangeError, http.StatusServiceUnavailable, "exchange rate limit exceeded", true},
+	{"EOrder:Rate limit exceeded", ExchangeError, http.StatusServiceUnavailable, "exchange rate limit exceeded", true},
+	{"EGeneral:Temporary lockout", ExchangeError, http.StatusServiceUnavailable, "exchange temporarily locked out", true},
+	{"EService:", ExchangeError, http.StatusServiceUnavailable, "exchange unavailable", false},
+}
+
+// classifyError returns what the sender of an alert is told about err, and
+// the HTTP status to tell it with
+func classifyError(err error) (ResponseError, int) {
+	var rejected *rejection
+	if errors.As(err, &rejected) {
+		return ResponseError{Code: rejected.code, Message: rejected.msg}, rejected.code.Status()
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		for _, e := range apiErr.Errors {
+			for _, k := range krakenErrors {
+				if strings.HasPrefix(e, k.prefix) {
+					return ResponseError{Code: k.code, Message: k.message}, k.status
+				}
+			}
+		}
+		return ResponseError{Code: ExchangeError, Message: "rejected by the exchange"}, http.StatusBadGateway
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return ResponseError{Code: ExchangeError, Message: "exchange unreachable"}, http.StatusServiceUnavailable
+	}
+	return ResponseError{Code: InternalError, Message: "alert processing failed"}, http.StatusInternalServerError
+}
+
+// retryable reports whether err certainly stopped an alert's order before
+// the exchange accepted it. Lost responses and unknown failures are not: the
+// order may have been placed.
+func retryable(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	for _, e := range apiErr.Errors {
+		for _, k := range krakenErrors {
+			if strings.HasPrefix(e, k.prefix) {
+				return k.retry
+			}
+		}
+	}
+	return false
+}
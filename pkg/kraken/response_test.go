@@ -0,0 +1,111 @@
+package kraken
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantCode   ErrorCode
+		wantStatus int
+	}{
+		{"own check", reject(RiskRejected, "too small"), RiskRejected, http.StatusUnprocessableEntity},
+		{"insufficient funds", fmt.Errorf("failed: %w", &APIError{Errors: []string{"EOrder:Insufficient funds"}}), RiskRejected, http.StatusUnprocessableEntity},
+		{"unknown pair", &APIError{Errors: []string{"EQuery:Unknown asset pair"}}, InvalidAlert, http.StatusBadRequest},
+		{"unavailable", &APIError{Errors: []string{"EService:Unavailable"}}, ExchangeError, http.StatusServiceUnavailable},
+		{"invalid key", &APIError{Errors: []string{"EAPI:Invalid key"}}, ExchangeError, http.StatusBadGateway},
+		{"unreachable", &url.Error{Op: "Post", URL: "https://api.kraken.com", Err: context.DeadlineExceeded}, ExchangeError, http.StatusServiceUnavailable},
+		{"other", fmt.Errorf("disk full"), InternalError, http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, status := classifyError(tt.err)
+			if got.Code != tt.wantCode || status != tt.wantStatus {
+				t.Errorf("classifyError() = %s %d, want %s %d", got.Code, status, tt.wantCode, tt.wantStatus)
+			}
+			if strings.Contains(got.Message, "API error") || strings.Contains(got.Message, "EAPI") {
+				t.Errorf("message %q passes on the exchange's error", got.Message)
+			}
+		})
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&APIError{Errors: []string{"EAPI:Rate limit exceeded"}}, true},
+		{&APIError{Errors: []string{"EService:Unavailable"}}, false},
+		{&APIError{Errors: []string{"EOrder:Insufficient funds"}}, false},
+		{&net.OpError{Op: "read", Err: errors.New("timeout")}, false},
+		{errors.New("failed to parse response"), false},
+	}
+	for _, tt := range tests {
+		if got := retryable(tt.err); got != tt.want {
+			t.Errorf("retryable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestWebhookHandler_Responses(t *testing.T) {
+	api := newMockTradingAPI()
+	defer api.Close()
+	api.reject[2] = true
+	client := NewTestClient(t, &TestConfig{DemoAPIURL: api.URL})
+
+	queue, err := NewAlertQueue(client, t.TempDir(), 1)
+	if err != nil {
+		t.Fatalf("NewAlertQueue() error = %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go queue.Run(ctx)
+
+	handler := WebhookHandler(queue, WebhookConfig{Auth: WebhookAuth{Passphrase: "hunter2"}, ResponseWait: 2 * time.Second})
+	send := func(body string) (int, WebhookResponse) {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body)))
+
+		var resp WebhookResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("response %q is not JSON: %v", rec.Body, err)
+		}
+		return rec.Code, resp
+	}
+
+	status, resp := send(`{"action":"buy","pair":"XBTUSD","volume":0.1,"orderType":"market","passphrase":"hunter2"}`)
+	if status != http.StatusOK || resp.Status != AlertDone || resp.AlertID == "" ||
+		len(resp.Orders) != 1 || resp.Orders[0].TxID != "TX-1" || resp.Orders[0].Description == "" {
+		t.Errorf("placed: %d %+v", status, resp)
+	}
+
+	status, resp = send(`{"action":"sell","pair":"XBTUSD","volume":0.1,"orderType":"market","passphrase":"hunter2"}`)
+	if status != http.StatusUnprocessableEntity || resp.Status != AlertFailed ||
+		resp.Error == nil || resp.Error.Code != RiskRejected || strings.Contains(resp.Error.Message, "EOrder") {
+		t.Errorf("rejected by the exchange: %d %+v", status, resp)
+	}
+
+	status, resp = send(`{"action":"buy","pair":"XBTUSD","volume":0.1,"orderType":"market","passphrase":"wrong"}`)
+	if status != http.StatusUnauthorized || resp.Status != AlertRejected || resp.Error == nil || resp.Error.Code != AuthFailed {
+		t.Errorf("wrong passphrase: %d %+v", status, resp)
+	}
+
+	status, resp = send(`{"action":"buy","pair":"XBTUSD","orderType":"market","passphrase":"hunter2"}`)
+	if status != http.StatusBadRequest || resp.Error == nil || resp.Error.Code != InvalidAlert {
+		t.Errorf("invalid alert: %d %+v", status, resp)
+	}
+}
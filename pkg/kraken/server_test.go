@@ -0,0 +1,197 @@
+package kraken
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewWebhookServer_BodyLimit(t *testing.T) {
+	queue, err := NewAlertQueue(nil, t.TempDir(), 1)
+	if err != nil {
+		t.Fatalf("NewAlertQueue() error = %v", err)
+	}
+	srv, err := NewWebhookServer(ServerConfig{MaxBodyBytes: 100}, WebhookHandler(queue, WebhookConfig{}))
+	if err != nil {
+		t.Fatalf("NewWebhookServer() error = %v", err)
+	}
+	if srv.ReadTimeout != DefaultReadTimeout || srv.WriteTimeout != DefaultWriteTimeout {
+		t.Errorf("timeouts = %v, %v, want defaults", srv.ReadTimeout, srv.WriteTimeout)
+	}
+
+	body := `{"action":"buy","pair":"XBTUSD","volume":0.1,"orderType":"market","strategy":"` + strings.Repeat("x", 100) + `"}`
+	rec := httptest.NewRecorder()
+	srv.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body)))
+	if rec.Code != http.StatusRequestEntityTooLarge || queue.Len() != 0 {
+		t.Errorf("status = %d, queued %d, want 413 and nothing queued", rec.Code, queue.Len())
+	}
+}
+
+func TestNewWebhookServer_TLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+
+	if _, err := NewWebhookServer(ServerConfig{CertFile: certFile}, http.NotFoundHandler()); err == nil {
+		t.Error("a certificate without a key should be rejected")
+	}
+	if _, err := NewWebhookServer(ServerConfig{CertFile: certFile, KeyFile: keyFile}, http.NotFoundHandler()); err == nil {
+		t.Error("missing certificate files should be rejected")
+	}
+
+	writeTestCert(t, certFile, keyFile, "first")
+	srv, err := NewWebhookServer(ServerConfig{CertFile: certFile, KeyFile: keyFile}, http.NotFoundHandler())
+	if err != nil {
+		t.Fatalf("NewWebhookServer() error = %v", err)
+	}
+	first, err := srv.TLSConfig.GetCertificate(nil)
+	if err != nil || first.Leaf == nil || first.Leaf.Subject.CommonName != "first" {
+		t.Fatalf("GetCertificate() = %v, %v", first, err)
+	}
+
+	// A renewed certificate is served without a restart
+	writeTestCert(t, certFile, keyFile, "renewed")
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+	renewed, err := srv.TLSConfig.GetCertificate(nil)
+	if err != nil || renewed.Leaf.Subject.CommonName != "renewed" {
+		t.Errorf("GetCertificate() after renewal = %v, %v", renewed.Leaf.Subject, err)
+	}
+
+	// A half-written renewal keeps the old certificate
+	os.WriteFile(keyFile, []byte("garbage"), 0600)
+	os.Chtimes(keyFile, later.Add(time.Minute), later.Add(time.Minute))
+	if kept, err := srv.TLSConfig.GetCertificate(nil); err != nil || kept != renewed {
+		t.Errorf("GetCertificate() with a broken key = %v, %v, want the previous certificate", kept, err)
+	}
+}
+
+func TestServeWebhook_Shutdown(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	srv, err := NewWebhookServer(ServerConfig{}, handler)
+	if err != nil {
+		t.Fatalf("NewWebhookServer() error = %v", err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() { errCh <- serve(ctx, srv, ln, 2*time.Second) }()
+
+	respCh := make(chan int, 1)
+	go func() {
+		resp, err := http.Post("http://"+ln.Addr().String(), "application/json", strings.NewReader("{}"))
+		if err != nil {
+			respCh <- 0
+			return
+		}
+		resp.Body.Close()
+		respCh <- resp.StatusCode
+	}()
+
+	<-started
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	if status := <-respCh; status != http.StatusAccepted {
+		t.Errorf("request in flight got %d, want it answered before shutdown", status)
+	}
+	if err := <-errCh; err != nil {
+		t.Errorf("ServeWebhook() error = %v", err)
+	}
+}
+
+func TestAlertQueue_Drain(t *testing.T) {
+	api := newMockTradingAPI()
+	defer api.Close()
+	client := NewTestClient(t, &TestConfig{DemoAPIURL: api.URL})
+
+	queue, err := NewAlertQueue(client, t.TempDir(), 1)
+	if err != nil {
+		t.Fatalf("NewAlertQueue() error = %v", err)
+	}
+	for _, id := range []string{"a", "b"} {
+		if _, err := queue.Enqueue(id, TradingViewAlert{Action: "buy", Pair: "XBTUSD", Volume: 1, OrderType: "market"}); err != nil {
+			t.Fatalf("Enqueue() error = %v", err)
+		}
+	}
+
+	short, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := queue.Drain(short); err == nil {
+		t.Error("Drain() without a running queue should time out")
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		queue.Run(ctx)
+		close(done)
+	}()
+
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancelDrain()
+	if err := queue.Drain(drainCtx); err != nil {
+		t.Errorf("Drain() error = %v", err)
+	}
+	stop()
+	<-done
+
+	if len(api.placed) != 2 {
+		t.Errorf("placed %d orders, want both queued alerts processed", len(api.placed))
+	}
+}
+
+// writeTestCert writes a self-signed certificate for name
+func writeTestCert(t *testing.T, certFile, keyFile, name string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
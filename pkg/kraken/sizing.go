@@ -0,0 +1,194 @@
+package kraken
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+)
+
+type SizingMode string
+
+const (
+	BaseSizing    SizingMode = "base"    // Size is the volume in the base asset
+	QuoteSizing   SizingMode = "quote"   // Size is the notional in the quote asset
+	PercentSizing SizingMode = "percent" // Size is a percentage of the available quote balance
+	RiskSizing    SizingMode = "risk"    // Size is the percentage of equity lost if stopPrice is hit
+)
+
+// SizingRule decides the volume of an alert's order
+type SizingRule struct {
+	Mode SizingMode `json:"mode" mapstructure:"mode"`
+	Size float64    `json:"size" mapstructure:"size"`
+}
+
+// SizingConfig holds the sizing rules alerts fall back to when they do not
+// choose one themselves
+type SizingConfig struct {
+	Strategies map[string]SizingRule // By alert strategy
+	Default    *SizingRule           // For alerts without a volume or a strategy rule
+}
+
+// apply resolves the rule for an alert: its own sizing, its strategy's rule,
+// its volume, then the default rule
+func (c *SizingConfig) apply(alert *TradingViewAlert) {
+	if alert.Sizing != "" {
+		return
+	}
+
+	rule, ok := c.Strategies[alert.Strategy]
+	switch {
+	case ok:
+	case alert.Volume > 0:
+		return
+	case c.Default != nil:
+		rule = *c.Default
+	default:
+		return
+	}
+	alert.Sizing, alert.Size = string(rule.Mode), rule.Size
+}
+
+func (r SizingRule) Validate() error {
+	switch r.Mode {
+	case BaseSizing, QuoteSizing:
+	case PercentSizing, RiskSizing:
+		if r.Size > 100 {
+			return fmt.Errorf("%s sizing must be at most 100 percent", r.Mode)
+		}
+	default:
+		return fmt.Errorf("invalid sizing %q: must be base, quote, percent or risk", r.Mode)
+	}
+	if r.Size <= 0 {
+		return fmt.Errorf("size must be positive")
+	}
+	return nil
+}
+
+// validateSizing checks the alert's sizing for an order on side
+func (a *TradingViewAlert) validateSizing(side string) error {
+	if a.Sizing == "" {
+		if a.Volume <= 0 {
+			return fmt.Errorf("volume or sizing is required")
+		}
+		return nil
+	}
+
+	if err := (SizingRule{Mode: SizingMode(a.Sizing), Size: a.Size}).Validate(); err != nil {
+		return err
+	}
+	if SizingMode(a.Sizing) == RiskSizing {
+		if a.StopPrice <= 0 {
+			return fmt.Errorf("risk sizing needs a stopPrice")
+		}
+		if a.Price > 0 && ((side == "buy" && a.StopPrice >= a.Price) || (side == "sell" && a.StopPrice <= a.Price)) {
+			return fmt.Errorf("stopPrice must be on the losing side of the entry")
+		}
+	}
+	return nil
+}
+
+// GetAvailableBalance returns the balance of every asset less what open
+// orders hold, keyed by Kraken's asset name
+func (c *Client) GetAvailableBalance(ctx context.Context) (map[string]float64, error) {
+	var result map[string]struct {
+		Balance   string `json:"balance"`
+		HoldTrade string `json:"hold_trade"`
+	}
+	if err := c.privateRequest(ctx, "/0/private/BalanceEx", url.Values{}, &result); err != nil {
+		return nil, fmt.Errorf("failed to get balance: %w", err)
+	}
+
+	balances := make(map[string]float64, len(result))
+	for asset, b := range result {
+		total, _ := strconv.ParseFloat(b.Balance, 64)
+		held, _ := strconv.ParseFloat(b.HoldTrade, 64)
+		balances[asset] = total - held
+	}
+	return balances, nil
+}
+
+// GetEquity returns the account's equity, including unrealised margin
+// profit and loss, valued in asset
+func (c *Client) GetEquity(ctx context.Context, asset string) (float64, error) {
+	data := url.Values{}
+	data.Set("asset", asset)
+
+	var result struct {
+		Equity string `json:"e"`
+	}
+	if err := c.privateRequest(ctx, "/0/private/TradeBalance", data, &result); err != nil {
+		return 0, fmt.Errorf("failed to get trade balance: %w", err)
+	}
+
+	equity, err := strconv.ParseFloat(result.Equity, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid equity %q: %w", result.Equity, err)
+	}
+	return equity, nil
+}
+
+// sizeOrder works out the base volume of an alert's order on side, rounded
+// down to the pair's lot size
+func (q *AlertQueue) sizeOrder(ctx context.Context, alert *TradingViewAlert, side string) (float64, error) {
+	mode := SizingMode(alert.Sizing)
+	if mode == "" || (mode == BaseSizing && alert.Size <= 0) {
+		return alert.Volume, nil
+	}
+	if mode == BaseSizing {
+		return alert.Size, nil
+	}
+
+	info, err := q.client.GetAssetPair(ctx, alert.Pair)
+	if err != nil {
+		return 0, err
+	}
+
+	price := alert.Price
+	if price <= 0 {
+		ticker, err := q.client.GetTickerPrice(ctx, alert.Pair)
+		if err != nil {
+			return 0, err
+		}
+		price = ticker.Ask
+		if side == "sell" {
+			price = ticker.Bid
+		}
+	}
+
+	var volume float64
+	switch mode {
+	case QuoteSizing:
+		volume = alert.Size / price
+
+	case PercentSizing:
+		balances, err := q.client.GetAvailableBalance(ctx)
+		if err != nil {
+			return 0, err
+		}
+		volume = balances[info.Quote] * alert.Size / 100 / price
+
+	case RiskSizing:
+		equity, err := q.client.GetEquity(ctx, info.Quote)
+		if err != nil {
+			return 0, err
+		}
+		distance := price - alert.StopPrice
+		if side == "sell" {
+			distance = -distance
+		}
+		if distance <= 0 {
+			return 0, reject(RiskRejected, "stop %.2f is on the wrong side of a %s entry at %.2f", alert.StopPrice, side, price)
+		}
+		volume = equity * alert.Size / 100 / distance
+	}
+
+	lot := math.Pow(10, float64(info.LotDecimals))
+	volume = math.Floor(volume*lot+1e-6) / lot
+
+	if min, _ := strconv.ParseFloat(info.OrderMin, 64); volume <= 0 || volume < min {
+		return 0, reject(RiskRejected, "%s sizing gives %.8f %s, below the minimum order of %s", mode, volume, alert.Pair, info.OrderMin)
+	}
+	return volume, nil
+}
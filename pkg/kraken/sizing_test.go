@@ -0,0 +1,99 @@
+package kraken
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSizingConfig_Apply(t *testing.T) {
+	config := SizingConfig{
+		Strategies: map[string]SizingRule{"trend": {Mode: RiskSizing, Size: 1}},
+		Default:    &SizingRule{Mode: QuoteSizing, Size: 100},
+	}
+
+	tests := []struct {
+		name     string
+		alert    TradingViewAlert
+		wantMode string
+		wantSize float64
+	}{
+		{"alert chooses", TradingViewAlert{Strategy: "trend", Sizing: "percent", Size: 5}, "percent", 5},
+		{"strategy rule", TradingViewAlert{Strategy: "trend", Volume: 2}, "risk", 1},
+		{"alert volume", TradingViewAlert{Strategy: "other", Volume: 2}, "", 0},
+		{"default", TradingViewAlert{Strategy: "other"}, "quote", 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alert := tt.alert
+			config.apply(&alert)
+			if alert.Sizing != tt.wantMode || alert.Size != tt.wantSize {
+				t.Errorf("apply() = %s %v, want %s %v", alert.Sizing, alert.Size, tt.wantMode, tt.wantSize)
+			}
+		})
+	}
+}
+
+func TestTradingViewAlert_ValidateSizing(t *testing.T) {
+	tests := []struct {
+		name    string
+		alert   TradingViewAlert
+		wantErr bool
+	}{
+		{"volume", TradingViewAlert{Volume: 1}, false},
+		{"nothing", TradingViewAlert{}, true},
+		{"quote", TradingViewAlert{Sizing: "quote", Size: 500}, false},
+		{"unknown mode", TradingViewAlert{Sizing: "kelly", Size: 1}, true},
+		{"percent over 100", TradingViewAlert{Sizing: "percent", Size: 150}, true},
+		{"risk without stop", TradingViewAlert{Sizing: "risk", Size: 1}, true},
+		{"risk with stop above buy", TradingViewAlert{Sizing: "risk", Size: 1, Price: 100, StopPrice: 110}, true},
+		{"risk", TradingViewAlert{Sizing: "risk", Size: 1, Price: 100, StopPrice: 90}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.alert.validateSizing("buy"); (err != nil) != tt.wantErr {
+				t.Errorf("validateSizing() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAlertQueue_SizeOrder(t *testing.T) {
+	queue, api := newTestActionQueue(t)
+	api.ticker = 50000
+	api.balances["ZUSD"] = "10000"
+	api.balances["equity"] = "20000"
+
+	tests := []struct {
+		name    string
+		alert   TradingViewAlert
+		side    string
+		want    float64
+		wantErr bool
+	}{
+		{"volume", TradingViewAlert{Volume: 0.3}, "buy", 0.3, false},
+		{"base", TradingViewAlert{Sizing: "base", Size: 0.7, Volume: 0.3}, "buy", 0.7, false},
+		{"quote at market", TradingViewAlert{Sizing: "quote", Size: 1000}, "buy", 0.02, false},
+		{"quote at limit", TradingViewAlert{Sizing: "quote", Size: 1000, Price: 40000}, "buy", 0.025, false},
+		{"percent of balance", TradingViewAlert{Sizing: "percent", Size: 10}, "buy", 0.02, false},
+		{"risk", TradingViewAlert{Sizing: "risk", Size: 1, StopPrice: 48000}, "buy", 0.1, false},
+		{"risk short", TradingViewAlert{Sizing: "risk", Size: 1, StopPrice: 52000}, "sell", 0.1, false},
+		{"risk stop beyond market", TradingViewAlert{Sizing: "risk", Size: 1, StopPrice: 51000}, "buy", 0, true},
+		{"below minimum", TradingViewAlert{Sizing: "quote", Size: 1}, "buy", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alert := tt.alert
+			alert.Pair = "XBTUSD"
+			got, err := queue.sizeOrder(context.Background(), &alert, tt.side)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("sizeOrder() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("sizeOrder() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -40,5 +40,15 @@ func LoadTestConfig(t *testing.T) *TestConfig {
 func NewTestClient(t *testing.T, cfg *TestConfig) *Client {
 	client := NewClient(cfg.DemoAPIKey, cfg.DemoAPISecret)
 	client.apiURL = cfg.DemoAPIURL
+
+	// Point both WebSocket connections at a local server when one is given
+	wsURL := cfg.WebSocketURL
+	if wsURL == "" {
+		wsURL = cfg.DemoWSURL
+	}
+	if wsURL != "" {
+		client.SetWebSocketURLs(wsURL, wsURL)
+	}
+
 	return client
 }
@@ -2,6 +2,17 @@ package kraken
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -13,7 +24,19 @@ func TestExecuteTrailingEntry(t *testing.T) {
 	server := newMockWSServer()
 	defer server.Close()
 
+	var placed int32
+	rest := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/0/public/AssetPairs" {
+			w.Write([]byte(mockAssetPair))
+			return
+		}
+		atomic.AddInt32(&placed, 1)
+		w.Write([]byte(`{"error":[],"result":{"descr":{"order":"buy"},"txid":["ABCD-1234"]}}`))
+	}))
+	defer rest.Close()
+
 	client := NewTestClient(t, &TestConfig{
+		DemoAPIURL:   rest.URL,
 		WebSocketURL: server.URL,
 		TestPair:     "XBT/USD",
 	})
@@ -29,7 +52,6 @@ func TestExecuteTrailingEntry(t *testing.T) {
 
 	// Setup price channel and subscribe
 	priceChan := make(chan float64)
-	defer close(priceChan)
 
 	if err := client.SubscribeToTicker(ctx, "XBT/USD", priceChan); err != nil {
 		t.Fatalf("SubscribeToTicker() error = %v", err)
@@ -63,8 +85,614 @@ func TestExecuteTrailingEntry(t *testing.T) {
 	// Wait for test completion or timeout
 	select {
 	case <-done:
-		// Test completed successfully
+		if got := atomic.LoadInt32(&placed); got != int32(params.NumOrders) {
+			t.Errorf("Expected %d orders, got %d", params.NumOrders, got)
+		}
 	case <-time.After(8 * time.Second):
 		t.Fatal("Test timed out")
 	}
 }
+
+// mockTradingAPI is a REST server that records placed and cancelled orders.
+// Orders listed in filled are reported as fully executed by QueryOrders, and
+// the public ticker trades at ticker. XBTUSD is the only asset pair, and the
+// account holds balances and margin positions.
+type mockTradingAPI struct {
+	*httptest.Server
+	mu        sync.Mutex
+	placed    []url.Values
+	cancelled []string
+	filled    map[string]bool
+	reject    map[int]bool // AddOrder calls (1-based) to fail
+	lost      map[int]bool // AddOrder calls (1-based) that place the order but answer with an error
+	stuck     bool         // CancelOrder fails and orders stay open
+	trading   bool         // Limit orders fill as the ticker reaches them
+	calls     int
+	ticker    float64
+	balances  map[string]string
+	positions map[string]PositionInfo
+}
+
+// mockAssetPair is the AssetPairs response of the mock servers
+const mockAssetPair = `{"error":[],"result":{"XXBTZUSD":{"altname":"XBTUSD","wsname":"XBT/USD","base":"XXBT","quote":"ZUSD","pair_decimals":2,"lot_decimals":8,"ordermin":"0.0001"}}}`
+
+func newMockTradingAPI() *mockTradingAPI {
+	m := &mockTradingAPI{
+		filled:    make(map[string]bool),
+		reject:    make(map[int]bool),
+		lost:      make(map[int]bool),
+		balances:  make(map[string]string),
+		positions: make(map[string]PositionInfo),
+	}
+	m.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		switch r.URL.Path {
+		case "/0/public/Ticker":
+			p := strconv.FormatFloat(m.ticker, 'f', 2, 64)
+			fmt.Fprintf(w, `{"error":[],"result":{"XXBTZUSD":{"a":["%s"],"b":["%s"],"c":["%s"],"v":["0","0"]}}}`, p, p, p)
+		case "/0/private/AddOrder":
+			m.calls++
+			if m.reject[m.calls] {
+				w.Write([]byte(`{"error":["EOrder:Insufficient funds"]}`))
+				return
+			}
+			m.placed = append(m.placed, r.Form)
+			if m.trading {
+				m.fillAt(len(m.placed) - 1)
+			}
+			if m.lost[m.calls] {
+				w.Write([]byte(`{"error":["EService:Unavailable"]}`))
+				return
+			}
+			fmt.Fprintf(w, `{"error":[],"result":{"descr":{"order":"%s"},"txid":["TX-%d"]}}`,
+				r.Form.Get("type"), len(m.placed))
+		case "/0/private/CancelOrder":
+			if m.stuck {
+				w.Write([]byte(`{"error":["EService:Unavailable"]}`))
+				return
+			}
+			m.cancelled = append(m.cancelled, r.Form.Get("txid"))
+			w.Write([]byte(`{"error":[],"result":{"count":1}}`))
+		case "/0/private/QueryOrders":
+			result := make(map[string]OrderInfo)
+			for _, txid := range strings.Split(r.Form.Get("txid"), ",") {
+				var n int
+				fmt.Sscanf(txid, "TX-%d", &n)
+				order := m.placed[n-1]
+				vol := order.Get("volume")
+				info := OrderInfo{Status: "open", Volume: vol, VolumeExec: "0"}
+				if m.isCancelled(txid, order.Get("userref")) {
+					info.Status = "canceled"
+				}
+				if m.filled[txid] {
+					info.Status = "closed"
+					info.VolumeExec = vol
+					info.AvgPrice = order.Get("price")
+				}
+				result[txid] = info
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"error": []string{}, "result": result})
+		case "/0/private/OpenOrders":
+			open := make(map[string]OrderInfo)
+			for _, txid := range m.openOrders() {
+				order := m.placed[txidIndex(txid)]
+				if id := r.Form.Get("cl_ord_id"); id != "" && order.Get("cl_ord_id") != id {
+					continue
+				}
+				var info OrderInfo
+				info.Status = "open"
+				info.Description.Pair = order.Get("pair")
+				info.Description.Type = order.Get("type")
+				info.Volume = order.Get("volume")
+				info.RefID = order.Get("refid")
+				info.ClOrdID = order.Get("cl_ord_id")
+				open[txid] = info
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"error": []string{}, "result": map[string]interface{}{"open": open}})
+		case "/0/private/ClosedOrders":
+			closed := make(map[string]OrderInfo)
+			for i, order := range m.placed {
+				txid := fmt.Sprintf("TX-%d", i+1)
+				if id := r.Form.Get("cl_ord_id"); id != "" && order.Get("cl_ord_id") != id {
+					continue
+				}
+				if m.filled[txid] {
+					closed[txid] = OrderInfo{Status: "closed", ClOrdID: order.Get("cl_ord_id")}
+				} else if m.isCancelled(txid, order.Get("userref")) {
+					closed[txid] = OrderInfo{Status: "canceled", ClOrdID: order.Get("cl_ord_id")}
+				}
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"error": []string{}, "result": map[string]interface{}{"closed": closed}})
+		case "/0/private/CancelAll":
+			open := m.openOrders()
+			m.cancelled = append(m.cancelled, open...)
+			fmt.Fprintf(w, `{"error":[],"result":{"count":%d}}`, len(open))
+		case "/0/private/BalanceEx":
+			result := make(map[string]map[string]string)
+			for asset, b := range m.balances {
+				result[asset] = map[string]string{"balance": b, "hold_trade": "0"}
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"error": []string{}, "result": result})
+		case "/0/private/TradeBalance":
+			fmt.Fprintf(w, `{"error":[],"result":{"e":"%s"}}`, m.balances["equity"])
+		case "/0/private/Balance":
+			json.NewEncoder(w).Encode(map[string]interface{}{"error": []string{}, "result": m.balances})
+		case "/0/private/OpenPositions":
+			json.NewEncoder(w).Encode(map[string]interface{}{"error": []string{}, "result": m.positions})
+		case "/0/public/AssetPairs":
+			w.Write([]byte(mockAssetPair))
+		default:
+			w.Write([]byte(`{"error":["EGeneral:Unknown method"]}`))
+		}
+	}))
+	return m
+}
+
+// txidIndex returns the index in placed of a TX-n txid
+func txidIndex(txid string) int {
+	var n int
+	fmt.Sscanf(txid, "TX-%d", &n)
+	return n - 1
+}
+
+// openOrders returns the placed orders neither filled nor cancelled
+func (m *mockTradingAPI) openOrders() []string {
+	var open []string
+	for i, order := range m.placed {
+		txid := fmt.Sprintf("TX-%d", i+1)
+		if !m.filled[txid] && !m.isCancelled(txid, order.Get("userref")) {
+			open = append(open, txid)
+		}
+	}
+	return open
+}
+
+// isCancelled reports whether an order was cancelled by txid or userref
+func (m *mockTradingAPI) isCancelled(txid, userref string) bool {
+	for _, c := range m.cancelled {
+		if c == txid || (userref != "" && c == userref) {
+			return true
+		}
+	}
+	return false
+}
+
+// trade moves the ticker to p and fills the resting limit orders it reaches.
+// Orders placed afterwards fill against the ticker too.
+func (m *mockTradingAPI) trade(p float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.ticker = p
+	m.trading = true
+	for i := range m.placed {
+		m.fillAt(i)
+	}
+}
+
+// fillAt fills the i-th placed order if it is a resting limit order the
+// ticker has reached
+func (m *mockTradingAPI) fillAt(i int) {
+	order := m.placed[i]
+	txid := fmt.Sprintf("TX-%d", i+1)
+	price, err := strconv.ParseFloat(order.Get("price"), 64)
+	if err != nil || order.Get("ordertype") != "limit" || m.isCancelled(txid, order.Get("userref")) {
+		return
+	}
+	if (order.Get("type") == "buy" && m.ticker <= price) || (order.Get("type") == "sell" && m.ticker >= price) {
+		m.filled[txid] = true
+	}
+}
+
+func (m *mockTradingAPI) prices() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	prices := make([]string, len(m.placed))
+	for i, p := range m.placed {
+		prices[i] = p.Get("price")
+	}
+	return prices
+}
+
+func TestTrailEntry(t *testing.T) {
+	api := newMockTradingAPI()
+	defer api.Close()
+
+	client := NewTestClient(t, &TestConfig{DemoAPIURL: api.URL})
+
+	config := TrailingEntryConfig{
+		Pair:          "XBT/USD",
+		Side:          "buy",
+		UpperBand:     1100.0,
+		LowerBand:     900.0,
+		TotalVolume:   3.0,
+		NumOrders:     3,
+		Distribution:  EvenDistribution,
+		TrailDistance: 10,
+	}
+
+	prices := make(chan float64)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- client.trailEntry(context.Background(), config, prices)
+	}()
+
+	// The market trades at each price before the entry sees it
+	feed := func(ps ...float64) {
+		for _, p := range ps {
+			api.trade(p)
+			prices <- p
+		}
+	}
+
+	// Above the band, then falling into it without reversing
+	feed(1200, 1050, 1000, 995, 1004)
+	if got := api.prices(); len(got) != 0 {
+		t.Fatalf("Expected no orders before reversal, got %v", got)
+	}
+
+	// Reversal of 10 from the 995 low places the ladder 1005-995, and the
+	// top rung fills at once
+	feed(1005)
+	// A dip fills the next rung; a rise of less than the trail distance
+	// above the ladder leaves it resting
+	feed(1000, 1012)
+	// Running 10 above the ladder re-centres the last rung below the market
+	feed(1015)
+	close(prices)
+
+	if err := <-errc; err != nil {
+		t.Fatalf("trailEntry() error = %v", err)
+	}
+
+	want := []string{"1005.00", "1000.00", "995.00", "1015.00", "1010.00", "1005.00"}
+	got := api.prices()
+	if len(got) != len(want) {
+		t.Fatalf("order prices = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("order[%d] price = %v, want %v", i, got[i], want[i])
+		}
+	}
+
+	if !api.isCancelled("TX-3", "") {
+		t.Errorf("Expected the unfilled rung to be cancelled, got %v", api.cancelled)
+	}
+
+	// TX-1 and TX-2 filled, so the re-centred ladder only carries 1.0
+	total := 0.0
+	for _, p := range api.placed[3:] {
+		v, _ := strconv.ParseFloat(p.Get("volume"), 64)
+		total += v
+	}
+	if math.Abs(total-1.0) > 1e-6 {
+		t.Errorf("re-centred volume = %v, want 1.0", total)
+	}
+}
+
+func TestTrailEntry_ReturnsWhenFilled(t *testing.T) {
+	api := newMockTradingAPI()
+	defer api.Close()
+
+	client := NewTestClient(t, &TestConfig{DemoAPIURL: api.URL})
+
+	config := TrailingEntryConfig{
+		Pair:          "XBT/USD",
+		Side:          "sell",
+		UpperBand:     1100.0,
+		LowerBand:     900.0,
+		TotalVolume:   2.0,
+		NumOrders:     2,
+		Distribution:  EvenDistribution,
+		TrailDistance: 10,
+	}
+
+	prices := make(chan float64)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- client.trailEntry(context.Background(), config, prices)
+	}()
+
+	feed := func(ps ...float64) {
+		for _, p := range ps {
+			api.trade(p)
+			prices <- p
+		}
+	}
+
+	// Reversal from the 1010 high places the ladder 1000-1010, and price
+	// runs through it while the feed goes on
+	feed(1000, 1010, 1000, 1012)
+
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Fatalf("trailEntry() error = %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("trailEntry() kept running after the ladder filled")
+	}
+
+	if got := api.prices(); len(got) != 2 {
+		t.Errorf("Expected only the first ladder, got %v", got)
+	}
+}
+
+func TestTrailEntry_StopsWhenCancelFails(t *testing.T) {
+	api := newMockTradingAPI()
+	defer api.Close()
+
+	client := NewTestClient(t, &TestConfig{DemoAPIURL: api.URL})
+
+	config := TrailingEntryConfig{
+		Pair:          "XBT/USD",
+		Side:          "buy",
+		UpperBand:     1100.0,
+		LowerBand:     900.0,
+		TotalVolume:   3.0,
+		NumOrders:     3,
+		Distribution:  EvenDistribution,
+		TrailDistance: 10,
+	}
+
+	prices := make(chan float64)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- client.trailEntry(context.Background(), config, prices)
+	}()
+
+	feed := func(ps ...float64) {
+		for _, p := range ps {
+			api.trade(p)
+			prices <- p
+		}
+	}
+
+	// The ladder 1005-995 rests, then price runs away while cancels fail
+	feed(1000, 995, 1005)
+	api.mu.Lock()
+	api.stuck = true
+	api.mu.Unlock()
+	feed(1015)
+
+	select {
+	case err := <-errc:
+		if err == nil {
+			t.Fatal("trailEntry() should fail when rungs cannot be cancelled")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("trailEntry() did not stop")
+	}
+
+	if got := api.prices(); len(got) != 3 {
+		t.Errorf("re-laddered over resting rungs: %v", got)
+	}
+}
+
+func TestTrailDistance(t *testing.T) {
+	abs := TrailingEntryConfig{TrailDistance: 50}
+	if d := trailDistance(abs, 1000); d != 50 {
+		t.Errorf("absolute trail = %v, want 50", d)
+	}
+
+	pct := TrailingEntryConfig{TrailDistance: 2, TrailPercent: true}
+	if d := trailDistance(pct, 1000); d != 20 {
+		t.Errorf("percent trail = %v, want 20", d)
+	}
+}
+
+func TestCalculateOrderPrices(t *testing.T) {
+	tests := []struct {
+		name   string
+		config TrailingEntryConfig
+		want   []float64
+	}{
+		{
+			name: "linear buy",
+			config: TrailingEntryConfig{
+				Side: "buy", UpperBand: 100, LowerBand: 80, NumOrders: 3,
+			},
+			want: []float64{100, 90, 80},
+		},
+		{
+			name: "linear sell",
+			config: TrailingEntryConfig{
+				Side: "sell", UpperBand: 100, LowerBand: 80, NumOrders: 3, Spacing: LinearSpacing,
+			},
+			want: []float64{80, 90, 100},
+		},
+		{
+			name: "geometric buy",
+			config: TrailingEntryConfig{
+				Side: "buy", UpperBand: 400, LowerBand: 100, NumOrders: 3, Spacing: GeometricSpacing,
+			},
+			want: []float64{400, 200, 100},
+		},
+		{
+			name: "geometric sell",
+			config: TrailingEntryConfig{
+				Side: "sell", UpperBand: 800, LowerBand: 100, NumOrders: 4, Spacing: GeometricSpacing,
+			},
+			want: []float64{100, 200, 400, 800},
+		},
+		{
+			name: "explicit levels sorted and filtered to band",
+			config: TrailingEntryConfig{
+				Side: "buy", UpperBand: 100, LowerBand: 80, Spacing: ExplicitSpacing,
+				Prices: []float64{85, 99, 120, 80, 70},
+			},
+			want: []float64{99, 85, 80},
+		},
+		{
+			name: "single order",
+			config: TrailingEntryConfig{
+				Side: "buy", UpperBand: 100, LowerBand: 80, NumOrders: 1,
+			},
+			want: []float64{100},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := calculateOrderPrices(tt.config)
+			if len(got) != len(tt.want) {
+				t.Fatalf("calculateOrderPrices() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if math.Abs(got[i]-tt.want[i]) > 1e-9 {
+					t.Errorf("price[%d] = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestPlaceLadder_BestEffort(t *testing.T) {
+	api := newMockTradingAPI()
+	defer api.Close()
+	api.reject[2] = true
+
+	client := NewTestClient(t, &TestConfig{DemoAPIURL: api.URL})
+	config := TrailingEntryConfig{
+		Pair:        "XBT/USD",
+		Side:        "buy",
+		UpperBand:   100,
+		LowerBand:   70,
+		TotalVolume: 4,
+		NumOrders:   4,
+	}
+
+	result, err := client.PlaceLadder(context.Background(), config)
+
+	var ladderErr *LadderError
+	if !errors.As(err, &ladderErr) || ladderErr.RolledBack {
+		t.Fatalf("PlaceLadder() error = %v, want a LadderError without rollback", err)
+	}
+
+	placed := result.Placed()
+	if len(placed) != 3 || placed[0].TxID != "TX-1" || placed[1].TxID != "TX-2" || placed[2].Price != 70 {
+		t.Errorf("placed rungs = %+v", placed)
+	}
+
+	failed := result.Failed()
+	if len(failed) != 1 || failed[0].Index != 1 || failed[0].Price != 90 {
+		t.Fatalf("failed rungs = %+v", failed)
+	}
+	if !strings.Contains(failed[0].Err.Error(), "Insufficient funds") {
+		t.Errorf("failure reason = %v", failed[0].Err)
+	}
+	if len(api.cancelled) != 0 {
+		t.Errorf("best-effort mode should not cancel, got %v", api.cancelled)
+	}
+}
+
+func TestPlaceLadder_AllOrNothing(t *testing.T) {
+	api := newMockTradingAPI()
+	defer api.Close()
+	api.reject[3] = true
+
+	client := NewTestClient(t, &TestConfig{DemoAPIURL: api.URL})
+	config := TrailingEntryConfig{
+		Pair:         "XBT/USD",
+		Side:         "buy",
+		UpperBand:    100,
+		LowerBand:    70,
+		TotalVolume:  4,
+		NumOrders:    4,
+		AllOrNothing: true,
+	}
+
+	result, err := client.PlaceLadder(context.Background(), config)
+
+	var ladderErr *LadderError
+	if !errors.As(err, &ladderErr) || !ladderErr.RolledBack {
+		t.Fatalf("PlaceLadder() error = %v, want a rolled back LadderError", err)
+	}
+
+	// The fourth rung is never attempted
+	if api.calls != 3 {
+		t.Errorf("AddOrder calls = %d, want 3", api.calls)
+	}
+	if len(api.cancelled) != 2 || api.cancelled[0] != "TX-1" || api.cancelled[1] != "TX-2" {
+		t.Errorf("cancelled = %v, want [TX-1 TX-2]", api.cancelled)
+	}
+	if len(result.Placed()) != 0 {
+		t.Errorf("no rung should remain placed, got %+v", result.Placed())
+	}
+}
+
+func TestPlaceLadder_RoundsToPairDecimals(t *testing.T) {
+	api := newMockTradingAPI()
+	defer api.Close()
+
+	client := NewTestClient(t, &TestConfig{DemoAPIURL: api.URL})
+	result, err := client.PlaceLadder(context.Background(), TrailingEntryConfig{
+		Pair:        "XBT/USD",
+		Side:        "buy",
+		UpperBand:   100,
+		LowerBand:   90,
+		TotalVolume: 3,
+		NumOrders:   4,
+		Spacing:     GeometricSpacing,
+		StopLoss:    80.555,
+	})
+	if err != nil {
+		t.Fatalf("PlaceLadder() error = %v", err)
+	}
+
+	want := []string{"100.00", "96.55", "93.22", "90.00"}
+	if len(api.placed) != len(want) {
+		t.Fatalf("placed %d orders, want %d", len(api.placed), len(want))
+	}
+	for i, order := range api.placed {
+		if order.Get("price") != want[i] {
+			t.Errorf("rung %d price = %s, want %s", i, order.Get("price"), want[i])
+		}
+		if order.Get("close[price]") != "80.56" {
+			t.Errorf("rung %d stop-loss = %s, want 80.56", i, order.Get("close[price]"))
+		}
+	}
+	if result.Rungs[1].Price != 96.55 {
+		t.Errorf("rung price = %v, want 96.55", result.Rungs[1].Price)
+	}
+}
+
+func TestPlaceLadder_RejectsInvalidLayout(t *testing.T) {
+	api := newMockTradingAPI()
+	defer api.Close()
+
+	client := NewTestClient(t, &TestConfig{DemoAPIURL: api.URL})
+	base := TrailingEntryConfig{Pair: "XBT/USD", Side: "buy", UpperBand: 100, LowerBand: 90, TotalVolume: 1, NumOrders: 3}
+
+	tests := []struct {
+		name   string
+		modify func(*TrailingEntryConfig)
+	}{
+		{"no orders", func(c *TrailingEntryConfig) { c.NumOrders = 0 }},
+		{"negative orders", func(c *TrailingEntryConfig) { c.NumOrders = -2 }},
+		{"geometric from zero", func(c *TrailingEntryConfig) { c.Spacing = GeometricSpacing; c.LowerBand = 0 }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := base
+			tt.modify(&config)
+			if _, err := client.PlaceLadder(context.Background(), config); err == nil {
+				t.Error("PlaceLadder() should fail")
+			}
+			if _, err := planLadder(config, nil); err == nil {
+				t.Error("planLadder() should fail")
+			}
+		})
+	}
+
+	if api.calls != 0 {
+		t.Errorf("AddOrder calls = %d, want 0", api.calls)
+	}
+}
@@ -0,0 +1,450 @@
+package kraken
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type StopTrailMode string
+
+const (
+	PercentTrail StopTrailMode = "percent" // Distance is a percentage of the extreme
+	ATRTrail     StopTrailMode = "atr"     // Distance is a multiple of the average true range
+)
+
+type StopExitMode string
+
+const (
+	AmendStopExit StopExitMode = "amend"  // Keep a resting stop-loss order and amend its trigger
+	MarketExit    StopExitMode = "market" // Watch client-side and exit with a market order
+	LimitExit     StopExitMode = "limit"  // Watch client-side and exit with a limit order
+)
+
+type TrailingStopConfig struct {
+	Pair            string
+	Side            string // Side of the open position: "buy" for long, "sell" for short
+	Volume          float64
+	Mode            StopTrailMode
+	Distance        float64
+	ATRPeriod       int     // Candles averaged for ATRTrail
+	ATRInterval     int     // Candle length in minutes for ATRTrail
+	StepSize        float64 // Smaller ratchets of the stop are ignored
+	InitialStop     float64 // Optional stop level before the first ratchet
+	ActivationPrice float64 // Optional price to reach before trailing starts
+	Leverage        string  // Leverage of a margin position; exits are then reduce-only
+	Exit            StopExitMode
+	LimitOffset     float64 // How far beyond the stop a LimitExit may fill
+	StopOrderID     string  // Resting stop-loss order to amend with AmendStopExit
+	StatePath       string  // File the stop is persisted to across restarts
+}
+
+// TrailingStopState is the persisted progress of a trailing stop
+type TrailingStopState struct {
+	Pair        string    `json:"pair"`
+	Side        string    `json:"side"`
+	Extreme     float64   `json:"extreme"`
+	Stop        float64   `json:"stop"`
+	ATR         float64   `json:"atr,omitempty"`
+	Activated   bool      `json:"activated"`
+	StopOrderID string    `json:"stop_order_id,omitempty"`
+	Triggered   bool      `json:"triggered"`
+	ExitClOrdID string    `json:"exit_cl_ord_id,omitempty"` // Set once an exit has been sent, so retries find it
+	ExitTxID    string    `json:"exit_txid,omitempty"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// TrailingStop ratchets a stop behind the ticker for an open position and
+// exits it once the stop is breached
+type TrailingStop struct {
+	client *Client
+	config TrailingStopConfig
+	state  TrailingStopState
+	mu     sync.Mutex
+}
+
+func (c *TrailingStopConfig) Validate() error {
+	if c.Pair == "" {
+		return fmt.Errorf("pair is required")
+	}
+	if c.Side != "buy" && c.Side != "sell" {
+		return fmt.Errorf("invalid side: must be buy or sell")
+	}
+	if c.Volume <= 0 {
+		return fmt.Errorf("volume must be positive")
+	}
+	if c.Distance <= 0 {
+		return fmt.Errorf("trail distance must be positive")
+	}
+	if c.Leverage != "" && !IsValidLeverage(c.Leverage) {
+		return fmt.Errorf("invalid leverage: must be none, 2, 3, 4, or 5")
+	}
+	if c.Side == "sell" && !c.margin() {
+		return fmt.Errorf("a short position is held on margin: leverage is required")
+	}
+
+	switch c.Mode {
+	case PercentTrail, ATRTrail:
+	default:
+		return fmt.Errorf("invalid trail mode: %s", c.Mode)
+	}
+
+	switch c.Exit {
+	case AmendStopExit, MarketExit, LimitExit:
+	default:
+		return fmt.Errorf("invalid exit mode: %s", c.Exit)
+	}
+
+	return nil
+}
+
+// margin reports whether the position is a margin position
+func (c *TrailingStopConfig) margin() bool {
+	return c.Leverage != "" && Leverage(c.Leverage) != NoLeverage
+}
+
+// NewTrailingStop creates a trailing stop, resuming from StatePath if a
+// stop for the same pair and side was saved there before
+func NewTrailingStop(client *Client, config TrailingStopConfig) (*TrailingStop, error) {
+	if config.ATRPeriod <= 0 {
+		config.ATRPeriod = 14
+	}
+	if config.ATRInterval <= 0 {
+		config.ATRInterval = 60
+	}
+	if config.Exit == "" {
+		config.Exit = MarketExit
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid trailing stop: %w", err)
+	}
+
+	s := &TrailingStop{
+		client: client,
+		config: config,
+		state: TrailingStopState{
+			Pair:        config.Pair,
+			Side:        config.Side,
+			Stop:        config.InitialStop,
+			Activated:   config.ActivationPrice == 0,
+			StopOrderID: config.StopOrderID,
+		},
+	}
+
+	if config.StatePath != "" {
+		var saved TrailingStopState
+		found, err := loadState(config.StatePath, &saved)
+		if err != nil {
+			return nil, err
+		}
+		if found && saved.Pair == config.Pair && saved.Side == config.Side {
+			s.state = saved
+		}
+	}
+
+	return s, nil
+}
+
+// State returns a snapshot of the stop's progress
+func (s *TrailingStop) State() TrailingStopState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+// Run follows the ticker until the stop is triggered, ctx is done or an
+// order fails permanently. It requires a connected public WebSocket, and a
+// private one for AmendStopExit.
+func (s *TrailingStop) Run(ctx context.Context) error {
+	if s.State().Triggered {
+		return nil
+	}
+
+	var refresh <-chan time.Time
+	if s.config.Mode == ATRTrail {
+		if err := s.refreshATR(ctx); err != nil {
+			return err
+		}
+		ticker := time.NewTicker(time.Duration(s.config.ATRInterval) * time.Minute)
+		defer ticker.Stop()
+		refresh = ticker.C
+	}
+
+	tickerCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	prices := make(chan float64, 1)
+	if err := s.client.SubscribeToTicker(tickerCtx, s.config.Pair, prices); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-refresh:
+			if err := s.refreshATR(ctx); err != nil {
+				fmt.Printf("%v\n", err)
+			}
+		case price := <-prices:
+			done, err := s.update(ctx, price)
+			if err != nil {
+				return err
+			}
+			if done {
+				return nil
+			}
+		}
+	}
+}
+
+// refreshATR recomputes the average true range from recent candles
+func (s *TrailingStop) refreshATR(ctx context.Context) error {
+	candles, err := s.client.GetOHLC(ctx, s.config.Pair, s.config.ATRInterval)
+	if err != nil {
+		return err
+	}
+
+	atr := averageTrueRange(candles, s.config.ATRPeriod)
+	if atr == 0 {
+		return fmt.Errorf("not enough candles to compute ATR for %s", s.config.Pair)
+	}
+
+	s.mu.Lock()
+	s.state.ATR = atr
+	s.mu.Unlock()
+	return nil
+}
+
+// averageTrueRange is the mean true range of the last period candles
+func averageTrueRange(candles []Candle, period int) float64 {
+	if len(candles) < period+1 || period <= 0 {
+		return 0
+	}
+
+	sum := 0.0
+	for i := len(candles) - period; i < len(candles); i++ {
+		prevClose := candles[i-1].Close
+		tr := math.Max(candles[i].High-candles[i].Low,
+			math.Max(math.Abs(candles[i].High-prevClose), math.Abs(candles[i].Low-prevClose)))
+		sum += tr
+	}
+
+	return sum / float64(period)
+}
+
+// distance is how far the stop trails the extreme
+func (s *TrailingStop) distance() float64 {
+	if s.config.Mode == ATRTrail {
+		return s.state.ATR * s.config.Distance
+	}
+	return s.state.Extreme * s.config.Distance / 100
+}
+
+// update feeds one price through the stop and reports whether it triggered.
+// Failed amends and exits are logged and retried on the next price; only
+// permanent failures are returned.
+func (s *TrailingStop) update(ctx context.Context, price float64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.state.Triggered {
+		return true, nil
+	}
+
+	long := s.config.Side == "buy"
+	changed := false
+
+	if !s.state.Activated {
+		if (long && price >= s.config.ActivationPrice) || (!long && price <= s.config.ActivationPrice) {
+			s.state.Activated = true
+			changed = true
+		}
+	}
+
+	// Check the breach against the stop as it stood before this price. An
+	// exit already sent is followed up even if price has come back.
+	breached := s.state.Stop > 0 && ((long && price <= s.state.Stop) || (!long && price >= s.state.Stop))
+	if breached || s.state.ExitClOrdID != "" {
+		if err := s.trigger(ctx, price); err != nil {
+			return false, s.retryLater(err)
+		}
+		return true, nil
+	}
+
+	if s.state.Activated {
+		if s.state.Extreme == 0 || (long && price > s.state.Extreme) || (!long && price < s.state.Extreme) {
+			s.state.Extreme = price
+			changed = true
+		}
+
+		candidate := s.state.Extreme - s.distance()
+		delta := candidate - s.state.Stop
+		if !long {
+			candidate = s.state.Extreme + s.distance()
+			delta = s.state.Stop - candidate
+		}
+
+		if s.state.Stop == 0 || (delta > 0 && delta >= s.config.StepSize) {
+			if err := s.moveStop(ctx, candidate); err != nil {
+				if err := s.retryLater(err); err != nil {
+					return false, err
+				}
+			} else {
+				changed = true
+			}
+		}
+	}
+
+	if changed {
+		return false, s.save()
+	}
+	return false, nil
+}
+
+// permanentOrderErrors are exchange errors that sending the same request
+// again cannot fix
+var permanentOrderErrors = []string{
+	"EOrder:Unknown order",
+	"EOrder:Invalid price",
+	"EGeneral:Invalid arguments",
+	"EQuery:Unknown asset pair",
+}
+
+// retryLater logs a transient failure, which the next price retries while
+// the last good stop stays in place, and passes on a permanent one
+func (s *TrailingStop) retryLater(err error) error {
+	for _, e := range permanentOrderErrors {
+		if strings.Contains(err.Error(), e) {
+			return err
+		}
+	}
+
+	fmt.Printf("Trailing stop for %s: %v; retrying on the next price\n", s.config.Pair, err)
+	return nil
+}
+
+// moveStop ratchets the stop level, amending the resting stop-loss order
+// when the exchange holds the stop
+func (s *TrailingStop) moveStop(ctx context.Context, stop float64) error {
+	if s.config.Exit == AmendStopExit {
+		info, err := s.client.assetPair(ctx, s.config.Pair)
+		if err != nil {
+			return fmt.Errorf("failed to move stop-loss: %w", err)
+		}
+		stop = info.RoundPrice(stop)
+
+		if s.state.StopOrderID == "" {
+			exit := "sell"
+			if s.config.Side == "sell" {
+				exit = "buy"
+			}
+
+			result, err := s.client.AddOrderWS(ctx, WSOrderRequest{
+				OrderType:  string(StopLossOrder),
+				Side:       exit,
+				OrderQty:   s.config.Volume,
+				Symbol:     s.config.Pair,
+				Margin:     s.config.margin(),
+				ReduceOnly: s.config.margin(),
+				Triggers:   &WSTrigger{Price: stop},
+			})
+			if err != nil {
+				return fmt.Errorf("failed to place stop-loss: %w", err)
+			}
+			s.state.StopOrderID = result.OrderID
+		} else {
+			_, err := s.client.AmendOrderWS(ctx, WSAmendRequest{
+				OrderID:      s.state.StopOrderID,
+				TriggerPrice: stop,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to amend stop-loss: %w", err)
+			}
+		}
+	}
+
+	fmt.Printf("Trailing stop for %s moved to %.2f\n", s.config.Pair, stop)
+	s.state.Stop = stop
+	return nil
+}
+
+// trigger exits the position once price has crossed the stop. The exit is
+// sent under a cl_ord_id saved beforehand, so that a retry after a lost
+// response finds the order instead of exiting twice.
+func (s *TrailingStop) trigger(ctx context.Context, price float64) error {
+	fmt.Printf("Trailing stop for %s hit at %.2f (stop %.2f)\n", s.config.Pair, price, s.state.Stop)
+
+	// A resting stop-loss order is triggered by the exchange itself
+	if s.config.Exit == AmendStopExit {
+		s.state.Triggered = true
+		return s.save()
+	}
+
+	if s.state.ExitClOrdID != "" {
+		txid, _, err := s.client.FindOrder(ctx, s.state.ExitClOrdID)
+		if err != nil {
+			return fmt.Errorf("failed to exit position: %w", err)
+		}
+		if txid != "" {
+			s.state.Triggered = true
+			s.state.ExitTxID = txid
+			return s.save()
+		}
+	} else {
+		s.state.ExitClOrdID = alertClOrdID(fmt.Sprintf("trailing-stop/%s/%s/%d", s.config.Pair, s.config.Side, time.Now().UnixNano()))
+		if err := s.save(); err != nil {
+			return err
+		}
+	}
+
+	req := OrderRequest{
+		Pair:    s.config.Pair,
+		Type:    MarketOrder,
+		Side:    "sell",
+		Volume:  strconv.FormatFloat(s.config.Volume, 'f', 8, 64),
+		ClOrdID: s.state.ExitClOrdID,
+	}
+	if s.config.margin() {
+		req.Leverage = s.config.Leverage
+		req.ReduceOnly = true
+	}
+	limit := s.state.Stop - s.config.LimitOffset
+	if s.config.Side == "sell" {
+		req.Side = "buy"
+		limit = s.state.Stop + s.config.LimitOffset
+	}
+	if s.config.Exit == LimitExit {
+		info, err := s.client.assetPair(ctx, s.config.Pair)
+		if err != nil {
+			return fmt.Errorf("failed to exit position: %w", err)
+		}
+		req.Type = LimitOrder
+		req.Price = info.FormatPrice(limit)
+	}
+
+	resp, err := s.client.AddOrder(ctx, req)
+	if err != nil {
+		// Leave the stop armed so that the next price or a restart retries
+		return fmt.Errorf("failed to exit position: %w", err)
+	}
+	s.state.Triggered = true
+	if len(resp.TransactionIds) > 0 {
+		s.state.ExitTxID = resp.TransactionIds[0]
+	}
+
+	return s.save()
+}
+
+func (s *TrailingStop) save() error {
+	s.state.UpdatedAt = time.Now()
+	if s.config.StatePath == "" {
+		return nil
+	}
+	return saveState(s.config.StatePath, s.state)
+}
@@ -0,0 +1,314 @@
+package kraken
+
+import (
+	"context"
+	"errors"
+	"math"
+	"path/filepath"
+	"testing"
+)
+
+func TestTrailingStop_RatchetAndExit(t *testing.T) {
+	api := newMockTradingAPI()
+	defer api.Close()
+
+	client := NewTestClient(t, &TestConfig{DemoAPIURL: api.URL})
+	statePath := filepath.Join(t.TempDir(), "stop.json")
+
+	stop, err := NewTrailingStop(client, TrailingStopConfig{
+		Pair:      "XBT/USD",
+		Side:      "buy",
+		Volume:    0.5,
+		Mode:      PercentTrail,
+		Distance:  10,
+		StepSize:  5,
+		Exit:      LimitExit,
+		StatePath: statePath,
+	})
+	if err != nil {
+		t.Fatalf("NewTrailingStop() error = %v", err)
+	}
+
+	ctx := context.Background()
+	steps := []struct {
+		price    float64
+		wantStop float64
+	}{
+		{price: 1000, wantStop: 900},
+		{price: 1004, wantStop: 900}, // Ratchet of 3.6 is below the step size
+		{price: 1010, wantStop: 909}, // Ratchet of 9 passes
+		{price: 950, wantStop: 909},  // Stops never move back
+		{price: 1100, wantStop: 990},
+	}
+
+	for _, step := range steps {
+		done, err := stop.update(ctx, step.price)
+		if err != nil || done {
+			t.Fatalf("update(%v) = %v, %v", step.price, done, err)
+		}
+		if got := stop.State().Stop; math.Abs(got-step.wantStop) > 1e-9 {
+			t.Errorf("after %v stop = %v, want %v", step.price, got, step.wantStop)
+		}
+	}
+
+	// The stop survives a restart
+	resumed, err := NewTrailingStop(client, TrailingStopConfig{
+		Pair:        "XBT/USD",
+		Side:        "buy",
+		Volume:      0.5,
+		Mode:        PercentTrail,
+		Distance:    10,
+		Exit:        LimitExit,
+		LimitOffset: 10,
+		StatePath:   statePath,
+	})
+	if err != nil {
+		t.Fatalf("NewTrailingStop() error = %v", err)
+	}
+	if got := resumed.State(); got.Stop != 990 || got.Extreme != 1100 {
+		t.Fatalf("resumed state = %+v, want stop 990 and extreme 1100", got)
+	}
+
+	done, err := resumed.update(ctx, 985)
+	if err != nil || !done {
+		t.Fatalf("update(985) = %v, %v, want triggered", done, err)
+	}
+
+	if len(api.placed) != 1 {
+		t.Fatalf("Expected one exit order, got %d", len(api.placed))
+	}
+	exit := api.placed[0]
+	if exit.Get("type") != "sell" || exit.Get("ordertype") != "limit" || exit.Get("price") != "980.00" {
+		t.Errorf("unexpected exit order %v", exit)
+	}
+
+	state := resumed.State()
+	if !state.Triggered || state.ExitTxID != "TX-1" {
+		t.Errorf("state after exit = %+v", state)
+	}
+}
+
+func TestTrailingStop_ShortWithActivation(t *testing.T) {
+	api := newMockTradingAPI()
+	defer api.Close()
+
+	client := NewTestClient(t, &TestConfig{DemoAPIURL: api.URL})
+	stop, err := NewTrailingStop(client, TrailingStopConfig{
+		Pair:            "XBT/USD",
+		Side:            "sell",
+		Volume:          1,
+		Leverage:        "2",
+		Mode:            ATRTrail,
+		Distance:        2,
+		ActivationPrice: 950,
+	})
+	if err != nil {
+		t.Fatalf("NewTrailingStop() error = %v", err)
+	}
+	stop.state.ATR = 10
+
+	ctx := context.Background()
+	for _, p := range []float64{1000, 960} {
+		stop.update(ctx, p)
+	}
+	if got := stop.State().Stop; got != 0 {
+		t.Fatalf("stop = %v before activation, want 0", got)
+	}
+
+	stop.update(ctx, 940)
+	stop.update(ctx, 930)
+	if got := stop.State().Stop; got != 950 {
+		t.Fatalf("stop = %v, want 950", got)
+	}
+
+	done, _ := stop.update(ctx, 951)
+	if !done {
+		t.Fatal("Expected the short stop to trigger")
+	}
+	if exit := api.placed[0]; exit.Get("type") != "buy" || exit.Get("ordertype") != "market" ||
+		exit.Get("leverage") != "2" || exit.Get("reduce_only") != "true" {
+		t.Errorf("unexpected exit order %v", exit)
+	}
+
+	// A spot account cannot be short
+	if _, err := NewTrailingStop(client, TrailingStopConfig{Pair: "XBT/USD", Side: "sell", Volume: 1, Mode: PercentTrail, Distance: 1}); err == nil {
+		t.Error("a short stop without leverage should be rejected")
+	}
+}
+
+func TestTrailingStop_AmendsRestingStop(t *testing.T) {
+	client, received, cleanup := newOrderTestClient(t, map[string]interface{}{
+		"add_order":   map[string]interface{}{"order_id": "OSTOP"},
+		"amend_order": map[string]interface{}{"order_id": "OSTOP", "amend_id": "A1"},
+	})
+	defer cleanup()
+
+	stop, err := NewTrailingStop(client, TrailingStopConfig{
+		Pair:     "XBT/USD",
+		Side:     "buy",
+		Volume:   1,
+		Mode:     PercentTrail,
+		Distance: 10,
+		Exit:     AmendStopExit,
+	})
+	if err != nil {
+		t.Fatalf("NewTrailingStop() error = %v", err)
+	}
+
+	ctx := context.Background()
+	stop.update(ctx, 1000)
+	placed := <-received
+	if placed["method"] != "add_order" || placed["order_type"] != "stop-loss" || placed["side"] != "sell" ||
+		placed["margin"] != nil || placed["reduce_only"] != nil {
+		t.Errorf("unexpected stop-loss order %v", placed)
+	}
+
+	stop.update(ctx, 1100)
+	amended := <-received
+	if amended["method"] != "amend_order" || amended["order_id"] != "OSTOP" || amended["trigger_price"] != 990.0 {
+		t.Errorf("unexpected amend %v", amended)
+	}
+
+	// The exchange executes the stop, so hitting it places no further order
+	if done, _ := stop.update(ctx, 980); !done {
+		t.Error("Expected the stop to trigger")
+	}
+	select {
+	case msg := <-received:
+		t.Errorf("unexpected message after trigger %v", msg)
+	default:
+	}
+}
+
+func TestTrailingStop_MarginStopIsReduceOnly(t *testing.T) {
+	client, received, cleanup := newOrderTestClient(t, map[string]interface{}{
+		"add_order": map[string]interface{}{"order_id": "OSTOP"},
+	})
+	defer cleanup()
+
+	stop, err := NewTrailingStop(client, TrailingStopConfig{
+		Pair:     "XBT/USD",
+		Side:     "sell",
+		Volume:   1,
+		Leverage: "3",
+		Mode:     PercentTrail,
+		Distance: 10,
+		Exit:     AmendStopExit,
+	})
+	if err != nil {
+		t.Fatalf("NewTrailingStop() error = %v", err)
+	}
+
+	stop.update(context.Background(), 1000)
+	placed := <-received
+	if placed["side"] != "buy" || placed["margin"] != true || placed["reduce_only"] != true {
+		t.Errorf("stop-loss of a short = %v, want a reduce-only margin buy", placed)
+	}
+}
+
+func TestTrailingStop_RetriesFailedExit(t *testing.T) {
+	api := newMockTradingAPI()
+	defer api.Close()
+	api.reject[1] = true
+	api.lost[2] = true
+
+	client := NewTestClient(t, &TestConfig{DemoAPIURL: api.URL})
+	stop, err := NewTrailingStop(client, TrailingStopConfig{
+		Pair:     "XBT/USD",
+		Side:     "buy",
+		Volume:   1,
+		Mode:     PercentTrail,
+		Distance: 10,
+	})
+	if err != nil {
+		t.Fatalf("NewTrailingStop() error = %v", err)
+	}
+
+	ctx := context.Background()
+	stop.update(ctx, 1000)
+
+	// A rejected exit keeps the stop armed
+	if done, err := stop.update(ctx, 890); done || err != nil {
+		t.Fatalf("update(890) = %v, %v, want a retry later", done, err)
+	}
+	if state := stop.State(); state.Triggered || state.Stop != 900 {
+		t.Fatalf("state after a failed exit = %+v", state)
+	}
+
+	// The retry is placed but its response is lost, even though price came back
+	if done, err := stop.update(ctx, 950); done || err != nil {
+		t.Fatalf("update(950) = %v, %v, want a retry later", done, err)
+	}
+
+	// The next retry finds the order instead of exiting twice
+	if done, err := stop.update(ctx, 960); !done || err != nil {
+		t.Fatalf("update(960) = %v, %v, want triggered", done, err)
+	}
+	if len(api.placed) != 1 || api.placed[0].Get("cl_ord_id") != stop.State().ExitClOrdID {
+		t.Errorf("exit orders = %v, want one under the saved cl_ord_id", api.placed)
+	}
+	if state := stop.State(); !state.Triggered || state.ExitTxID != "TX-1" {
+		t.Errorf("state after exit = %+v", state)
+	}
+}
+
+func TestTrailingStop_AmendFailures(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     string
+		wantErr bool
+	}{
+		{name: "transient", err: "EService:Unavailable", wantErr: false},
+		{name: "order gone", err: "EOrder:Unknown order", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, received, cleanup := newOrderTestClient(t, map[string]interface{}{
+				"add_order":   map[string]interface{}{"order_id": "OSTOP"},
+				"amend_order": errors.New(tt.err),
+			})
+			defer cleanup()
+
+			stop, err := NewTrailingStop(client, TrailingStopConfig{
+				Pair:     "XBT/USD",
+				Side:     "buy",
+				Volume:   1,
+				Mode:     PercentTrail,
+				Distance: 10,
+				Exit:     AmendStopExit,
+			})
+			if err != nil {
+				t.Fatalf("NewTrailingStop() error = %v", err)
+			}
+
+			ctx := context.Background()
+			stop.update(ctx, 1000)
+			<-received
+
+			_, err = stop.update(ctx, 1100)
+			<-received
+			if (err != nil) != tt.wantErr {
+				t.Errorf("update() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := stop.State().Stop; got != 900 {
+				t.Errorf("stop = %v, want the last good stop of 900", got)
+			}
+		})
+	}
+}
+
+func TestAverageTrueRange(t *testing.T) {
+	candles := []Candle{
+		{High: 10, Low: 8, Close: 9},
+		{High: 11, Low: 9, Close: 10},  // TR 2
+		{High: 14, Low: 12, Close: 13}, // Gap up: TR = 14 - 10 = 4
+	}
+
+	if got := averageTrueRange(candles, 2); got != 3 {
+		t.Errorf("averageTrueRange() = %v, want 3", got)
+	}
+	if got := averageTrueRange(candles, 3); got != 0 {
+		t.Errorf("averageTrueRange() with too few candles = %v, want 0", got)
+	}
+}
@@ -2,6 +2,8 @@ package kraken
 
 import (
 	"fmt"
+	"math"
+	"strconv"
 	"time"
 )
 
@@ -14,6 +16,19 @@ type OrderRequest struct {
 	Price      string
 	Leverage   string `json:"leverage,omitempty"`
 	OrderFlags string `json:"oflags,omitempty"`
+	UserRef    int64  `json:"userref,omitempty"`
+	ClOrdID    string `json:"cl_ord_id,omitempty"` // Client order ID; the exchange rejects a reused one
+	ReduceOnly bool   `json:"reduce_only,omitempty"`
+	// Close is placed by the exchange to close the position once this
+	// order fills
+	Close *ConditionalClose `json:"close,omitempty"`
+}
+
+// ConditionalClose is an order attached to another that the exchange places
+// when that one fills. Only one can be attached.
+type ConditionalClose struct {
+	Type  OrderType // stop-loss, take-profit or limit
+	Price string    // Trigger price, or limit price for limit
 }
 
 type OrderResponse struct {
@@ -24,14 +39,205 @@ type OrderResponse struct {
 	TransactionIds []string `json:"txid"`
 }
 
+// OrderInfo is the state of an order as returned by QueryOrders
+type OrderInfo struct {
+	Status      string `json:"status"` // pending, open, closed, canceled or expired
+	RefID       string `json:"refid"`  // Order whose conditional close created this one
+	UserRef     int64  `json:"userref"`
+	ClOrdID     string `json:"cl_ord_id"`
+	Volume      string `json:"vol"`
+	VolumeExec  string `json:"vol_exec"`
+	Cost        string `json:"cost"`
+	Fee         string `json:"fee"`
+	AvgPrice    string `json:"price"`
+	Description struct {
+		Pair      string `json:"pair"`
+		Type      string `json:"type"`
+		OrderType string `json:"ordertype"`
+		Price     string `json:"price"`
+		Order     string `json:"order"`
+	} `json:"descr"`
+}
+
+// Remaining returns the unfilled volume of the order
+func (o OrderInfo) Remaining() float64 {
+	vol, _ := strconv.ParseFloat(o.Volume, 64)
+	exec, _ := strconv.ParseFloat(o.VolumeExec, 64)
+	return vol - exec
+}
+
+// PositionInfo is an open margin position as returned by OpenPositions
+type PositionInfo struct {
+	Pair      string `json:"pair"`
+	Type      string `json:"type"` // buy or sell
+	Volume    string `json:"vol"`
+	VolClosed string `json:"vol_closed"`
+	Cost      string `json:"cost"`
+	Margin    string `json:"margin"`
+}
+
+// Candle is one OHLC bar
+type Candle struct {
+	Time   time.Time
+	Open   float64
+	High   float64
+	Low    float64
+	Close  float64
+	VWAP   float64
+	Volume float64
+	Count  int
+}
+
+// parseCandle reads a [time, open, high, low, close, vwap, volume, count] row
+func parseCandle(row []interface{}) (Candle, error) {
+	if len(row) < 8 {
+		return Candle{}, fmt.Errorf("invalid OHLC row: %v", row)
+	}
+
+	ts, _ := row[0].(float64)
+	count, _ := row[7].(float64)
+	candle := Candle{Time: time.Unix(int64(ts), 0), Count: int(count)}
+
+	fields := []*float64{&candle.Open, &candle.High, &candle.Low, &candle.Close, &candle.VWAP, &candle.Volume}
+	for i, f := range fields {
+		s, _ := row[i+1].(string)
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return Candle{}, fmt.Errorf("invalid OHLC value %v: %w", row[i+1], err)
+		}
+		*f = v
+	}
+
+	return candle, nil
+}
+
+// AssetPair is the trading rules of a pair from the public AssetPairs call
+type AssetPair struct {
+	Name         string      `json:"-"` // Kraken's name, e.g. XXBTZUSD
+	Altname      string      `json:"altname"`
+	WSName       string      `json:"wsname"`
+	Base         string      `json:"base"`
+	Quote        string      `json:"quote"`
+	PairDecimals int         `json:"pair_decimals"`
+	LotDecimals  int         `json:"lot_decimals"`
+	OrderMin     string      `json:"ordermin"`
+	CostMin      string      `json:"costmin"`
+	Fees         [][]float64 `json:"fees"`
+	FeesMaker    [][]float64 `json:"fees_maker"`
+}
+
+// RoundPrice rounds price to the pair's price precision
+func (p *AssetPair) RoundPrice(price float64) float64 {
+	scale := math.Pow(10, float64(p.PairDecimals))
+	return math.Round(price*scale) / scale
+}
+
+// FormatPrice formats price with the pair's price precision, as AddOrder
+// rejects prices with more decimals
+func (p *AssetPair) FormatPrice(price float64) string {
+	return strconv.FormatFloat(p.RoundPrice(price), 'f', p.PairDecimals, 64)
+}
+
+// MakerFee is the maker fee in percent at the lowest volume tier
+func (p *AssetPair) MakerFee() float64 {
+	if len(p.FeesMaker) > 0 && len(p.FeesMaker[0]) == 2 {
+		return p.FeesMaker[0][1]
+	}
+	return DefaultMakerFee
+}
+
 // WebSocket API types
 type WSOrderRequest struct {
-	OrderType  string  `json:"order_type"`
-	Side       string  `json:"side"`
-	OrderQty   float64 `json:"order_qty"`
-	Symbol     string  `json:"symbol"`
-	LimitPrice float64 `json:"limit_price,omitempty"`
-	Token      string  `json:"token"`
+	OrderType    string     `json:"order_type"`
+	Side         string     `json:"side"`
+	OrderQty     float64    `json:"order_qty"`
+	Symbol       string     `json:"symbol,omitempty"`
+	LimitPrice   float64    `json:"limit_price,omitempty"`
+	TimeInForce  string     `json:"time_in_force,omitempty"`
+	PostOnly     bool       `json:"post_only,omitempty"`
+	ReduceOnly   bool       `json:"reduce_only,omitempty"`
+	Margin       bool       `json:"margin,omitempty"`
+	ClOrdID      string     `json:"cl_ord_id,omitempty"`
+	OrderUserref int64      `json:"order_userref,omitempty"`
+	Triggers     *WSTrigger `json:"triggers,omitempty"`
+	Token        string     `json:"token,omitempty"`
+}
+
+// WSTrigger holds the trigger of a stop-loss or take-profit order
+type WSTrigger struct {
+	Reference string  `json:"reference,omitempty"` // "last" or "index"
+	Price     float64 `json:"price"`
+	PriceType string  `json:"price_type,omitempty"` // "static", "pct" or "quote"
+}
+
+// WSOrderResult identifies an order placed, amended or edited over WebSocket
+type WSOrderResult struct {
+	OrderID         string `json:"order_id"`
+	OriginalOrderID string `json:"original_order_id,omitempty"`
+	ClOrdID         string `json:"cl_ord_id,omitempty"`
+	OrderUserref    int64  `json:"order_userref,omitempty"`
+	AmendID         string `json:"amend_id,omitempty"`
+}
+
+// Execution is an update from the private executions channel
+type Execution struct {
+	ExecType     string  `json:"exec_type"` // e.g. new, trade, filled, canceled, expired
+	OrderID      string  `json:"order_id"`
+	OrderUserref int64   `json:"order_userref"`
+	OrderStatus  string  `json:"order_status"`
+	Symbol       string  `json:"symbol"`
+	Side         string  `json:"side"`
+	LastQty      float64 `json:"last_qty"`
+	LastPrice    float64 `json:"last_price"`
+	CumQty       float64 `json:"cum_qty"`
+	AvgPrice     float64 `json:"avg_price"`
+}
+
+// WSCancelRequest selects orders to cancel by any combination of identifiers
+type WSCancelRequest struct {
+	OrderIDs      []string `json:"order_id,omitempty"`
+	ClOrdIDs      []string `json:"cl_ord_id,omitempty"`
+	OrderUserrefs []int64  `json:"order_userref,omitempty"`
+	Token         string   `json:"token,omitempty"`
+}
+
+// WSAmendRequest changes an order in place, keeping its queue priority
+// where the exchange allows it
+type WSAmendRequest struct {
+	OrderID      string  `json:"order_id,omitempty"`
+	ClOrdID      string  `json:"cl_ord_id,omitempty"`
+	OrderQty     float64 `json:"order_qty,omitempty"`
+	LimitPrice   float64 `json:"limit_price,omitempty"`
+	TriggerPrice float64 `json:"trigger_price,omitempty"`
+	PostOnly     bool    `json:"post_only,omitempty"`
+	Token        string  `json:"token,omitempty"`
+}
+
+// WSEditRequest replaces an order with a new one carrying a new order ID
+type WSEditRequest struct {
+	OrderID      string     `json:"order_id"`
+	Symbol       string     `json:"symbol"`
+	OrderQty     float64    `json:"order_qty,omitempty"`
+	LimitPrice   float64    `json:"limit_price,omitempty"`
+	OrderUserref int64      `json:"order_userref,omitempty"`
+	PostOnly     bool       `json:"post_only,omitempty"`
+	ReduceOnly   bool       `json:"reduce_only,omitempty"`
+	Triggers     *WSTrigger `json:"triggers,omitempty"`
+	Token        string     `json:"token,omitempty"`
+}
+
+// WSBatchAddRequest places 2 to 15 orders on one symbol at once
+type WSBatchAddRequest struct {
+	Symbol string           `json:"symbol"`
+	Orders []WSOrderRequest `json:"orders"`
+	Token  string           `json:"token,omitempty"`
+}
+
+// WSBatchCancelRequest cancels 2 to 50 orders by order ID or userref
+type WSBatchCancelRequest struct {
+	Orders   []string `json:"orders,omitempty"`
+	ClOrdIDs []string `json:"cl_ord_id,omitempty"`
+	Token    string   `json:"token,omitempty"`
 }
 
 type OrderType string
@@ -69,10 +275,25 @@ func (r *OrderRequest) Validate() error {
 		}
 	case MarketOrder:
 		// Market orders don't need price
+	case StopLossOrder, TakeProfitOrder:
+		if r.Price == "" {
+			return fmt.Errorf("trigger price is required for %s orders", r.Type)
+		}
 	default:
 		return fmt.Errorf("invalid order type: %s", r.Type)
 	}
 
+	if r.Close != nil {
+		switch r.Close.Type {
+		case StopLossOrder, TakeProfitOrder, LimitOrder:
+		default:
+			return fmt.Errorf("invalid conditional close type: %s", r.Close.Type)
+		}
+		if r.Close.Price == "" {
+			return fmt.Errorf("price is required for the conditional close")
+		}
+	}
+
 	if r.Side != "buy" && r.Side != "sell" {
 		return fmt.Errorf("invalid side: must be buy or sell")
 	}
@@ -85,6 +306,10 @@ func (r *OrderRequest) Validate() error {
 		return fmt.Errorf("invalid leverage: must be none, 2, 3, 4, or 5")
 	}
 
+	if r.UserRef != 0 && r.ClOrdID != "" {
+		return fmt.Errorf("userref and cl_ord_id cannot be combined")
+	}
+
 	return nil
 }
 
@@ -99,4 +324,39 @@ type TrailingEntryConfig struct {
 	Interval     time.Duration
 	Leverage     string
 	Weights      []float64
+	Factor       float64 // Growth per rung for ExponentialDistribution
+	Sigma        float64 // Width in rungs for GaussianDistribution
+	Spacing      PriceSpacing
+	Prices       []float64 // Explicit rung prices for ExplicitSpacing
+	AllOrNothing bool      // Cancel placed rungs if any rung fails
+	UserRef      int64     // Tag shared by every rung of the ladder
+	ClOrdIDs     []string  // cl_ord_id of each rung instead of UserRef; rungs already placed under one are kept
+	StopLoss     float64   // Stop-loss attached to every rung as its conditional close
+
+	// Trailing mode: when TrailDistance is set the ladder is only placed once
+	// price, having entered the band, reverses from its local extreme by this
+	// distance. When price moves away from the resting ladder by the same
+	// distance, its unfilled volume is re-centred at most once per Interval.
+	TrailDistance float64
+	TrailPercent  bool // TrailDistance is a percentage of the extreme
+
+	// Exit ladder: when ExitTargets is set every entry fill is split into
+	// take-profit limit orders this many percent beyond the fill price.
+	// ExitWeights is the relative share of each target, even if empty.
+	ExitTargets []float64
+	ExitWeights []float64
+}
+
+// validateLadder checks that the band and rung count can be laid out
+func (c *TrailingEntryConfig) validateLadder() error {
+	if c.Spacing == ExplicitSpacing {
+		return nil
+	}
+	if c.NumOrders <= 0 {
+		return fmt.Errorf("a ladder needs at least one order, got %d", c.NumOrders)
+	}
+	if c.Spacing == GeometricSpacing && c.LowerBand <= 0 {
+		return fmt.Errorf("geometric spacing needs a positive lower band, got %.2f", c.LowerBand)
+	}
+	return nil
 }
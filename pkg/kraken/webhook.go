@@ -1,53 +1,306 @@
 package kraken
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TradingViewIPs are the addresses TradingView sends webhook alerts from
+var TradingViewIPs = []string{
+	"52.89.214.238",
+	"34.212.75.30",
+	"54.218.53.128",
+	"52.32.178.7",
+}
+
+const (
+	// SignatureHeader carries the hex HMAC-SHA256 of "<timestamp>.<body>"
+	SignatureHeader = "X-Signature"
+	// TimestampHeader carries the Unix time the alert was signed at
+	TimestampHeader = "X-Timestamp"
+	// AlertIDHeader carries the ID of the alert a response is for
+	AlertIDHeader = "X-Alert-ID"
+	// DuplicateAlertHeader marks a response replayed for a repeated alert
+	DuplicateAlertHeader = "X-Duplicate-Alert"
+
+	// DefaultSignatureMaxAge is how old a signed alert may be before it is
+	// treated as a replay
+	DefaultSignatureMaxAge = 5 * time.Minute
 )
 
 type TradingViewAlert struct {
-	Strategy  string  `json:"strategy"`
-	Action    string  `json:"action"` // "buy" or "sell"
-	Pair      string  `json:"pair"`
-	Price     float64 `json:"price"`
-	Volume    float64 `json:"volume"`
-	OrderType string  `json:"orderType"` // "limit" or "market"
-	StopPrice float64 `json:"stopPrice,omitempty"`
+	ID         string  `json:"id,omitempty"`   // Identifies repeats of the same alert
+	Time       string  `json:"time,omitempty"` // Bar time, e.g. {{time}}
+	Strategy   string  `json:"strategy"`
+	Action     string  `json:"action"` // See AlertAction
+	Pair       string  `json:"pair"`
+	Price      float64 `json:"price"`
+	Volume     float64 `json:"volume"`
+	OrderType  string  `json:"orderType"`            // "limit" or "market"
+	StopPrice  float64 `json:"stopPrice,omitempty"`  // Protective stop-loss of the entry
+	TakeProfit float64 `json:"takeProfit,omitempty"` // Take-profit of a buy or sell
+	Leverage   string  `json:"leverage,omitempty"`
+	Sizing     string  `json:"sizing,omitempty"` // See SizingMode; without it volume is used
+	Size       float64 `json:"size,omitempty"`
+	Passphrase string  `json:"passphrase,omitempty"`
+
+	// Ladder action
+	Side         string  `json:"side,omitempty"`
+	UpperBand    float64 `json:"upperBand,omitempty"`
+	LowerBand    float64 `json:"lowerBand,omitempty"`
+	Orders       int     `json:"orders,omitempty"` // Number of rungs, 5 if unset
+	Distribution string  `json:"distribution,omitempty"`
+}
+
+// WebhookAuth decides which requests may place orders. Every configured
+// check must pass.
+type WebhookAuth struct {
+	Passphrase string        // Required in the alert body when set
+	HMACSecret string        // Requires a valid signature header when set
+	MaxAge     time.Duration // Signed alerts older than this are rejected
+	AllowedIPs []string      // IPs or CIDRs; empty allows any source
+	TrustProxy bool          // Take the client IP from X-Forwarded-For
+}
+
+// WebhookConfig configures the webhook handler
+type WebhookConfig struct {
+	Auth   WebhookAuth
+	Dedupe *AlertDeduper // Answers repeated alerts with their result, which the queue records (see SetDeduper); nil disables
+	Sizing SizingConfig
+	// ResponseWait is how long a response waits for the alert to be
+	// processed before answering 202 Accepted; 0 answers at once
+	ResponseWait time.Duration
+	// Mapping reads alerts that do not use the TradingViewAlert field names,
+	// or are plain text; nil expects TradingViewAlert JSON
+	Mapping *AlertMapping
+}
+
+// authorize checks the source address and signature of a request
+func (a *WebhookAuth) authorize(r *http.Request, body []byte, now time.Time) error {
+	if len(a.AllowedIPs) > 0 {
+		ip := clientIP(r, a.TrustProxy)
+		if ip == nil || !ipAllowed(ip, a.AllowedIPs) {
+			return fmt.Errorf("source %s is not allowed", r.RemoteAddr)
+		}
+	}
+
+	if a.HMACSecret != "" {
+		if err := a.verifySignature(r.Header, body, now); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func WebhookHandler(client *Client) http.HandlerFunc {
+// checkPassphrase compares the alert's passphrase in constant time
+func (a *WebhookAuth) checkPassphrase(alert *TradingViewAlert) error {
+	if a.Passphrase == "" {
+		return nil
+	}
+	if subtle.ConstantTimeCompare([]byte(alert.Passphrase), []byte(a.Passphrase)) != 1 {
+		return fmt.Errorf("invalid passphrase")
+	}
+	return nil
+}
+
+// verifySignature checks the HMAC of the timestamp and body, rejecting
+// timestamps outside MaxAge so that a captured request cannot be replayed
+func (a *WebhookAuth) verifySignature(header http.Header, body []byte, now time.Time) error {
+	maxAge := a.MaxAge
+	if maxAge <= 0 {
+		maxAge = DefaultSignatureMaxAge
+	}
+
+	ts := header.Get(TimestampHeader)
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return fmt.Errorf("missing or invalid %s header", TimestampHeader)
+	}
+	if age := now.Sub(time.Unix(unix, 0)); age > maxAge || age < -maxAge {
+		return fmt.Errorf("signature timestamp is outside the allowed window")
+	}
+
+	sig, err := hex.DecodeString(header.Get(SignatureHeader))
+	if err != nil || len(sig) == 0 {
+		return fmt.Errorf("missing or invalid %s header", SignatureHeader)
+	}
+	if !hmac.Equal(sig, SignWebhook(a.HMACSecret, ts, body)) {
+		return fmt.Errorf("invalid signature")
+	}
+	return nil
+}
+
+// SignWebhook returns the HMAC-SHA256 of "<timestamp>.<body>"
+func SignWebhook(secret, timestamp string, body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+// clientIP returns the address a request came from. Behind a proxy, the last
+// X-Forwarded-For entry is the one the proxy itself appended.
+func clientIP(r *http.Request, trustProxy bool) net.IP {
+	if trustProxy {
+		if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+			hops := strings.Split(fwd, ",")
+			return net.ParseIP(strings.TrimSpace(hops[len(hops)-1]))
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// ipAllowed reports whether ip matches one of the allowed IPs or CIDRs
+func ipAllowed(ip net.IP, allowed []string) bool {
+	for _, a := range allowed {
+		if strings.Contains(a, "/") {
+			if _, network, err := net.ParseCIDR(a); err == nil && network.Contains(ip) {
+				return true
+			}
+		} else if allowedIP := net.ParseIP(a); allowedIP != nil && allowedIP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookHandler authenticates alerts and saves them to the queue. The
+// response carries the outcome when the alert is processed within
+// config.ResponseWait, and is otherwise 202 Accepted with the alert ID.
+func WebhookHandler(queue *AlertQueue, config WebhookConfig) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			writeError(w, http.StatusMethodNotAllowed, "", InvalidAlert, "method not allowed")
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, "", InvalidAlert, fmt.Sprintf("request body exceeds %d bytes", tooLarge.Limit))
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "", InvalidAlert, "invalid request body")
+			return
+		}
+
+		if err := config.Auth.authorize(r, body, time.Now()); err != nil {
+			fmt.Printf("Rejected webhook from %s: %v\n", r.RemoteAddr, err)
+			writeError(w, AuthFailed.Status(), "", AuthFailed, "unauthorized")
 			return
 		}
 
 		var alert TradingViewAlert
-		if err := json.NewDecoder(r.Body).Decode(&alert); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+		if config.Mapping != nil {
+			if alert, err = config.Mapping.Decode(body); err != nil {
+				writeError(w, InvalidAlert.Status(), "", InvalidAlert, "invalid request body: "+err.Error())
+				return
+			}
+		} else if err := json.Unmarshal(body, &alert); err != nil {
+			writeError(w, InvalidAlert.Status(), "", InvalidAlert, "invalid request body")
+			return
+		}
+
+		if err := config.Auth.checkPassphrase(&alert); err != nil {
+			fmt.Printf("Rejected webhook from %s: %v\n", r.RemoteAddr, err)
+			writeError(w, AuthFailed.Status(), "", AuthFailed, "unauthorized")
+			return
+		}
+
+		config.Sizing.apply(&alert)
+		if err := alert.Validate(); err != nil {
+			writeError(w, InvalidAlert.Status(), "", InvalidAlert, err.Error())
 			return
 		}
 
-		// Create order request
-		order := OrderRequest{
-			Pair:   alert.Pair,
-			Type:   OrderType(alert.OrderType),
-			Side:   alert.Action,
-			Volume: fmt.Sprintf("%.8f", alert.Volume),
+		// Without either, every repeat of an identical alert would be dropped
+		if config.Dedupe != nil && alert.ID == "" && alert.Time == "" {
+			writeError(w, InvalidAlert.Status(), "", InvalidAlert, "alert needs an id or time field while repeats are detected")
+			return
 		}
 
-		if alert.OrderType == "limit" {
-			order.Price = fmt.Sprintf("%.2f", alert.Price)
+		id := AlertID(&alert)
+		w.Header().Set(AlertIDHeader, id)
+
+		if config.Dedupe != nil {
+			prev, first, err := config.Dedupe.Begin(id, time.Now())
+			if err != nil {
+				writeError(w, InternalError.Status(), id, InternalError, "failed to record alert")
+				return
+			}
+			if !first {
+				fmt.Printf("Ignoring repeat of alert %s\n", id)
+				w.Header().Set(DuplicateAlertHeader, "true")
+				if !prev.Done {
+					writeError(w, DuplicateAlert.Status(), id, DuplicateAlert, "alert is already being processed")
+					return
+				}
+				writeResult(w, prev.Status, prev.Body)
+				return
+			}
 		}
 
-		// Place the order
-		_, err := client.AddOrder(r.Context(), order)
+		queued, err := queue.Enqueue(id, alert)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			fmt.Printf("failed to queue alert %s: %v\n", id, err)
+			if config.Dedupe != nil {
+				config.Dedupe.Release(id)
+			}
+			writeError(w, InternalError.Status(), id, InternalError, "failed to queue alert")
 			return
 		}
 
-		w.WriteHeader(http.StatusOK)
+		if config.ResponseWait > 0 {
+			timer := time.NewTimer(config.ResponseWait)
+			defer timer.Stop()
+
+			select {
+			case <-queued.done:
+				status, resp := queued.response()
+				data, _ := json.Marshal(resp)
+				writeResult(w, status, string(data))
+				return
+			case <-timer.C:
+			case <-r.Context().Done():
+			}
+		}
+		// Not recorded: repeats are told the alert is still being processed
+		// until the queue records its result
+		data, _ := json.Marshal(WebhookResponse{AlertID: id, Status: AlertQueued})
+		writeResult(w, http.StatusAccepted, string(data))
 	}
 }
+
+// writeError answers with an error response for an alert that was not queued
+func writeError(w http.ResponseWriter, status int, id string, code ErrorCode, message string) {
+	data, _ := json.Marshal(WebhookResponse{
+		AlertID: id,
+		Status:  AlertRejected,
+		Error:   &ResponseError{Code: code, Message: message},
+	})
+	writeResult(w, status, string(data))
+}
+
+// writeResult sends a JSON response body
+func writeResult(w http.ResponseWriter, status int, body string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	io.WriteString(w, body)
+}
@@ -0,0 +1,304 @@
+package kraken
+
+import (
+	"context"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebhookHandler_Auth(t *testing.T) {
+	const body = `{"action":"buy","pair":"XBTUSD","volume":0.1,"orderType":"market","passphrase":"hunter2"}`
+	now := time.Now()
+	ts := strconv.FormatInt(now.Unix(), 10)
+	sign := func(ts, body string) string {
+		return hex.EncodeToString(SignWebhook("secret", ts, []byte(body)))
+	}
+
+	auth := WebhookAuth{
+		Passphrase: "hunter2",
+		HMACSecret: "secret",
+		AllowedIPs: []string{"52.89.214.238", "10.0.0.0/8"},
+	}
+
+	tests := []struct {
+		name       string
+		auth       WebhookAuth
+		body       string
+		remote     string
+		headers    map[string]string
+		wantStatus int
+	}{
+		{
+			name:       "valid",
+			auth:       auth,
+			body:       body,
+			remote:     "52.89.214.238:443",
+			headers:    map[string]string{TimestampHeader: ts, SignatureHeader: sign(ts, body)},
+			wantStatus: http.StatusAccepted,
+		},
+		{
+			name:       "allowed by CIDR",
+			auth:       WebhookAuth{AllowedIPs: auth.AllowedIPs},
+			body:       body,
+			remote:     "10.1.2.3:5000",
+			wantStatus: http.StatusAccepted,
+		},
+		{
+			name:       "source not allowed",
+			auth:       auth,
+			body:       body,
+			remote:     "1.2.3.4:443",
+			headers:    map[string]string{TimestampHeader: ts, SignatureHeader: sign(ts, body)},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "forwarded source",
+			auth:       WebhookAuth{AllowedIPs: auth.AllowedIPs, TrustProxy: true},
+			body:       body,
+			remote:     "127.0.0.1:443",
+			headers:    map[string]string{"X-Forwarded-For": "6.6.6.6, 52.89.214.238"},
+			wantStatus: http.StatusAccepted,
+		},
+		{
+			name:       "spoofed forwarded source",
+			auth:       WebhookAuth{AllowedIPs: auth.AllowedIPs, TrustProxy: true},
+			body:       body,
+			remote:     "127.0.0.1:443",
+			headers:    map[string]string{"X-Forwarded-For": "52.89.214.238, 6.6.6.6"},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "wrong passphrase",
+			auth:       WebhookAuth{Passphrase: "other"},
+			body:       body,
+			remote:     "1.2.3.4:443",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "missing signature",
+			auth:       WebhookAuth{HMACSecret: "secret"},
+			body:       body,
+			remote:     "1.2.3.4:443",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "tampered body",
+			auth:       WebhookAuth{HMACSecret: "secret"},
+			body:       strings.Replace(body, "0.1", "10", 1),
+			remote:     "1.2.3.4:443",
+			headers:    map[string]string{TimestampHeader: ts, SignatureHeader: sign(ts, body)},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:   "replayed signature",
+			auth:   WebhookAuth{HMACSecret: "secret"},
+			body:   body,
+			remote: "1.2.3.4:443",
+			headers: map[string]string{
+				TimestampHeader: strconv.FormatInt(now.Add(-10*time.Minute).Unix(), 10),
+				SignatureHeader: sign(strconv.FormatInt(now.Add(-10*time.Minute).Unix(), 10), body),
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queue, err := NewAlertQueue(nil, t.TempDir(), 1)
+			if err != nil {
+				t.Fatalf("NewAlertQueue() error = %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(tt.body))
+			req.RemoteAddr = tt.remote
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+
+			WebhookHandler(queue, WebhookConfig{Auth: tt.auth})(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d (%s)", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if queued := queue.Len(); (tt.wantStatus == http.StatusAccepted) != (queued == 1) {
+				t.Errorf("queued %d alerts", queued)
+			}
+		})
+	}
+}
+
+func TestWebhookHandler_Dedupe(t *testing.T) {
+	api := newMockTradingAPI()
+	defer api.Close()
+	client := NewTestClient(t, &TestConfig{DemoAPIURL: api.URL})
+
+	queue, err := NewAlertQueue(client, t.TempDir(), 2)
+	if err != nil {
+		t.Fatalf("NewAlertQueue() error = %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		queue.Run(ctx)
+		close(stopped)
+	}()
+	defer func() {
+		cancel()
+		<-stopped
+	}()
+
+	path := filepath.Join(t.TempDir(), "alerts.json")
+	dedupe, err := NewAlertDeduper(path, time.Hour)
+	if err != nil {
+		t.Fatalf("NewAlertDeduper() error = %v", err)
+	}
+	queue.SetDeduper(dedupe)
+	handler := WebhookHandler(queue, WebhookConfig{Dedupe: dedupe})
+
+	send := func(h http.HandlerFunc, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		return rec
+	}
+
+	// An alert without an id or time cannot be told from its repeats
+	if rec := send(handler, `{"action":"buy","pair":"XBTUSD","volume":0.1,"orderType":"market"}`); rec.Code != http.StatusBadRequest ||
+		!strings.Contains(rec.Body.String(), string(InvalidAlert)) {
+		t.Errorf("alert without id or time: status %d, body %s", rec.Code, rec.Body)
+	}
+
+	const alert = `{"action":"buy","pair":"XBTUSD","volume":0.1,"orderType":"market","time":"2024-01-01T00:00:00Z"}`
+	first := send(handler, alert)
+	if first.Code != http.StatusAccepted || first.Header().Get(AlertIDHeader) == "" {
+		t.Fatalf("first alert: status %d, id %q", first.Code, first.Header().Get(AlertIDHeader))
+	}
+
+	// The queue records the result once the order is placed
+	id := first.Header().Get(AlertIDHeader)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if prev, _, _ := dedupe.Begin(id, time.Now()); prev.Done {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("result of the alert was never recorded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Whitespace does not change the alert; a restarted server still knows it
+	restarted, err := NewAlertDeduper(path, time.Hour)
+	if err != nil {
+		t.Fatalf("NewAlertDeduper() error = %v", err)
+	}
+	repeat := send(WebhookHandler(queue, WebhookConfig{Dedupe: restarted}), strings.ReplaceAll(alert, ",", ", "))
+	if repeat.Code != http.StatusOK || repeat.Header().Get(DuplicateAlertHeader) != "true" ||
+		!strings.Contains(repeat.Body.String(), `"status":"done"`) || !strings.Contains(repeat.Body.String(), "TX-1") {
+		t.Errorf("repeat: status %d, headers %v, body %s", repeat.Code, repeat.Header(), repeat.Body)
+	}
+
+	// The next bar is a new alert
+	if rec := send(handler, strings.Replace(alert, "00:00:00", "01:00:00", 1)); rec.Header().Get(DuplicateAlertHeader) != "" {
+		t.Error("alert for a new bar treated as a repeat")
+	}
+
+	waitForOrders(t, api, 2)
+	if a, b := api.placed[0].Get("cl_ord_id"), api.placed[1].Get("cl_ord_id"); a == "" || a == b {
+		t.Errorf("cl_ord_ids = %q, %q, want distinct IDs", a, b)
+	}
+}
+
+func TestAlertDeduper_ReleasesFailures(t *testing.T) {
+	dedupe, _ := NewAlertDeduper("", time.Hour)
+	now := time.Now()
+
+	if _, first, _ := dedupe.Begin("a", now); !first {
+		t.Fatal("first Begin() should claim the ID")
+	}
+	if prev, first, _ := dedupe.Begin("a", now); first || prev.Done {
+		t.Error("repeat while in flight should see a pending record")
+	}
+
+	// The order may have been placed before the response was lost
+	dedupe.Finish("a", http.StatusServiceUnavailable, `{"status":"failed"}`)
+	if prev, first, _ := dedupe.Begin("a", now); first || prev.Status != http.StatusServiceUnavailable {
+		t.Error("an alert with an unknown outcome should stay recorded")
+	}
+
+	dedupe.Release("a")
+	if _, first, _ := dedupe.Begin("a", now); !first {
+		t.Error("a released alert should be retryable")
+	}
+
+	dedupe.Finish("a", http.StatusOK, "")
+	if _, first, _ := dedupe.Begin("a", now.Add(2*time.Hour)); !first {
+		t.Error("an alert outside the window should be new")
+	}
+}
+
+func TestAlertQueue_PlaceFindsExisting(t *testing.T) {
+	queue, api := newTestActionQueue(t)
+	ctx := context.Background()
+
+	order := OrderRequest{Pair: "XBTUSD", Type: MarketOrder, Side: "buy", Volume: "1", ClOrdID: alertClOrdID("a")}
+	first, err := queue.place(ctx, order)
+	if err != nil {
+		t.Fatalf("place() error = %v", err)
+	}
+
+	// A retry after a lost response finds the order, open or filled
+	for _, filled := range []bool{false, true} {
+		api.filled["TX-1"] = filled
+		again, err := queue.place(ctx, order)
+		if err != nil || len(again) != 1 || again[0].TxID != first[0].TxID || len(api.placed) != 1 {
+			t.Errorf("filled %v: place() again = %v, %v, placed %d", filled, again, err, len(api.placed))
+		}
+	}
+
+	order.ClOrdID = alertClOrdID("b")
+	if placed, err := queue.place(ctx, order); err != nil || placed[0].TxID != "TX-2" {
+		t.Errorf("place() of a new alert = %v, %v", placed, err)
+	}
+}
+
+func TestAlertClOrdID(t *testing.T) {
+	id := alertClOrdID("alert-1")
+	if len(id) != 36 || id != alertClOrdID("alert-1") || id == alertClOrdID("alert-2") {
+		t.Errorf("alertClOrdID() = %q, want a stable UUID per alert", id)
+	}
+
+	tagged := strategyClOrdID("trend", "alert-1")
+	if len(tagged) != 36 || tagged == id || tagged == strategyClOrdID("trend", "alert-2") {
+		t.Errorf("strategyClOrdID() = %q, want a UUID per alert", tagged)
+	}
+	if !strings.HasPrefix(tagged, strategyTag("trend")) || strings.HasPrefix(tagged, strategyTag("range")) {
+		t.Errorf("strategyClOrdID() = %q, want it tagged with its strategy only", tagged)
+	}
+}
+
+// waitForOrders waits until the queue has placed n orders
+func waitForOrders(t *testing.T, api *mockTradingAPI, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		api.mu.Lock()
+		placed := len(api.placed)
+		api.mu.Unlock()
+
+		if placed == n {
+			return
+		}
+		if placed > n || time.Now().After(deadline) {
+			t.Fatalf("placed %d orders, want %d", placed, n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
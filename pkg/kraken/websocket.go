@@ -0,0 +1,670 @@
+package kraken
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+type ConnectionState int
+
+const (
+	Disconnected ConnectionState = iota
+	Connecting
+	Connected
+	Reconnecting
+)
+
+func (s ConnectionState) String() string {
+	switch s {
+	case Disconnected:
+		return "disconnected"
+	case Connecting:
+		return "connecting"
+	case Connected:
+		return "connected"
+	case Reconnecting:
+		return "reconnecting"
+	default:
+		return fmt.Sprintf("ConnectionState(%d)", int(s))
+	}
+}
+
+// WSEndpoint identifies one of the client's WebSocket connections
+type WSEndpoint string
+
+const (
+	PublicEndpoint  WSEndpoint = "public"  // Market data
+	PrivateEndpoint WSEndpoint = "private" // Trading and account data
+)
+
+// ReconnectPolicy controls how a dropped WebSocket connection is retried
+type ReconnectPolicy struct {
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+	Multiplier   float64
+	Jitter       float64 // Fraction of each delay that is randomised (0-1)
+	MaxAttempts  int     // 0 retries forever
+}
+
+var DefaultReconnectPolicy = ReconnectPolicy{
+	InitialDelay: ReconnectDelay,
+	MaxDelay:     2 * time.Minute,
+	Multiplier:   2,
+	Jitter:       0.2,
+	MaxAttempts:  0,
+}
+
+// delay returns the backoff before the given (1-based) reconnect attempt
+func (p ReconnectPolicy) delay(attempt int) time.Duration {
+	d := float64(p.InitialDelay) * math.Pow(p.Multiplier, float64(attempt-1))
+	if p.MaxDelay > 0 && d > float64(p.MaxDelay) {
+		d = float64(p.MaxDelay)
+	}
+
+	if p.Jitter > 0 {
+		d += d * p.Jitter * (2*rand.Float64() - 1)
+	}
+
+	return time.Duration(d)
+}
+
+// subscription is an active channel subscription replayed on reconnect.
+// Every subscriber of the channel has a handler; handlers run on the read
+// loop and must not block.
+type subscription struct {
+	channel  string
+	symbol   string
+	params   map[string]interface{}
+	handlers map[int64]func(msgType string, data json.RawMessage)
+}
+
+// wsMessage covers both method responses and channel updates of the v2 API
+type wsMessage struct {
+	Method  string          `json:"method,omitempty"`
+	ReqID   int64           `json:"req_id,omitempty"`
+	Success bool            `json:"success,omitempty"`
+	Error   string          `json:"error,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Channel string          `json:"channel,omitempty"`
+	Type    string          `json:"type,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+// wsConn is a single self-healing WebSocket connection. It owns the read
+// loop, correlates requests with responses by req_id and replays its
+// subscriptions after reconnecting.
+type wsConn struct {
+	endpoint WSEndpoint
+	url      string
+	client   *Client
+
+	ws     *websocket.Conn
+	wsLock sync.Mutex // Guards ws, done, closed and all writes
+	done   chan struct{}
+	closed bool
+
+	state     ConnectionState
+	stateLock sync.RWMutex
+
+	subs        map[string]*subscription
+	subsLock    sync.Mutex // Guards subs and subscription messages, so that they go out in order
+	handlerID   int64
+	pending     map[int64]chan wsMessage
+	pendingLock sync.Mutex
+	reqID       int64
+}
+
+func newWSConn(client *Client, endpoint WSEndpoint, url string) *wsConn {
+	return &wsConn{
+		endpoint: endpoint,
+		url:      url,
+		client:   client,
+		subs:     make(map[string]*subscription),
+		pending:  make(map[int64]chan wsMessage),
+	}
+}
+
+// wsURL maps http(s) URLs, as handed out by httptest servers, onto ws(s)
+func wsURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+
+	switch u.Scheme {
+	case "http":
+		u.Scheme = "ws"
+	case "https":
+		u.Scheme = "wss"
+	}
+
+	return u.String()
+}
+
+func (w *wsConn) connect(ctx context.Context) error {
+	w.setState(Connecting)
+
+	if err := w.dial(ctx); err != nil {
+		w.setState(Disconnected)
+		return err
+	}
+
+	return nil
+}
+
+// dial opens a new connection and starts its heartbeat and read loops
+func (w *wsConn) dial(ctx context.Context) error {
+	dialer := websocket.Dialer{
+		HandshakeTimeout: 10 * time.Second,
+	}
+
+	conn, _, err := dialer.DialContext(ctx, wsURL(w.url), nil)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s websocket: %w", w.endpoint, err)
+	}
+
+	done := make(chan struct{})
+
+	w.wsLock.Lock()
+	w.ws = conn
+	w.done = done
+	w.closed = false
+	w.wsLock.Unlock()
+
+	w.setState(Connected)
+
+	// Start heartbeat
+	go w.heartbeat(ctx, conn, done)
+	// Start read loop and reconnection monitor
+	go w.monitorConnection(ctx, conn, done)
+
+	return nil
+}
+
+func (w *wsConn) heartbeat(ctx context.Context, conn *websocket.Conn, done chan struct{}) {
+	ticker := time.NewTicker(HeartbeatInterval)
+	defer ticker.Stop()
+
+	// A single refresher keeps slow countdown requests from piling up
+	refresh := make(chan struct{}, 1)
+	stop := make(chan struct{})
+	defer close(stop)
+	if w.endpoint == PrivateEndpoint {
+		go w.client.refreshDeadMansSwitchLoop(ctx, refresh, stop)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			// Unblock the read loop; it will not reconnect once ctx is done
+			conn.Close()
+			w.setState(Disconnected)
+			return
+		case <-done:
+			return
+		case <-ticker.C:
+			w.wsLock.Lock()
+			err := conn.WriteMessage(websocket.PingMessage, nil)
+			w.wsLock.Unlock()
+
+			if err != nil {
+				// Closing the connection hands over to the read loop's reconnect
+				fmt.Printf("%s heartbeat failed: %v\n", w.endpoint, err)
+				conn.Close()
+				return
+			}
+
+			if w.endpoint == PrivateEndpoint {
+				select {
+				case refresh <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}
+}
+
+// monitorConnection is the only reader of conn. It dispatches every message
+// and triggers a reconnect when the connection drops unexpectedly.
+func (w *wsConn) monitorConnection(ctx context.Context, conn *websocket.Conn, done chan struct{}) {
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-done:
+				return
+			default:
+			}
+
+			fmt.Printf("%s connection error: %v\n", w.endpoint, err)
+			w.reconnect(ctx, conn)
+			return
+		}
+
+		w.dispatch(message)
+	}
+}
+
+func (w *wsConn) reconnect(ctx context.Context, stale *websocket.Conn) {
+	w.wsLock.Lock()
+	if w.closed || w.ws != stale {
+		w.wsLock.Unlock()
+		return
+	}
+	if w.done != nil {
+		close(w.done)
+		w.done = nil
+	}
+	w.wsLock.Unlock()
+
+	stale.Close()
+	w.failPending("connection lost")
+	w.setState(Reconnecting)
+
+	policy := w.client.reconnectPolicy
+	for attempt := 1; policy.MaxAttempts <= 0 || attempt <= policy.MaxAttempts; attempt++ {
+		select {
+		case <-ctx.Done():
+			w.setState(Disconnected)
+			return
+		case <-time.After(policy.delay(attempt)):
+		}
+
+		if w.isClosed() {
+			return
+		}
+
+		if err := w.dial(ctx); err != nil {
+			fmt.Printf("%s reconnect attempt %d failed: %v\n", w.endpoint, attempt, err)
+			continue
+		}
+
+		if err := w.resubscribe(); err != nil {
+			// The read loop of the new connection picks this up and retries
+			fmt.Printf("%s resubscribe failed: %v\n", w.endpoint, err)
+		}
+		return
+	}
+
+	fmt.Printf("%s websocket: giving up after %d reconnect attempts\n", w.endpoint, policy.MaxAttempts)
+	w.setState(Disconnected)
+}
+
+// dispatch routes an incoming message to the pending request or
+// subscription it belongs to
+func (w *wsConn) dispatch(message []byte) {
+	var msg wsMessage
+	if err := json.Unmarshal(message, &msg); err != nil {
+		return
+	}
+
+	if msg.ReqID != 0 {
+		w.pendingLock.Lock()
+		ch, ok := w.pending[msg.ReqID]
+		w.pendingLock.Unlock()
+		if ok {
+			select {
+			case ch <- msg:
+			default:
+			}
+		}
+		return
+	}
+
+	if msg.Channel == "" || len(msg.Data) == 0 {
+		return
+	}
+
+	var items []json.RawMessage
+	if err := json.Unmarshal(msg.Data, &items); err != nil {
+		return
+	}
+
+	for _, item := range items {
+		var head struct {
+			Symbol string `json:"symbol"`
+		}
+		if err := json.Unmarshal(item, &head); err != nil {
+			continue
+		}
+
+		w.subsLock.Lock()
+		sub, ok := w.subs[subscriptionKey(msg.Channel, head.Symbol)]
+		if !ok {
+			// Channels such as executions are not keyed by symbol
+			sub, ok = w.subs[subscriptionKey(msg.Channel, "")]
+		}
+		var handlers []func(string, json.RawMessage)
+		if ok {
+			for _, h := range sub.handlers {
+				handlers = append(handlers, h)
+			}
+		}
+		w.subsLock.Unlock()
+
+		for _, h := range handlers {
+			h(msg.Type, item)
+		}
+	}
+}
+
+// request sends a method call and waits for the response with the same req_id
+func (w *wsConn) request(ctx context.Context, method string, params interface{}) (*wsMessage, error) {
+	id := atomic.AddInt64(&w.reqID, 1)
+	ch := make(chan wsMessage, 1)
+
+	w.pendingLock.Lock()
+	w.pending[id] = ch
+	w.pendingLock.Unlock()
+
+	defer func() {
+		w.pendingLock.Lock()
+		delete(w.pending, id)
+		w.pendingLock.Unlock()
+	}()
+
+	message := map[string]interface{}{
+		"method": method,
+		"params": params,
+		"req_id": id,
+	}
+
+	if err := w.writeJSON(message); err != nil {
+		return nil, err
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case resp := <-ch:
+		if resp.Error != "" {
+			return &resp, fmt.Errorf("API error: %s", resp.Error)
+		}
+		return &resp, nil
+	}
+}
+
+// failPending resolves every in-flight request with reason
+func (w *wsConn) failPending(reason string) {
+	w.pendingLock.Lock()
+	defer w.pendingLock.Unlock()
+
+	for id, ch := range w.pending {
+		select {
+		case ch <- wsMessage{ReqID: id, Error: reason}:
+		default:
+		}
+	}
+}
+
+func (w *wsConn) writeJSON(v interface{}) error {
+	w.wsLock.Lock()
+	defer w.wsLock.Unlock()
+
+	if w.ws == nil {
+		return fmt.Errorf("%s websocket connection not established", w.endpoint)
+	}
+
+	return w.ws.WriteJSON(v)
+}
+
+// close shuts the connection down and disables reconnection
+func (w *wsConn) close() error {
+	w.wsLock.Lock()
+	w.closed = true
+	if w.done != nil {
+		close(w.done)
+		w.done = nil
+	}
+	ws := w.ws
+	w.wsLock.Unlock()
+
+	var err error
+	if ws != nil {
+		err = ws.Close()
+	}
+
+	w.failPending("connection closed")
+	w.setState(Disconnected)
+	return err
+}
+
+func (w *wsConn) isClosed() bool {
+	w.wsLock.Lock()
+	defer w.wsLock.Unlock()
+	return w.closed
+}
+
+func subscriptionKey(channel, symbol string) string {
+	return channel + ":" + symbol
+}
+
+// subscribe registers a handler for a channel subscription, which is
+// replayed after a reconnect. Subscribers of the same channel and symbol
+// share one subscription, and it is only unsubscribed once the ctx of every
+// one of them is done. An empty symbol subscribes to a channel that is not
+// keyed by symbol.
+func (w *wsConn) subscribe(ctx context.Context, channel, symbol string, params map[string]interface{}, handler func(msgType string, data json.RawMessage)) error {
+	key := subscriptionKey(channel, symbol)
+
+	w.subsLock.Lock()
+	sub, exists := w.subs[key]
+	if !exists {
+		sub = &subscription{
+			channel:  channel,
+			symbol:   symbol,
+			params:   params,
+			handlers: make(map[int64]func(string, json.RawMessage)),
+		}
+		w.subs[key] = sub
+	}
+	w.handlerID++
+	id := w.handlerID
+	sub.handlers[id] = handler
+
+	var err error
+	switch {
+	case !exists:
+		err = w.writeJSON(sub.message("subscribe"))
+	case channel == "book":
+		// A new subscriber needs a snapshot to build its book from; the
+		// others reset theirs from the same snapshot
+		if err = w.writeJSON(sub.message("unsubscribe")); err == nil {
+			err = w.writeJSON(sub.message("subscribe"))
+		}
+	}
+	if err != nil {
+		w.removeHandler(key, id)
+		w.subsLock.Unlock()
+		return fmt.Errorf("failed to subscribe: %w", err)
+	}
+	w.subsLock.Unlock()
+
+	go func() {
+		<-ctx.Done()
+
+		w.subsLock.Lock()
+		defer w.subsLock.Unlock()
+		if w.removeHandler(key, id) && w.getState() == Connected {
+			w.writeJSON(sub.message("unsubscribe"))
+		}
+	}()
+
+	return nil
+}
+
+// removeHandler removes a subscriber and reports whether it was the last
+// one, in which case the subscription is dropped. The caller holds subsLock.
+func (w *wsConn) removeHandler(key string, id int64) bool {
+	sub, ok := w.subs[key]
+	if !ok {
+		return false
+	}
+	delete(sub.handlers, id)
+	if len(sub.handlers) > 0 {
+		return false
+	}
+	delete(w.subs, key)
+	return true
+}
+
+// latestRelay returns a send function that never blocks: values are
+// forwarded to out until ctx is done, and one the consumer has not taken yet
+// is replaced by the next. Suits feeds where only the latest value matters.
+func latestRelay[T any](ctx context.Context, out chan<- T) func(T) {
+	var (
+		mu     sync.Mutex
+		latest T
+	)
+	ready := make(chan struct{}, 1)
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ready:
+			}
+
+			mu.Lock()
+			v := latest
+			mu.Unlock()
+
+			select {
+			case out <- v:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return func(v T) {
+		mu.Lock()
+		latest = v
+		mu.Unlock()
+
+		select {
+		case ready <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// bufferedRelay returns a send function that never blocks: values are
+// forwarded to out in order until ctx is done, holding up to limit values
+// the consumer has not taken yet. Send reports false when the buffer is full
+// and the value was dropped.
+func bufferedRelay[T any](ctx context.Context, out chan<- T, limit int) func(T) bool {
+	var (
+		mu    sync.Mutex
+		queue []T
+	)
+	ready := make(chan struct{}, 1)
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ready:
+			}
+
+			for {
+				mu.Lock()
+				if len(queue) == 0 {
+					mu.Unlock()
+					break
+				}
+				v := queue[0]
+				queue = queue[1:]
+				mu.Unlock()
+
+				select {
+				case out <- v:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return func(v T) bool {
+		mu.Lock()
+		if len(queue) >= limit {
+			mu.Unlock()
+			return false
+		}
+		queue = append(queue, v)
+		mu.Unlock()
+
+		select {
+		case ready <- struct{}{}:
+		default:
+		}
+		return true
+	}
+}
+
+// resubscribe replays every active subscription on the current connection
+func (w *wsConn) resubscribe() error {
+	w.subsLock.Lock()
+	subs := make([]*subscription, 0, len(w.subs))
+	for _, sub := range w.subs {
+		subs = append(subs, sub)
+	}
+	w.subsLock.Unlock()
+
+	for _, sub := range subs {
+		if err := w.writeJSON(sub.message("subscribe")); err != nil {
+			return fmt.Errorf("failed to resubscribe to %s %s: %w", sub.channel, sub.symbol, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *subscription) message(method string) map[string]interface{} {
+	params := map[string]interface{}{
+		"channel": s.channel,
+	}
+	if s.symbol != "" {
+		params["symbol"] = []string{s.symbol}
+	}
+	for k, v := range s.params {
+		params[k] = v
+	}
+
+	return map[string]interface{}{
+		"method": method,
+		"params": params,
+	}
+}
+
+func (w *wsConn) setState(state ConnectionState) {
+	w.stateLock.Lock()
+	if w.state == state {
+		w.stateLock.Unlock()
+		return
+	}
+	w.state = state
+	w.stateLock.Unlock()
+
+	w.client.notifyState(w.endpoint, state)
+}
+
+func (w *wsConn) getState() ConnectionState {
+	w.stateLock.RLock()
+	defer w.stateLock.RUnlock()
+	return w.state
+}
@@ -0,0 +1,246 @@
+package kraken
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// wsTokenTTL is how long a token may sit unused before Kraken expires it
+const wsTokenTTL = 14 * time.Minute
+
+// GetWebSocketsToken fetches a token for the authenticated WebSocket API
+func (c *Client) GetWebSocketsToken(ctx context.Context) (string, error) {
+	var result struct {
+		Token string `json:"token"`
+	}
+
+	if err := c.privateRequest(ctx, "/0/private/GetWebSocketsToken", url.Values{}, &result); err != nil {
+		return "", fmt.Errorf("failed to get websocket token: %w", err)
+	}
+
+	return result.Token, nil
+}
+
+// token returns a cached WebSocket token, fetching a new one when needed
+func (c *Client) token(ctx context.Context) (string, error) {
+	c.wsTokenLock.Lock()
+	defer c.wsTokenLock.Unlock()
+
+	if c.wsToken != "" && time.Since(c.wsTokenTime) < wsTokenTTL {
+		c.wsTokenTime = time.Now()
+		return c.wsToken, nil
+	}
+
+	token, err := c.GetWebSocketsToken(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	c.wsToken = token
+	c.wsTokenTime = time.Now()
+	return token, nil
+}
+
+// privateWS sends an authenticated method call on the private connection and
+// decodes its result. token is filled in unless the caller already set one.
+func (c *Client) privateWS(ctx context.Context, method string, token *string, params interface{}, result interface{}) error {
+	if *token == "" {
+		t, err := c.token(ctx)
+		if err != nil {
+			return err
+		}
+		*token = t
+	}
+
+	resp, err := c.private.request(ctx, method, params)
+	if err != nil {
+		return fmt.Errorf("%s failed: %w", method, err)
+	}
+
+	if result == nil || len(resp.Result) == 0 {
+		return nil
+	}
+
+	if err := json.Unmarshal(resp.Result, result); err != nil {
+		return fmt.Errorf("failed to parse %s response: %w", method, err)
+	}
+
+	return nil
+}
+
+// NewWSOrderRequest converts a REST order request into its WebSocket form
+func NewWSOrderRequest(req OrderRequest) (WSOrderRequest, error) {
+	if err := req.Validate(); err != nil {
+		return WSOrderRequest{}, fmt.Errorf("invalid order: %w", err)
+	}
+
+	qty, err := strconv.ParseFloat(req.Volume, 64)
+	if err != nil {
+		return WSOrderRequest{}, fmt.Errorf("invalid volume: %w", err)
+	}
+
+	var price float64
+	if req.Price != "" {
+		if price, err = strconv.ParseFloat(req.Price, 64); err != nil {
+			return WSOrderRequest{}, fmt.Errorf("invalid price: %w", err)
+		}
+	}
+
+	ws := WSOrderRequest{
+		OrderType: string(req.Type),
+		Side:      req.Side,
+		OrderQty:  qty,
+		Symbol:    req.Pair,
+		Margin:    req.Leverage != "" && Leverage(req.Leverage) != NoLeverage,
+		PostOnly:  strings.Contains(req.OrderFlags, "post"),
+	}
+
+	switch req.Type {
+	case StopLossOrder, TakeProfitOrder:
+		ws.Triggers = &WSTrigger{Price: price}
+	default:
+		ws.LimitPrice = price
+	}
+
+	return ws, nil
+}
+
+// AddOrderWS places a new order via WebSocket API
+func (c *Client) AddOrderWS(ctx context.Context, req WSOrderRequest) (*WSOrderResult, error) {
+	var result WSOrderResult
+	if err := c.privateWS(ctx, "add_order", &req.Token, &req, &result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// CancelOrderWS cancels one or more orders by order ID, cl_ord_id or userref
+func (c *Client) CancelOrderWS(ctx context.Context, req WSCancelRequest) error {
+	if len(req.OrderIDs)+len(req.ClOrdIDs)+len(req.OrderUserrefs) == 0 {
+		return fmt.Errorf("no orders to cancel")
+	}
+
+	return c.privateWS(ctx, "cancel_order", &req.Token, &req, nil)
+}
+
+// CancelAllWS cancels every open order and returns how many were cancelled
+func (c *Client) CancelAllWS(ctx context.Context) (int, error) {
+	params := struct {
+		Token string `json:"token"`
+	}{}
+
+	var result struct {
+		Count int `json:"count"`
+	}
+	if err := c.privateWS(ctx, "cancel_all", &params.Token, &params, &result); err != nil {
+		return 0, err
+	}
+
+	return result.Count, nil
+}
+
+// AmendOrderWS changes the quantity or price of an open order in place
+func (c *Client) AmendOrderWS(ctx context.Context, req WSAmendRequest) (*WSOrderResult, error) {
+	if req.OrderID == "" && req.ClOrdID == "" {
+		return nil, fmt.Errorf("order_id or cl_ord_id is required")
+	}
+
+	var result WSOrderResult
+	if err := c.privateWS(ctx, "amend_order", &req.Token, &req, &result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// EditOrderWS replaces an open order; the result carries the new order ID
+func (c *Client) EditOrderWS(ctx context.Context, req WSEditRequest) (*WSOrderResult, error) {
+	if req.OrderID == "" || req.Symbol == "" {
+		return nil, fmt.Errorf("order_id and symbol are required")
+	}
+
+	var result WSOrderResult
+	if err := c.privateWS(ctx, "edit_order", &req.Token, &req, &result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// BatchAddWS places between 2 and 15 orders on a single symbol
+func (c *Client) BatchAddWS(ctx context.Context, req WSBatchAddRequest) ([]WSOrderResult, error) {
+	if len(req.Orders) < 2 || len(req.Orders) > 15 {
+		return nil, fmt.Errorf("batch_add requires 2 to 15 orders, got %d", len(req.Orders))
+	}
+
+	// Symbol and token belong to the batch, not the individual orders
+	orders := make([]WSOrderRequest, len(req.Orders))
+	for i, o := range req.Orders {
+		o.Symbol = ""
+		o.Token = ""
+		orders[i] = o
+	}
+	req.Orders = orders
+
+	var result []WSOrderResult
+	if err := c.privateWS(ctx, "batch_add", &req.Token, &req, &result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// BatchCancelWS cancels between 2 and 50 orders by order ID or userref
+func (c *Client) BatchCancelWS(ctx context.Context, req WSBatchCancelRequest) (int, error) {
+	n := len(req.Orders) + len(req.ClOrdIDs)
+	if n < 2 || n > 50 {
+		return 0, fmt.Errorf("batch_cancel requires 2 to 50 orders, got %d", n)
+	}
+
+	var result struct {
+		Count int `json:"count"`
+	}
+	if err := c.privateWS(ctx, "batch_cancel", &req.Token, &req, &result); err != nil {
+		return 0, err
+	}
+
+	return result.Count, nil
+}
+
+// executionBuffer is how many execution updates are held for a consumer that
+// is behind before further updates are dropped
+const executionBuffer = 1024
+
+// SubscribeToExecutions streams order and trade updates from the private
+// connection. The subscription survives reconnects and ends when ctx is done.
+// Updates wait in a bounded buffer, so a slow consumer never stalls the
+// connection.
+func (c *Client) SubscribeToExecutions(ctx context.Context, execChan chan<- Execution) error {
+	token, err := c.token(ctx)
+	if err != nil {
+		return err
+	}
+
+	params := map[string]interface{}{
+		"token":       token,
+		"snap_orders": false,
+	}
+
+	send := bufferedRelay(ctx, execChan, executionBuffer)
+	return c.private.subscribe(ctx, "executions", "", params, func(_ string, data json.RawMessage) {
+		var exec Execution
+		if err := json.Unmarshal(data, &exec); err != nil {
+			return
+		}
+
+		if !send(exec) {
+			fmt.Printf("executions consumer is behind, dropped %s update for order %s\n", exec.ExecType, exec.OrderID)
+		}
+	})
+}
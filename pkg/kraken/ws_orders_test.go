@@ -0,0 +1,230 @@
+package kraken
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// newMockOrderServer answers every method call with the result registered
+// for it and records the params it received
+func newMockOrderServer(t *testing.T, results map[string]interface{}, received chan<- map[string]interface{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		for {
+			var req struct {
+				Method string                 `json:"method"`
+				Params map[string]interface{} `json:"params"`
+				ReqID  int64                  `json:"req_id"`
+			}
+			if err := conn.ReadJSON(&req); err != nil {
+				return
+			}
+
+			req.Params["method"] = req.Method
+			received <- req.Params
+
+			resp := map[string]interface{}{
+				"method":  req.Method,
+				"req_id":  req.ReqID,
+				"success": true,
+			}
+			if result, ok := results[req.Method]; ok {
+				if msg, isErr := result.(error); isErr {
+					resp["success"] = false
+					resp["error"] = msg.Error()
+				} else {
+					resp["result"] = result
+				}
+			}
+			if err := conn.WriteJSON(resp); err != nil {
+				return
+			}
+		}
+	}))
+}
+
+func newOrderTestClient(t *testing.T, results map[string]interface{}) (*Client, chan map[string]interface{}, func()) {
+	received := make(chan map[string]interface{}, 10)
+	ws := newMockOrderServer(t, results, received)
+
+	rest := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/0/public/AssetPairs":
+			w.Write([]byte(mockAssetPair))
+		case "/0/private/GetWebSocketsToken":
+			w.Write([]byte(`{"error":[],"result":{"token":"TOKEN-1","expires":900}}`))
+		default:
+			t.Errorf("unexpected REST call to %s", r.URL.Path)
+		}
+	}))
+
+	client := NewTestClient(t, &TestConfig{
+		DemoAPIKey:    "test",
+		DemoAPISecret: "test",
+		DemoAPIURL:    rest.URL,
+		WebSocketURL:  ws.URL,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := client.ConnectPrivateWebSocket(ctx); err != nil {
+		t.Fatalf("ConnectPrivateWebSocket() error = %v", err)
+	}
+
+	return client, received, func() {
+		cancel()
+		client.Close()
+		ws.Close()
+		rest.Close()
+	}
+}
+
+func TestClient_AddOrderWS(t *testing.T) {
+	client, received, cleanup := newOrderTestClient(t, map[string]interface{}{
+		"add_order": map[string]interface{}{"order_id": "OABCDE-12345-FGHIJ", "cl_ord_id": "alert-1"},
+	})
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, err := NewWSOrderRequest(OrderRequest{
+		Pair:       "XBT/USD",
+		Type:       LimitOrder,
+		Side:       "buy",
+		Volume:     "0.5",
+		Price:      "50000",
+		OrderFlags: "post",
+	})
+	if err != nil {
+		t.Fatalf("NewWSOrderRequest() error = %v", err)
+	}
+	req.ClOrdID = "alert-1"
+
+	result, err := client.AddOrderWS(ctx, req)
+	if err != nil {
+		t.Fatalf("AddOrderWS() error = %v", err)
+	}
+	if result.OrderID != "OABCDE-12345-FGHIJ" {
+		t.Errorf("OrderID = %v, want OABCDE-12345-FGHIJ", result.OrderID)
+	}
+
+	params := <-received
+	if params["token"] != "TOKEN-1" {
+		t.Errorf("token = %v, want TOKEN-1", params["token"])
+	}
+	if params["symbol"] != "XBT/USD" || params["limit_price"] != 50000.0 || params["post_only"] != true {
+		t.Errorf("unexpected params %v", params)
+	}
+}
+
+func TestClient_OrderManagementWS(t *testing.T) {
+	client, received, cleanup := newOrderTestClient(t, map[string]interface{}{
+		"cancel_all":   map[string]interface{}{"count": 3},
+		"batch_cancel": map[string]interface{}{"count": 2},
+		"amend_order":  map[string]interface{}{"order_id": "O1", "amend_id": "A1"},
+		"edit_order":   map[string]interface{}{"order_id": "O2", "original_order_id": "O1"},
+		"batch_add": []map[string]interface{}{
+			{"order_id": "O1"},
+			{"order_id": "O2"},
+		},
+		"cancel_order": json.RawMessage(`{"order_id":"O1"}`),
+	})
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := client.CancelOrderWS(ctx, WSCancelRequest{OrderIDs: []string{"O1"}}); err != nil {
+		t.Errorf("CancelOrderWS() error = %v", err)
+	}
+	if p := <-received; p["method"] != "cancel_order" {
+		t.Errorf("method = %v, want cancel_order", p["method"])
+	}
+
+	if n, err := client.CancelAllWS(ctx); err != nil || n != 3 {
+		t.Errorf("CancelAllWS() = %v, %v, want 3", n, err)
+	}
+	<-received
+
+	amended, err := client.AmendOrderWS(ctx, WSAmendRequest{OrderID: "O1", LimitPrice: 49000})
+	if err != nil || amended.AmendID != "A1" {
+		t.Errorf("AmendOrderWS() = %+v, %v", amended, err)
+	}
+	<-received
+
+	edited, err := client.EditOrderWS(ctx, WSEditRequest{OrderID: "O1", Symbol: "XBT/USD", OrderQty: 2})
+	if err != nil || edited.OrderID != "O2" || edited.OriginalOrderID != "O1" {
+		t.Errorf("EditOrderWS() = %+v, %v", edited, err)
+	}
+	<-received
+
+	placed, err := client.BatchAddWS(ctx, WSBatchAddRequest{
+		Symbol: "XBT/USD",
+		Orders: []WSOrderRequest{
+			{OrderType: "limit", Side: "buy", OrderQty: 1, LimitPrice: 100, Symbol: "XBT/USD"},
+			{OrderType: "limit", Side: "buy", OrderQty: 1, LimitPrice: 90},
+		},
+	})
+	if err != nil || len(placed) != 2 {
+		t.Fatalf("BatchAddWS() = %+v, %v", placed, err)
+	}
+	batch := <-received
+	for _, o := range batch["orders"].([]interface{}) {
+		if _, ok := o.(map[string]interface{})["symbol"]; ok {
+			t.Errorf("batch order should not carry its own symbol: %v", o)
+		}
+	}
+
+	if n, err := client.BatchCancelWS(ctx, WSBatchCancelRequest{Orders: []string{"O1", "O2"}}); err != nil || n != 2 {
+		t.Errorf("BatchCancelWS() = %v, %v, want 2", n, err)
+	}
+	<-received
+}
+
+func TestClient_OrderManagementWS_Validation(t *testing.T) {
+	client := NewClient("test", "test")
+	ctx := context.Background()
+
+	if err := client.CancelOrderWS(ctx, WSCancelRequest{}); err == nil {
+		t.Error("CancelOrderWS() with no identifiers should fail")
+	}
+	if _, err := client.AmendOrderWS(ctx, WSAmendRequest{LimitPrice: 1}); err == nil {
+		t.Error("AmendOrderWS() without order ID should fail")
+	}
+	if _, err := client.BatchAddWS(ctx, WSBatchAddRequest{Orders: make([]WSOrderRequest, 1)}); err == nil {
+		t.Error("BatchAddWS() with a single order should fail")
+	}
+	if _, err := client.BatchCancelWS(ctx, WSBatchCancelRequest{Orders: make([]string, 51)}); err == nil {
+		t.Error("BatchCancelWS() with 51 orders should fail")
+	}
+}
+
+func TestClient_AddOrderWS_APIError(t *testing.T) {
+	client, _, cleanup := newOrderTestClient(t, map[string]interface{}{
+		"add_order": errString("EOrder:Insufficient funds"),
+	})
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := client.AddOrderWS(ctx, WSOrderRequest{OrderType: "market", Side: "buy", OrderQty: 1, Symbol: "XBT/USD"})
+	if err == nil {
+		t.Fatal("AddOrderWS() expected error")
+	}
+}
+
+type errString string
+
+func (e errString) Error() string { return string(e) }